@@ -20,9 +20,20 @@ type fcallResponse struct {
 	err error
 }
 
+// ClientOptions holds optional client settings.
+type ClientOptions struct {
+	// If set, each message sent and received is logged via Tracef.
+	Tracef func(format string, args ...interface{})
+	// Reject invalid messages before sending them, and
+	// fail requests that receive an invalid response.
+	Validate bool
+}
+
 type Client struct {
 	msize   uint32
 	version string
+	tracef  func(format string, args ...interface{})
+	fcOpts  []FcallOption
 
 	connWriteLock sync.Mutex
 	conn          io.ReadWriteCloser
@@ -38,14 +49,23 @@ type Client struct {
 }
 
 func NewClient(conn io.ReadWriteCloser, version string, msize uint32) (*Client, error) {
+	return NewClientWithOptions(conn, version, msize, ClientOptions{})
+}
+
+func NewClientWithOptions(conn io.ReadWriteCloser, version string, msize uint32, opts ClientOptions) (*Client, error) {
 
 	c := &Client{
 		conn:         conn,
 		msize:        msize,
+		tracef:       opts.Tracef,
 		inflightTags: make(map[uint16]chan fcallResponse),
 		fids:         make(map[uint32]struct{}),
 	}
 
+	if opts.Validate {
+		c.fcOpts = append(c.fcOpts, ValidateFcalls)
+	}
+
 	success := false
 	defer func() {
 		if !success {
@@ -63,6 +83,10 @@ func NewClient(conn io.ReadWriteCloser, version string, msize uint32) (*Client,
 		return nil, err
 	}
 
+	if rlerror, ok := resp.(*Rlerror); ok {
+		// The server refused the connection.
+		return nil, rlerror
+	}
 	rVersion, ok := resp.(*Rversion)
 	if !ok || rVersion.Tag != 0xffff {
 		return nil, fmt.Errorf("unexpected response from server, expected Rversion with tag 0xFFFF")
@@ -78,6 +102,7 @@ func NewClient(conn io.ReadWriteCloser, version string, msize uint32) (*Client,
 
 	c.msize = rVersion.Msize
 	c.version = rVersion.Version
+	c.fcOpts = append(c.fcOpts, WithVersion(c.version))
 
 	go c.ReadWorker()
 
@@ -96,11 +121,18 @@ func (c *Client) Version() string {
 func (c *Client) writeFcall(fc Fcall) error {
 	c.connWriteLock.Lock()
 	defer c.connWriteLock.Unlock()
-	return WriteFcall(fc, c.msize, c.conn)
+	if c.tracef != nil {
+		c.tracef("-> %s", fc.String())
+	}
+	return WriteFcall(fc, c.msize, c.conn, c.fcOpts...)
 }
 
 func (c *Client) readFcall() (Fcall, error) {
-	return ReadFcall(c.msize, c.conn)
+	fc, err := ReadFcall(c.msize, c.conn, c.fcOpts...)
+	if fc != nil && c.tracef != nil {
+		c.tracef("<- %s", fc.String())
+	}
+	return fc, err
 }
 
 func (c *Client) hangupInflight(err error) {
@@ -119,17 +151,28 @@ func (c *Client) ReadWorker() {
 	for {
 		// XXX integrate buffer pool
 		fc, err := c.readFcall()
-		if err != nil {
+		var tag uint16
+		var unknownKind *UnknownKindError
+		if fc != nil {
+			tag = fc.GetTag()
+		} else if errors.As(err, &unknownKind) {
+			// The frame was skipped, only the request it answers fails.
+			tag = unknownKind.Tag
+		} else {
 			c.hangupInflight(err)
 			return
 		}
 		c.inflightTagsLock.Lock()
-		tag := fc.GetTag()
 		respChan, hasChan := c.inflightTags[tag]
 		delete(c.inflightTags, tag)
 		c.inflightTagsLock.Unlock()
 		if hasChan {
-			respChan <- fcallResponse{fc: fc}
+			if err != nil {
+				// An invalid or unknown response only fails the request it answers.
+				respChan <- fcallResponse{err: err}
+			} else {
+				respChan <- fcallResponse{fc: fc}
+			}
 		}
 	}
 }
@@ -167,7 +210,7 @@ func (c *Client) AcquireFid() (uint32, error) {
 	c.fidsLock.Lock()
 	defer c.fidsLock.Unlock()
 
-	if len(c.fids) >= 0xFFFFFFFF {
+	if uint64(len(c.fids)) >= 0xFFFFFFFF {
 		return 0xFFFFFFFF, ErrFidsExhausted
 	}
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -19,10 +20,9 @@ func ErrToErrno(err error) syscall.Errno {
 	if err == nil {
 		return 0
 	}
-	switch err := err.(type) {
-	case *proto9.Rlerror:
-		// TODO: we need an adaptor for non linux platforms.
-		return syscall.Errno(err.Ecode)
+	var rlerror *proto9.Rlerror
+	if errors.As(err, &rlerror) {
+		return proto9.DotLToSysErrno(rlerror.Ecode)
 	}
 	return syscall.EIO
 }
@@ -613,6 +613,7 @@ func main() {
 	msize := flag.Uint("msize", 65536, "maximum message size.")
 	aname := flag.String("aname", "", "aname to send in the attach message.")
 	uname := flag.String("uname", "", "uname to send in the attach message.")
+	trace := flag.Bool("trace", false, "log all 9p messages.")
 
 	flag.Parse()
 
@@ -627,13 +628,18 @@ func main() {
 		log.Fatalf("unable to dial address: %s", err)
 	}
 
-	client, err := proto9.NewClient(conn, "9P2000.L", uint32(*msize))
+	clientOpts := proto9.ClientOptions{}
+	if *trace {
+		clientOpts.Tracef = log.Printf
+	}
+
+	client, err := proto9.NewClientWithOptions(conn, "9P2000.L", uint32(*msize), clientOpts)
 	if err != nil {
 		log.Fatalf("unable to negotiate protocol version: %s", err)
 	}
 	defer client.Close()
 
-	attachPoint, err := proto9.AttachDotL(client, *aname, *uname)
+	attachPoint, _, err := proto9.AttachDotL(client, *aname, *uname)
 	if err != nil {
 		log.Fatalf("unable to attach to mount: %s", err)
 	}
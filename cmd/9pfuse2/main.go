@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -19,10 +20,9 @@ func ErrToStatus(err error) fuse.Status {
 	if err == nil {
 		return fuse.OK
 	}
-	switch err := err.(type) {
-	case *proto9.Rlerror:
-		// TODO: we need an adaptor for non linux platforms.
-		return fuse.Status(err.Ecode)
+	var rlerror *proto9.Rlerror
+	if errors.As(err, &rlerror) {
+		return fuse.Status(proto9.DotLToSysErrno(rlerror.Ecode))
 	}
 	return fuse.Status(syscall.EIO)
 }
@@ -134,7 +134,6 @@ func NewProto9FS(rootFile *proto9.ClientDotLFile, rootQid proto9.Qid) *Proto9FS
 		n2Inode:           make(map[uint64]*Inode9),
 		p2Inode:           make(map[uint64]*Inode9),
 		fh2OpenFile:       make(map[uint64]*OpenFile),
-		dirEnts:           make(map[uint64]map[string]struct{}),
 	}
 
 	rootInode := &Inode9{
@@ -799,6 +798,7 @@ func main() {
 	msize := flag.Uint("msize", 65536, "maximum message size.")
 	aname := flag.String("aname", "", "aname to send in the attach message.")
 	uname := flag.String("uname", "", "uname to send in the attach message.")
+	trace := flag.Bool("trace", false, "log all 9p messages.")
 
 	flag.Parse()
 
@@ -813,7 +813,12 @@ func main() {
 		log.Fatalf("unable to dial address: %s", err)
 	}
 
-	client, err := proto9.NewClient(conn, "9P2000.L", uint32(*msize))
+	clientOpts := proto9.ClientOptions{}
+	if *trace {
+		clientOpts.Tracef = log.Printf
+	}
+
+	client, err := proto9.NewClientWithOptions(conn, "9P2000.L", uint32(*msize), clientOpts)
 	if err != nil {
 		log.Fatalf("unable to negotiate protocol version: %s", err)
 	}
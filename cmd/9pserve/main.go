@@ -0,0 +1,125 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/andrewchambers/proto9-go"
+	"github.com/andrewchambers/proto9-go/middleware"
+)
+
+func usage() {
+	fmt.Printf("9pserve [OPTS] DIR\n")
+	fmt.Printf("9pserve [OPTS] -ram\n")
+	os.Exit(1)
+}
+
+func main() {
+
+	address := flag.String("address", "localhost:1777", "address to listen on.")
+	trace := flag.Bool("trace", false, "log all 9p messages.")
+	ram := flag.Bool("ram", false, "serve an empty in memory filesystem.")
+	readOnly := flag.Bool("readonly", false, "refuse requests that modify files.")
+	accessLog := flag.Bool("accesslog", false, "log requests that modify files.")
+	lockGrace := flag.Duration("lockgrace", 0, "only grant reclaimed locks for this long after starting.")
+	multiUser := flag.Bool("multiuser", false, "perform requests as the attaching user from /etc/passwd, requires root.")
+
+	flag.Parse()
+
+	srv := &proto9.Server{}
+	if *trace {
+		srv.Tracef = log.Printf
+	}
+
+	var users proto9.UserDB
+	if *multiUser {
+		passwd, err := proto9.LoadPasswd("/etc/passwd", "/etc/group")
+		if err != nil {
+			log.Fatalf("unable to load users: %s", err)
+		}
+		users = passwd
+	}
+
+	if *ram {
+		if len(flag.Args()) != 0 {
+			usage()
+		}
+		ramfs := proto9.NewRamFS()
+		ramfs.Users = users
+		srv.NewFilesystem = func(info proto9.ConnInfo) proto9.Filesystem {
+			return ramfs.NewFilesystem()
+		}
+	} else {
+		if len(flag.Args()) != 1 {
+			usage()
+		}
+		dir := flag.Args()[0]
+		srv.NewFilesystem = func(info proto9.ConnInfo) proto9.Filesystem {
+			if users != nil {
+				return proto9.NewMultiUserPassthroughFilesystem(dir, users)
+			}
+			return proto9.NewPassthroughFilesystem(dir)
+		}
+	}
+
+	if *lockGrace != 0 {
+		graceEnd := time.Now().Add(*lockGrace)
+		newFilesystem := srv.NewFilesystem
+		srv.NewFilesystem = func(info proto9.ConnInfo) proto9.Filesystem {
+			fs := newFilesystem(info)
+			if fs, ok := fs.(*proto9.DotLFilesystem); ok {
+				fs.LockGraceEnd = graceEnd
+			}
+			return fs
+		}
+	}
+
+	var wrappers []middleware.Middleware
+	if *accessLog {
+		wrappers = append(wrappers, middleware.AccessLog(func(e *middleware.AccessEntry) {
+			log.Printf("%s uid=%d %s %q %q ecode=%d", e.Uname, e.Uid, e.Op, e.Path, e.NewPath, e.Ecode)
+		}))
+	}
+	if *readOnly {
+		wrappers = append(wrappers, middleware.ReadOnly())
+	}
+	if len(wrappers) != 0 {
+		newFilesystem := srv.NewFilesystem
+		srv.NewFilesystem = func(info proto9.ConnInfo) proto9.Filesystem {
+			return middleware.Chain(newFilesystem(info), wrappers...)
+		}
+	}
+
+	l, err := net.Listen("tcp", *address)
+	if err != nil {
+		log.Fatalf("unable to listen: %s", err)
+	}
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		<-sigs
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			log.Printf("shutdown failed: %s", err)
+			_ = srv.Close()
+		}
+	}()
+
+	err = srv.Serve(l)
+	if err != proto9.ErrServerClosed {
+		log.Fatalf("serve failed: %s", err)
+	}
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"go/types"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 
 	"golang.org/x/tools/go/packages"
@@ -91,8 +96,30 @@ func upperCaseFirst(s string) string {
 	return strings.ToUpper(s[0:1]) + s[1:]
 }
 
-func outPrelude(out io.Writer) {
-	fmt.Fprintln(out, "package proto9\nimport (\n\t\"bytes\"\n)")
+func isQidType(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Named:
+		return t.Obj().Name() == "Qid"
+	}
+	return false
+}
+
+func isMessage(t *types.Struct) bool {
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		if f.Embedded() && f.Name() == "Tagged" {
+			return true
+		}
+	}
+	return false
+}
+
+func outPrelude(pkgName string, external bool, out io.Writer) {
+	fmt.Fprintf(out, "package %s\nimport (\n\t\"bytes\"\n\t\"strings\"\n", pkgName)
+	if external {
+		fmt.Fprintf(out, "\n\tproto9 %q\n", proto9Path)
+	}
+	fmt.Fprintln(out, ")")
 }
 
 func outEncodedSize(topLevelName string, t *types.Struct, out io.Writer) {
@@ -202,19 +229,160 @@ func outDecoder(topLevelName string, t *types.Struct, out io.Writer) {
 	fmt.Fprintf(out, "return nil\n}\n\n")
 }
 
+// Field names that read better in a base other than decimal.
+var stringFieldFormatters = map[string]string{
+	"Mode":  "fmtOctal",
+	"Perm":  "fmtOctal",
+	"Valid": "fmtHex",
+	"Mask":  "fmtHex",
+	"Flags": "fmtHex",
+}
+
+func outStringFields(prefix string, t *types.Struct, out io.Writer) {
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		v := prefix + f.Name()
+		label := strings.ToLower(f.Name())
+		if f.Embedded() && f.Name() == "Tagged" {
+			fmt.Fprintf(out, "fmtUint(b, \"tag\", uint64(%s.Tag))\n", v)
+		} else if isNumberType(f.Type()) {
+			formatter, ok := stringFieldFormatters[f.Name()]
+			if !ok {
+				formatter = "fmtUint"
+			}
+			fmt.Fprintf(out, "%s(b, %q, uint64(%s))\n", formatter, label, v)
+		} else if isByteSlice(f.Type()) {
+			fmt.Fprintf(out, "fmtData(b, %s)\n", v)
+		} else if isStringSlice(f.Type()) {
+			fmt.Fprintf(out, "fmtStrings(b, %q, %s)\n", "n"+strings.TrimSuffix(label, "s"), v)
+		} else if isDirEntSlice(f.Type()) {
+			fmt.Fprintf(out, "fmtDirEnts(b, %s)\n", v)
+		} else if isStringType(f.Type()) {
+			fmt.Fprintf(out, "fmtString(b, %q, %s)\n", label, v)
+		} else if isQidSlice(f.Type()) {
+			fmt.Fprintf(out, "fmtQids(b, %q, %s)\n", "n"+strings.TrimSuffix(label, "s"), v)
+		} else if isQidType(f.Type()) {
+			fmt.Fprintf(out, "fmtQid(b, %q, &%s)\n", label, v)
+		} else if st, ok := f.Type().Underlying().(*types.Struct); ok && f.Embedded() {
+			outStringFields(v+".", st, out)
+		} else {
+			fatalErr(
+				fmt.Errorf("don't know how to format type field %s", f.Type()),
+			)
+		}
+	}
+}
+
+func outStringer(topLevelName string, t *types.Struct, out io.Writer) {
+	fmt.Fprintf(out, "func (v *%s) String() string {\n", topLevelName)
+	fmt.Fprintln(out, "b := &strings.Builder{}")
+	fmt.Fprintf(out, "b.WriteString(%q)\n", topLevelName)
+	outStringFields("v.", t, out)
+	fmt.Fprintf(out, "return b.String()\n}\n\n")
+}
+
+// validateRules parses the `validate:"..."` tag of a field, rules are:
+// name - strings must be a valid entry name, slices valid path elements.
+// maxwelem - slices must not exceed MAXWELEM elements.
+func validateRules(t *types.Struct, i int) map[string]bool {
+	rules := make(map[string]bool)
+	tag := reflect.StructTag(t.Tag(i)).Get("validate")
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "" {
+			continue
+		}
+		switch rule {
+		case "name", "maxwelem":
+			rules[rule] = true
+		default:
+			fatalErr(fmt.Errorf("unknown validation rule %q on field %s", rule, t.Field(i).Name()))
+		}
+	}
+	return rules
+}
+
+func outValidateFields(topLevelName string, prefix string, t *types.Struct, out io.Writer) {
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		v := prefix + f.Name()
+		rules := validateRules(t, i)
+		check := func(format string, args ...interface{}) {
+			fmt.Fprintf(out, "err = "+format+"\n", args...)
+			fmt.Fprintln(out, "if err != nil {\nreturn err\n}")
+		}
+		if rules["maxwelem"] {
+			check("validateMaxWelem(%q, %q, len(%s))", topLevelName, f.Name(), v)
+		}
+		if isStringType(f.Type()) {
+			if rules["name"] {
+				check("validateName(%q, %q, %s)", topLevelName, f.Name(), v)
+			} else {
+				check("validateString(%q, %q, %s)", topLevelName, f.Name(), v)
+			}
+		} else if isStringSlice(f.Type()) {
+			check("validateStrings(%q, %q, %s)", topLevelName, f.Name(), v)
+			if rules["name"] {
+				check("validateNames(%q, %q, %s)", topLevelName, f.Name(), v)
+			}
+		} else if isDirEntSlice(f.Type()) {
+			check("validateDirEnts(%q, %q, %s)", topLevelName, f.Name(), v)
+		} else if st, ok := f.Type().Underlying().(*types.Struct); ok && f.Embedded() {
+			outValidateFields(topLevelName, v+".", st, out)
+		}
+	}
+}
+
+func outValidator(topLevelName string, t *types.Struct, out io.Writer) {
+	fmt.Fprintf(out, "func (v *%s) Validate(msize uint32) error {\n", topLevelName)
+	fmt.Fprintln(out, "var err error")
+	outValidateFields(topLevelName, "v.", t, out)
+	fmt.Fprintf(out, "err = validateSize(%q, v.EncodedSize(), msize)\n", topLevelName)
+	fmt.Fprintln(out, "if err != nil {\nreturn err\n}")
+	fmt.Fprintf(out, "return nil\n}\n\n")
+}
+
 func fatalErr(err error) {
 	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	os.Exit(1)
 }
 
+const proto9Path = "github.com/andrewchambers/proto9-go"
+
+var helperCall = regexp.MustCompile(`\b(encode|decode|fmt|validate)([A-Z][A-Za-z0-9]*)\(`)
+
+// qualifyHelpers rewrites calls to the package private helpers into
+// calls to their exported forms, for code outside of proto9.
+func qualifyHelpers(src []byte) []byte {
+	exported := map[string]string{
+		"encode":   "Encode",
+		"decode":   "Decode",
+		"fmt":      "Format",
+		"validate": "Validate",
+	}
+	return helperCall.ReplaceAllFunc(src, func(m []byte) []byte {
+		sm := helperCall.FindSubmatch(m)
+		return []byte("proto9." + exported[string(sm[1])] + string(sm[2]) + "(")
+	})
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: encdec-codegen [-types FILE] PACKAGE OUTFILE\n")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
 func main() {
+	typesFile := flag.String("types", "fcalltypes.go", "only generate code for structs declared in files with this name.")
+	flag.Usage = usage
+	flag.Parse()
+
 	// Handle arguments to command
-	if len(os.Args) != 3 {
-		fatalErr(fmt.Errorf("expected: PACKAGE OUTFILE"))
+	if len(flag.Args()) != 2 {
+		usage()
 	}
 
-	cfg := &packages.Config{Mode: packages.NeedTypes | packages.NeedImports}
-	pkgs, err := packages.Load(cfg, os.Args[1])
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedTypes | packages.NeedImports}
+	pkgs, err := packages.Load(cfg, flag.Args()[0])
 	if err != nil {
 		fatalErr(fmt.Errorf("loading packages for inspection: %v", err))
 	}
@@ -223,41 +391,51 @@ func main() {
 		fmt.Fprintf(os.Stderr, "continuing despite errors...\n")
 	}
 
-	out := os.Stdout
-
-	if os.Args[2] != "-" {
-		out, err = os.Create(os.Args[2])
-		if err != nil {
-			fatalErr(err)
-		}
+	if len(pkgs) != 1 {
+		fatalErr(fmt.Errorf("expected a single package, got %d", len(pkgs)))
 	}
+	pkg := pkgs[0]
+	external := pkg.PkgPath != proto9Path
 
-	outPrelude(out)
-	for _, pkg := range pkgs {
-		scope := pkg.Types.Scope()
-		for _, name := range scope.Names() {
-			obj := scope.Lookup(name)
-			if _, ok := obj.(*types.TypeName); !ok {
-				continue
-			}
+	var buf bytes.Buffer
 
-			t, ok := obj.Type().Underlying().(*types.Struct)
-			if !ok {
-				continue
-			}
+	outPrelude(pkg.Name, external, &buf)
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if _, ok := obj.(*types.TypeName); !ok {
+			continue
+		}
 
-			fileName := pkg.Fset.PositionFor(obj.Pos(), false).Filename
-			if !strings.HasSuffix(fileName, "/fcalltypes.go") {
-				continue
-			}
+		t, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
 
-			outEncodedSize(name, t, out)
-			outEncoder(name, t, out)
-			outDecoder(name, t, out)
+		fileName := pkg.Fset.PositionFor(obj.Pos(), false).Filename
+		if filepath.Base(fileName) != *typesFile {
+			continue
 		}
+
+		outEncodedSize(name, t, &buf)
+		outEncoder(name, t, &buf)
+		outDecoder(name, t, &buf)
+		if isMessage(t) {
+			outStringer(name, t, &buf)
+			outValidator(name, t, &buf)
+		}
+	}
+
+	src := buf.Bytes()
+	if external {
+		src = qualifyHelpers(src)
 	}
 
-	err = out.Close()
+	if flag.Args()[1] == "-" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(flag.Args()[1], src, 0o666)
+	}
 	if err != nil {
 		fatalErr(err)
 	}
@@ -4,8 +4,10 @@ package proto9
 const (
 	NOTAG        = uint16(0xFFFF)
 	NOFID        = uint32(0xFFFFFFFF)
+	NONUNAME     = uint32(0xFFFFFFFF)
 	IOHDRSZ      = uint32(24)
 	READDIRHDRSZ = uint32(24)
+	MAXWELEM     = 16
 )
 
 // 9P2000/.U/.L Qid flags.
@@ -73,9 +75,65 @@ const (
 
 // 9P2000.L Tlopen flags.
 const (
-	L_O_RDONLY = 0
-	L_O_WRONLY = 1
-	L_O_RDWR   = 2
-	L_O_EXCL   = 0o200
-	L_O_TRUNC  = 0o1000
+	L_O_RDONLY    = 0
+	L_O_WRONLY    = 1
+	L_O_RDWR      = 2
+	L_O_ACCMODE   = 3
+	L_O_CREAT     = 0o100
+	L_O_EXCL      = 0o200
+	L_O_NOCTTY    = 0o400
+	L_O_TRUNC     = 0o1000
+	L_O_APPEND    = 0o2000
+	L_O_NONBLOCK  = 0o4000
+	L_O_DSYNC     = 0o10000
+	L_O_FASYNC    = 0o20000
+	L_O_DIRECT    = 0o40000
+	L_O_LARGEFILE = 0o100000
+	L_O_DIRECTORY = 0o200000
+	L_O_NOFOLLOW  = 0o400000
+	L_O_NOATIME   = 0o1000000
+	L_O_CLOEXEC   = 0o2000000
+	L_O_SYNC      = 0o4000000
+)
+
+// 9P2000.L Tunlinkat flags.
+const (
+	L_AT_REMOVEDIR = 0x200
+)
+
+// 9P2000.L Txattrcreate flags.
+const (
+	L_XATTR_CREATE  = 1
+	L_XATTR_REPLACE = 2
+)
+
+// 9P2000.L file mode type bits.
+const (
+	L_S_IFMT   = 0o170000
+	L_S_IFSOCK = 0o140000
+	L_S_IFLNK  = 0o120000
+	L_S_IFREG  = 0o100000
+	L_S_IFBLK  = 0o060000
+	L_S_IFDIR  = 0o040000
+	L_S_IFCHR  = 0o020000
+	L_S_IFIFO  = 0o010000
+)
+
+// 9P2000.L file mode set id and sticky bits.
+const (
+	L_S_ISUID = 0o4000
+	L_S_ISGID = 0o2000
+	L_S_ISVTX = 0o1000
+)
+
+// 9P2000.L directory entry types.
+const (
+	L_DT_UNKNOWN = 0
+	L_DT_FIFO    = 1
+	L_DT_CHR     = 2
+	L_DT_DIR     = 4
+	L_DT_BLK     = 6
+	L_DT_REG     = 8
+	L_DT_LNK     = 10
+	L_DT_SOCK    = 12
 )
@@ -0,0 +1,86 @@
+package proto9
+
+import (
+	"sort"
+	"sync"
+)
+
+// DirCookies assigns Treaddir offsets to directory entries that stay
+// valid while the directory changes. An entry keeps its cookie for as
+// long as it is listed and new entries get larger cookies, so a client
+// resuming from any offset sees each remaining entry once.
+//
+// Keep one DirCookies per directory rather than per fid, the zero
+// value is ready to use.
+type DirCookies struct {
+	lock    sync.Mutex
+	next    uint64
+	cookies map[string]uint64
+}
+
+// Cookies of the synthesized "." and ".." entries.
+const (
+	dotCookie    = 1
+	dotDotCookie = 2
+)
+
+// Readdir answers a Treaddir from the current entries of a directory,
+// which should not include "." or "..", those are synthesized from
+// dir and parent. Entries seen for the first time are assigned cookies
+// in the order given. The returned entries follow offset and are
+// packed to count bytes.
+func (c *DirCookies) Readdir(dir Qid, parent Qid, ents []DirEnt, offset uint64, count uint32) []DirEnt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cookies == nil {
+		c.cookies = make(map[string]uint64)
+		c.next = dotDotCookie + 1
+	}
+
+	listed := make(map[string]struct{}, len(ents))
+	result := make([]DirEnt, 0, len(ents)+2)
+	if offset < dotCookie {
+		result = append(result, DirEnt{Qid: dir, Offset: dotCookie, Typ: L_DT_DIR, Name: "."})
+	}
+	if offset < dotDotCookie {
+		result = append(result, DirEnt{Qid: parent, Offset: dotDotCookie, Typ: L_DT_DIR, Name: ".."})
+	}
+	for _, ent := range ents {
+		cookie, ok := c.cookies[ent.Name]
+		if !ok {
+			cookie = c.next
+			c.next += 1
+			c.cookies[ent.Name] = cookie
+		}
+		listed[ent.Name] = struct{}{}
+		if cookie > offset {
+			ent.Offset = cookie
+			result = append(result, ent)
+		}
+	}
+	// Forget removed entries, if they return they are new.
+	for name := range c.cookies {
+		if _, ok := listed[name]; !ok {
+			delete(c.cookies, name)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Offset < result[j].Offset
+	})
+	return PackDirEnts(result, count)
+}
+
+// PackDirEnts returns the leading entries of ents that fit in an
+// Rreaddir of count bytes.
+func PackDirEnts(ents []DirEnt, count uint32) []DirEnt {
+	sz := uint64(0)
+	for i := range ents {
+		sz += ents[i].EncodedSize()
+		if sz > uint64(count) {
+			return ents[:i]
+		}
+	}
+	return ents
+}
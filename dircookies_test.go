@@ -0,0 +1,65 @@
+package proto9
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDirCookies(t *testing.T) {
+	dir := Qid{Typ: QT_DIR, Path: 1}
+	parent := Qid{Typ: QT_DIR, Path: 2}
+	listing := func(names ...string) []DirEnt {
+		ents := []DirEnt{}
+		for i, name := range names {
+			ents = append(ents, DirEnt{Qid: Qid{Path: uint64(10 + i)}, Typ: L_DT_REG, Name: name})
+		}
+		return ents
+	}
+	entNames := func(ents []DirEnt) []string {
+		names := []string{}
+		for _, ent := range ents {
+			names = append(names, ent.Name)
+		}
+		return names
+	}
+
+	c := &DirCookies{}
+	ents := c.Readdir(dir, parent, listing("a", "b", "c"), 0, 1024)
+	if !reflect.DeepEqual(entNames(ents), []string{".", "..", "a", "b", "c"}) {
+		t.Fatalf("unexpected listing %v", entNames(ents))
+	}
+	if ents[0].Qid != dir || ents[1].Qid != parent || ents[0].Typ != L_DT_DIR {
+		t.Fatalf("unexpected dot entries %v", ents[:2])
+	}
+	for i := 1; i < len(ents); i++ {
+		if ents[i].Offset <= ents[i-1].Offset {
+			t.Fatalf("offsets do not increase %v", ents)
+		}
+	}
+	bOffset := ents[3].Offset
+
+	// Removing an entry already returned and adding one
+	// before it must not skip or repeat anything.
+	ents = c.Readdir(dir, parent, listing("0", "b", "c"), bOffset, 1024)
+	if !reflect.DeepEqual(entNames(ents), []string{"c", "0"}) {
+		t.Fatalf("unexpected listing %v", entNames(ents))
+	}
+
+	// A removed entry that returns is new.
+	ents = c.Readdir(dir, parent, listing("a", "b"), bOffset, 1024)
+	if !reflect.DeepEqual(entNames(ents), []string{"a"}) {
+		t.Fatalf("unexpected listing %v", entNames(ents))
+	}
+
+	// Entries are packed to the byte count.
+	ents = c.Readdir(dir, parent, listing("a", "b"), 0, 0)
+	if len(ents) != 0 {
+		t.Fatalf("unexpected listing %v", entNames(ents))
+	}
+	all := c.Readdir(dir, parent, listing("a", "b"), 0, 1024)
+	count := uint32(all[0].EncodedSize() + all[1].EncodedSize())
+	ents = c.Readdir(dir, parent, listing("a", "b"), 0, count)
+	if !reflect.DeepEqual(ents, all[:2]) {
+		t.Fatalf("unexpected listing %v", entNames(ents))
+	}
+}
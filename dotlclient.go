@@ -14,7 +14,7 @@ type ClientDotLFile struct {
 }
 
 func AttachDotL(c *Client, aname string, uname string) (*ClientDotLFile, Qid, error) {
-	if c.Version() != "9P2000.L" {
+	if base, _ := SplitVersion(c.Version()); base != "9P2000.L" {
 		return nil, Qid{}, fmt.Errorf("cannot attach to mount, protocol version %q", c.Version())
 	}
 	fid, err := c.AcquireFid()
@@ -493,3 +493,193 @@ func (f *ClientDotLFile) Lock(l LSetLock) (byte, error) {
 		return L_LOCK_ERROR, errors.New("protocol error, expected Rlock")
 	}
 }
+
+func (f *ClientDotLFile) GetLock(l LGetLock) (LGetLock, error) {
+	fc, err := f.Client.Fcall(&Tgetlock{
+		Fid:      f.Fid,
+		LGetLock: l,
+	})
+	if err != nil {
+		return LGetLock{}, err
+	}
+	switch fc := fc.(type) {
+	case *Rgetlock:
+		return fc.LGetLock, nil
+	case *Rlerror:
+		return LGetLock{}, fc
+	default:
+		return LGetLock{}, errors.New("protocol error, expected Rgetlock")
+	}
+}
+
+func (f *ClientDotLFile) Symlink(name string, target string, gid uint32) (Qid, error) {
+	fc, err := f.Client.Fcall(&Tsymlink{
+		Fid:    f.Fid,
+		Name:   name,
+		Target: target,
+		Gid:    gid,
+	})
+	if err != nil {
+		return Qid{}, err
+	}
+	switch fc := fc.(type) {
+	case *Rsymlink:
+		return fc.Qid, nil
+	case *Rlerror:
+		return Qid{}, fc
+	default:
+		return Qid{}, errors.New("protocol error, expected Rsymlink")
+	}
+}
+
+func (f *ClientDotLFile) Readlink() (string, error) {
+	fc, err := f.Client.Fcall(&Treadlink{
+		Fid: f.Fid,
+	})
+	if err != nil {
+		return "", err
+	}
+	switch fc := fc.(type) {
+	case *Rreadlink:
+		return fc.Target, nil
+	case *Rlerror:
+		return "", fc
+	default:
+		return "", errors.New("protocol error, expected Rreadlink")
+	}
+}
+
+func (f *ClientDotLFile) Mknod(name string, mode uint32, major uint32, minor uint32, gid uint32) (Qid, error) {
+	fc, err := f.Client.Fcall(&Tmknod{
+		Fid:   f.Fid,
+		Name:  name,
+		Mode:  mode,
+		Major: major,
+		Minor: minor,
+		Gid:   gid,
+	})
+	if err != nil {
+		return Qid{}, err
+	}
+	switch fc := fc.(type) {
+	case *Rmknod:
+		return fc.Qid, nil
+	case *Rlerror:
+		return Qid{}, fc
+	default:
+		return Qid{}, errors.New("protocol error, expected Rmknod")
+	}
+}
+
+// Link creates name in the directory f as a hard link to file.
+func (f *ClientDotLFile) Link(name string, file *ClientDotLFile) error {
+	fc, err := f.Client.Fcall(&Tlink{
+		Dfid: f.Fid,
+		Fid:  file.Fid,
+		Name: name,
+	})
+	if err != nil {
+		return err
+	}
+	switch fc := fc.(type) {
+	case *Rlink:
+		return nil
+	case *Rlerror:
+		return fc
+	default:
+		return errors.New("protocol error, expected Rlink")
+	}
+}
+
+func (f *ClientDotLFile) Renameat(oldName string, newDir *ClientDotLFile, newName string) error {
+	fc, err := f.Client.Fcall(&Trenameat{
+		OldDfid: f.Fid,
+		OldName: oldName,
+		NewDfid: newDir.Fid,
+		NewName: newName,
+	})
+	if err != nil {
+		return err
+	}
+	switch fc := fc.(type) {
+	case *Rrenameat:
+		return nil
+	case *Rlerror:
+		return fc
+	default:
+		return errors.New("protocol error, expected Rrenameat")
+	}
+}
+
+func (f *ClientDotLFile) Unlinkat(name string, flags uint32) error {
+	fc, err := f.Client.Fcall(&Tunlinkat{
+		Dfid:  f.Fid,
+		Name:  name,
+		Flags: flags,
+	})
+	if err != nil {
+		return err
+	}
+	switch fc := fc.(type) {
+	case *Runlinkat:
+		return nil
+	case *Rlerror:
+		return fc
+	default:
+		return errors.New("protocol error, expected Runlinkat")
+	}
+}
+
+// XattrWalk returns a new file from which the named extended
+// attribute can be read, and the size of the attribute. An empty
+// name lists the attribute names.
+func (f *ClientDotLFile) XattrWalk(name string) (*ClientDotLFile, uint64, error) {
+	fid, err := f.Client.AcquireFid()
+	if err != nil {
+		return nil, 0, err
+	}
+	fc, err := f.Client.Fcall(&Txattrwalk{
+		Fid:    f.Fid,
+		Newfid: fid,
+		Name:   name,
+	})
+	if err != nil {
+		f.Client.ReleaseFid(fid)
+		return nil, 0, err
+	}
+	switch fc := fc.(type) {
+	case *Rxattrwalk:
+		return &ClientDotLFile{
+			Client: f.Client,
+			Fid:    fid,
+		}, fc.Size, nil
+	case *Rlerror:
+		f.Client.ReleaseFid(fid)
+		return nil, 0, fc
+	default:
+		f.Client.ReleaseFid(fid)
+		return nil, 0, errors.New("protocol error, expected Rxattrwalk")
+	}
+}
+
+// XattrCreate prepares f to receive the value of the named extended
+// attribute via Write, the attribute is set when f is clunked.
+func (f *ClientDotLFile) XattrCreate(name string, size uint64, flags uint32) error {
+	fc, err := f.Client.Fcall(&Txattrcreate{
+		Fid:      f.Fid,
+		Name:     name,
+		AttrSize: size,
+		Flags:    flags,
+	})
+	if err != nil {
+		return err
+	}
+	switch fc := fc.(type) {
+	case *Rxattrcreate:
+		return nil
+	case *Rlerror:
+		return fc
+	default:
+		return errors.New("protocol error, expected Rxattrcreate")
+	}
+}
@@ -1,3 +1,6 @@
+//go:build linux
+// +build linux
+
 package proto9
 
 import (
@@ -11,7 +14,9 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -152,20 +157,250 @@ func NewDiodTestServer(t *testing.T) *DiodTestServer {
 	}
 }
 
-func NewTestDotLClient(t *testing.T) (*Client, *DiodTestServer) {
-	server := NewDiodTestServer(t)
-	client, err := NewClient(server.Dial(), "9P2000.L", 4096)
+// DotLTestServer is a server under test exporting Tree.
+type DotLTestServer struct {
+	Aname string
+	Uname string
+	Tree  TestTree
+	Dial  func() net.Conn
+}
+
+// TestTree gives tests access to the exported tree without going
+// through the client under test. Paths are relative to the export.
+type TestTree interface {
+	MkdirAll(path string) error
+	WriteFile(path string, data []byte) error
+	ReadFile(path string) ([]byte, error)
+	// Lstat returns the mode of path in the L_S_IF* format.
+	Lstat(path string) (uint32, error)
+}
+
+// HostTestTree is an exported host directory.
+type HostTestTree string
+
+func (d HostTestTree) MkdirAll(path string) error {
+	return os.MkdirAll(filepath.Join(string(d), path), 0o777)
+}
+
+func (d HostTestTree) WriteFile(path string, data []byte) error {
+	return os.WriteFile(filepath.Join(string(d), path), data, 0o777)
+}
+
+func (d HostTestTree) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), path))
+}
+
+func (d HostTestTree) Lstat(path string) (uint32, error) {
+	var st syscall.Stat_t
+	err := syscall.Lstat(filepath.Join(string(d), path), &st)
+	return uint32(st.Mode), err
+}
+
+// RamTestTree is a RamFS accessed through its own connection.
+type RamTestTree struct {
+	root *ClientDotLFile
+}
+
+func (r *RamTestTree) walk(path string) (*ClientDotLFile, error) {
+	names := []string{}
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	f, _, err := r.root.Walk(names)
+	return f, err
+}
+
+func (r *RamTestTree) MkdirAll(path string) error {
+	dir := ""
+	for _, name := range strings.Split(path, "/") {
+		f, err := r.walk(dir)
+		if err != nil {
+			return err
+		}
+		_, err = f.Mkdir(name, 0o777, 0)
+		_ = f.Clunk()
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		dir += "/" + name
+	}
+	return nil
+}
+
+func (r *RamTestTree) WriteFile(path string, data []byte) error {
+	f, err := r.walk(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer f.Clunk()
+	_, _, err = f.Create(filepath.Base(path), L_O_WRONLY, 0o777, 0)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(data); {
+		n, err := f.Write(uint64(off), data[off:])
+		if err != nil {
+			return err
+		}
+		off += int(n)
+	}
+	return nil
+}
+
+func (r *RamTestTree) ReadFile(path string) ([]byte, error) {
+	f, err := r.walk(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Clunk()
+	err = f.Open(L_O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(uint64(len(data)), buf)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return data, nil
+		}
+		data = append(data, buf[:n]...)
+	}
+}
+
+func (r *RamTestTree) Lstat(path string) (uint32, error) {
+	f, err := r.walk(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Clunk()
+	attr, err := f.GetAttr(L_GETATTR_MODE)
+	return attr.Mode, err
+}
+
+// Serve a new filesystem from newFs for each connection in process,
+// the server is shut down when the test finishes.
+func serveTestDotL(t *testing.T, newFs func() Filesystem) func() net.Conn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ServeConn(c, newFs())
+			}()
+		}
+	}()
+
 	t.Cleanup(func() {
-		_ = client.Close()
+		_ = l.Close()
+		wg.Wait()
 	})
-	return client, server
+	return func() net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Connections are closed before the server is waited for.
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
+
+// Create an in process passthrough server that is automatically
+// cleaned up when the test finishes.
+func NewPassthroughTestServer(t *testing.T) *DotLTestServer {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	return &DotLTestServer{
+		Aname: "",
+		Uname: currentUser.Username,
+		Tree:  HostTestTree(dir),
+		Dial: serveTestDotL(t, func() Filesystem {
+			return NewPassthroughFilesystem(dir)
+		}),
+	}
+}
+
+// Create an in process ramfs server that is automatically
+// cleaned up when the test finishes.
+func NewRamFSTestServer(t *testing.T) *DotLTestServer {
+	ramfs := NewRamFS()
+	return &DotLTestServer{
+		Aname: "",
+		Uname: "",
+		Tree:  &RamTestTree{root: attachRamFS(t, ramfs)},
+		Dial:  serveTestDotL(t, ramfs.NewFilesystem),
+	}
+}
+
+// Create a test server exporting the host, diod is used instead
+// of the passthrough server if PROTO9_TEST_DIOD is set.
+func NewTestDotLServer(t *testing.T) *DotLTestServer {
+	if os.Getenv("PROTO9_TEST_DIOD") == "" {
+		return NewPassthroughTestServer(t)
+	}
+	diod := NewDiodTestServer(t)
+	return &DotLTestServer{
+		Aname: diod.Aname,
+		Uname: diod.Uname,
+		Tree:  HostTestTree(diod.ServeDir),
+		Dial:  diod.Dial,
+	}
+}
+
+// testDotLServers are the servers the client tests run against.
+var testDotLServers = []struct {
+	name string
+	new  func(t *testing.T) *DotLTestServer
+}{
+	{"host", NewTestDotLServer},
+	{"ramfs", NewRamFSTestServer},
+}
+
+// Run test as a subtest against each of testDotLServers.
+func forEachDotLServer(t *testing.T, test func(t *testing.T, client *Client, server *DotLTestServer)) {
+	for _, s := range testDotLServers {
+		newServer := s.new
+		t.Run(s.name, func(t *testing.T) {
+			server := newServer(t)
+			client, err := NewClient(server.Dial(), "9P2000.L", 4096)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = client.Close()
+			})
+			test(t, client, server)
+		})
+	}
 }
 
 func TestClientConnect(t *testing.T) {
-	client, _ := NewTestDotLClient(t)
+	forEachDotLServer(t, testClientConnect)
+}
+
+func testClientConnect(t *testing.T, client *Client, server *DotLTestServer) {
 	err := client.Close()
 	if err != nil {
 		t.Fatal(err)
@@ -173,7 +408,10 @@ func TestClientConnect(t *testing.T) {
 }
 
 func TestDotLAttach(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLAttach)
+}
+
+func testDotLAttach(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -182,7 +420,10 @@ func TestDotLAttach(t *testing.T) {
 }
 
 func TestDotLEmptyWalk(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLEmptyWalk)
+}
+
+func testDotLEmptyWalk(t *testing.T, client *Client, server *DotLTestServer) {
 	f1, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -205,9 +446,11 @@ func TestDotLEmptyWalk(t *testing.T) {
 }
 
 func TestDotLWalkOne(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLWalkOne)
+}
 
-	err := os.MkdirAll(server.ServeDir+"/1/2/3", 0o777)
+func testDotLWalkOne(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.MkdirAll("1/2/3")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -229,9 +472,11 @@ func TestDotLWalkOne(t *testing.T) {
 }
 
 func TestDotLWalkMulti(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLWalkMulti)
+}
 
-	err := os.MkdirAll(server.ServeDir+"/1/2/3/4/5/6/7/8/9/10/11/12/13/14", 0o777)
+func testDotLWalkMulti(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.MkdirAll("1/2/3/4/5/6/7/8/9/10/11/12/13/14")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -262,9 +507,11 @@ func TestDotLWalkMulti(t *testing.T) {
 }
 
 func TestDotLShortWalk(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLShortWalk)
+}
 
-	err := os.MkdirAll(server.ServeDir+"/1/2/3/4", 0o777)
+func testDotLShortWalk(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.MkdirAll("1/2/3/4")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -289,9 +536,11 @@ func TestDotLShortWalk(t *testing.T) {
 }
 
 func TestDotLRemove(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLRemove)
+}
 
-	err := os.Mkdir(server.ServeDir+"/x", 0o777)
+func testDotLRemove(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.MkdirAll("x")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -310,15 +559,17 @@ func TestDotLRemove(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = os.Stat(server.ServeDir + "/x")
+	_, err = server.Tree.Lstat("x")
 	if !errors.Is(err, fs.ErrNotExist) {
 		t.Fatal(err)
 	}
 }
 
 func TestDotLRead(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLRead)
+}
 
+func testDotLRead(t *testing.T, client *Client, server *DotLTestServer) {
 	expected, err := io.ReadAll(
 		&io.LimitedReader{R: rand.Reader, N: int64(2 * client.Msize())},
 	)
@@ -326,7 +577,7 @@ func TestDotLRead(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = os.WriteFile(server.ServeDir+"/x", expected, 0o777)
+	err = server.Tree.WriteFile("x", expected)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -363,9 +614,11 @@ func TestDotLRead(t *testing.T) {
 }
 
 func TestDotLWrite(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLWrite)
+}
 
-	err := os.WriteFile(server.ServeDir+"/x", []byte("hello"), 0o777)
+func testDotLWrite(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.WriteFile("x", []byte("hello"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -402,7 +655,7 @@ func TestDotLWrite(t *testing.T) {
 		t.Fatalf("unexpected write count %d", n)
 	}
 
-	buf, err := os.ReadFile(server.ServeDir + "/x")
+	buf, err := server.Tree.ReadFile("x")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -413,8 +666,10 @@ func TestDotLWrite(t *testing.T) {
 }
 
 func TestDotLCreate(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLCreate)
+}
 
+func testDotLCreate(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -424,15 +679,17 @@ func TestDotLCreate(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = os.Stat(server.ServeDir + "/x")
+	_, err = server.Tree.Lstat("x")
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestDotLGetAttr(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLGetAttr)
+}
 
+func testDotLGetAttr(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -446,8 +703,10 @@ func TestDotLGetAttr(t *testing.T) {
 }
 
 func TestDotLSetAttr(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLSetAttr)
+}
 
+func testDotLSetAttr(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -464,8 +723,10 @@ func TestDotLSetAttr(t *testing.T) {
 }
 
 func TestDotLRename(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLRename)
+}
 
+func testDotLRename(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -500,15 +761,17 @@ func TestDotLRename(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = os.Stat(server.ServeDir + "/y")
+	_, err = server.Tree.Lstat("y")
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestDotLMkdir(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLMkdir)
+}
 
+func testDotLMkdir(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -520,15 +783,67 @@ func TestDotLMkdir(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = os.Stat(server.ServeDir + "/x")
+	_, err = server.Tree.Lstat("x")
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
+func TestDotLCreateMode(t *testing.T) {
+	// The server must not apply its own umask.
+	old := syscall.Umask(0o022)
+	defer syscall.Umask(old)
+	forEachDotLServer(t, testDotLCreateMode)
+}
+
+func testDotLCreateMode(t *testing.T, client *Client, server *DotLTestServer) {
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	_, err = f.Mkdir("d", 0o777, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Mknod("p", L_S_IFIFO|0o666, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, _, err := f.Walk(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Clunk()
+	_, _, err = cf.Create("f", L_O_RDWR, 0o666, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		mode uint32
+	}{
+		{"d", L_S_IFDIR | 0o777},
+		{"p", L_S_IFIFO | 0o666},
+		{"f", L_S_IFREG | 0o666},
+	} {
+		mode, err := server.Tree.Lstat(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode != c.mode {
+			t.Fatalf("%s has mode %o, expected %o", c.name, mode, c.mode)
+		}
+	}
+}
+
 func TestDotLStatfs(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLStatfs)
+}
 
+func testDotLStatfs(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -542,9 +857,10 @@ func TestDotLStatfs(t *testing.T) {
 }
 
 func TestDotLReaddirAll(t *testing.T) {
+	forEachDotLServer(t, testDotLReaddirAll)
+}
 
-	client, server := NewTestDotLClient(t)
-
+func testDotLReaddirAll(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -555,7 +871,7 @@ func TestDotLReaddirAll(t *testing.T) {
 
 	// Create a large directory.
 	for i := 0; i < nEnts; i++ {
-		err := os.Mkdir(fmt.Sprintf("%s/XXXXXXXX%d", server.ServeDir, i), 0o777)
+		err := server.Tree.MkdirAll(fmt.Sprintf("XXXXXXXX%d", i))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -577,9 +893,10 @@ func TestDotLReaddirAll(t *testing.T) {
 }
 
 func TestDotLDirIter(t *testing.T) {
+	forEachDotLServer(t, testDotLDirIter)
+}
 
-	client, server := NewTestDotLClient(t)
-
+func testDotLDirIter(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
@@ -590,7 +907,7 @@ func TestDotLDirIter(t *testing.T) {
 
 	// Create a large directory.
 	for i := 0; i < nEnts; i++ {
-		err := os.Mkdir(fmt.Sprintf("%s/XXXXXXXX%d", server.ServeDir, i), 0o777)
+		err := server.Tree.MkdirAll(fmt.Sprintf("XXXXXXXX%d", i))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -627,15 +944,17 @@ func TestDotLDirIter(t *testing.T) {
 }
 
 func TestDotLLock(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testDotLLock)
+}
 
+func testDotLLock(t *testing.T, client *Client, server *DotLTestServer) {
 	f, _, err := AttachDotL(client, server.Aname, server.Uname)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Clunk()
 
-	err = os.WriteFile(server.ServeDir+"/x", []byte{}, 0o777)
+	err = server.Tree.WriteFile("x", []byte{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -670,11 +989,13 @@ func TestDotLLock(t *testing.T) {
 }
 
 func TestParallelRequests(t *testing.T) {
-	client, server := NewTestDotLClient(t)
+	forEachDotLServer(t, testParallelRequests)
+}
 
+func testParallelRequests(t *testing.T, client *Client, server *DotLTestServer) {
 	expected := []byte("hello")
 
-	err := os.WriteFile(server.ServeDir+"/x", expected, 0o777)
+	err := server.Tree.WriteFile("x", expected)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -694,23 +1015,26 @@ func TestParallelRequests(t *testing.T) {
 
 			wf, _, err := f.Walk([]string{"x"})
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			defer wf.Clunk()
 
 			err = wf.Open(L_O_RDONLY)
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 
 			buf := make([]byte, len(expected), len(expected))
 			n, err := wf.Read(0, buf)
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 
 			if !reflect.DeepEqual(buf[:n], expected) {
-				t.Fatalf("%v\n!=\n%v", buf[:n], expected)
+				t.Errorf("%v\n!=\n%v", buf[:n], expected)
 			}
 
 		}()
@@ -718,3 +1042,289 @@ func TestParallelRequests(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestDotLSymlink(t *testing.T) {
+	forEachDotLServer(t, testDotLSymlink)
+}
+
+func testDotLSymlink(t *testing.T, client *Client, server *DotLTestServer) {
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	qid, err := f.Symlink("x", "target", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qid.Typ != QT_SYMLINK {
+		t.Fatalf("unexpected qid %s", qid.String())
+	}
+
+	lf, _, err := f.Walk([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Clunk()
+	target, err := lf.Readlink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "target" {
+		t.Fatalf("unexpected link target %q", target)
+	}
+}
+
+func TestDotLLink(t *testing.T) {
+	forEachDotLServer(t, testDotLLink)
+}
+
+func testDotLLink(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.WriteFile("x", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	xf, _, err := f.Walk([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xf.Clunk()
+
+	err = f.Link("y", xf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := server.Tree.ReadFile("y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("unexpected contents %q", buf)
+	}
+}
+
+func TestDotLMknod(t *testing.T) {
+	forEachDotLServer(t, testDotLMknod)
+}
+
+func testDotLMknod(t *testing.T, client *Client, server *DotLTestServer) {
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	_, err = f.Mknod("fifo", syscall.S_IFIFO|0o644, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, err := server.Tree.Lstat("fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode&L_S_IFMT != L_S_IFIFO {
+		t.Fatalf("unexpected mode %o", mode)
+	}
+}
+
+func TestDotLRenameatUnlinkat(t *testing.T) {
+	forEachDotLServer(t, testDotLRenameatUnlinkat)
+}
+
+func testDotLRenameatUnlinkat(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.MkdirAll("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Tree.WriteFile("x", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	df, _, err := f.Walk([]string{"d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Clunk()
+
+	err = f.Renameat("x", df, "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.Tree.Lstat("d/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = df.Unlinkat("y", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Unlinkat("d", L_AT_REMOVEDIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.Tree.Lstat("d")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+}
+
+func TestDotLXattr(t *testing.T) {
+	forEachDotLServer(t, testDotLXattr)
+}
+
+func testDotLXattr(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.WriteFile("x", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	value := []byte("value")
+
+	wf, _, err := f.Walk([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wf.XattrCreate("user.test", uint64(len(value)), 0)
+	if err != nil {
+		_ = wf.Clunk()
+		var rlerror *Rlerror
+		if errors.As(err, &rlerror) && rlerror.Ecode == EOPNOTSUPP {
+			t.Skip("extended attributes not supported")
+		}
+		t.Fatal(err)
+	}
+	_, err = wf.Write(0, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wf.Clunk()
+	if err != nil {
+		var rlerror *Rlerror
+		if errors.As(err, &rlerror) && rlerror.Ecode == EOPNOTSUPP {
+			t.Skip("extended attributes not supported")
+		}
+		t.Fatal(err)
+	}
+
+	rf, _, err := f.Walk([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Clunk()
+	xf, size, err := rf.XattrWalk("user.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xf.Clunk()
+	if size != uint64(len(value)) {
+		t.Fatalf("unexpected size %d", size)
+	}
+	buf := make([]byte, size)
+	n, err := xf.Read(0, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buf[:n], value) {
+		t.Fatalf("unexpected value %q", buf[:n])
+	}
+}
+
+func TestDotLGetLock(t *testing.T) {
+	forEachDotLServer(t, testDotLGetLock)
+}
+
+func testDotLGetLock(t *testing.T, client *Client, server *DotLTestServer) {
+	err := server.Tree.WriteFile("x", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	openLockFile := func() *ClientDotLFile {
+		lf, _, err := f.Walk([]string{"x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { lf.Clunk() })
+		err = lf.Open(L_O_RDWR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lf
+	}
+
+	lf1 := openLockFile()
+	lf2 := openLockFile()
+
+	status, err := lf1.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, Start: 0, Length: 10, ProcId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != L_LOCK_SUCCESS {
+		t.Fatal("expected lock success")
+	}
+
+	status, err = lf2.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, Start: 5, Length: 10, ProcId: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != L_LOCK_BLOCKED {
+		t.Fatal("expected conflicting lock to block")
+	}
+
+	l, err := lf2.GetLock(LGetLock{Typ: L_LOCK_TYPE_WRLCK, Start: 5, Length: 10, ProcId: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Typ != L_LOCK_TYPE_WRLCK || l.Start != 0 || l.Length != 10 {
+		t.Fatalf("unexpected conflicting lock %#v", l)
+	}
+}
+
+func TestDotLWalkAboveRoot(t *testing.T) {
+	forEachDotLServer(t, testDotLWalkAboveRoot)
+}
+
+func testDotLWalkAboveRoot(t *testing.T, client *Client, server *DotLTestServer) {
+	f, rootQid, err := AttachDotL(client, server.Aname, server.Uname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	wf, qids, err := f.Walk([]string{"..", ".."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wf.Clunk()
+	if qids[1] != rootQid {
+		t.Fatalf("walked above the root: %s", qids[1].String())
+	}
+}
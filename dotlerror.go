@@ -14,7 +14,8 @@ func (e *Rlerror) Error() string {
 	return fmt.Sprintf("Error: errno(%d)", e.Ecode)
 }
 
-// numbers defined on Linux/amd64.
+// 9P2000.L error numbers, the generic Linux numbers. Host errnos are
+// translated with SysErrnoToDotL and DotLToSysErrno.
 const (
 	E2BIG           = 0x7
 	EACCES          = 0xd
@@ -0,0 +1,743 @@
+package proto9
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DotLFile is a file referenced by a fid of a DotLFilesystem.
+//
+// Other requests are supported by implementing the optional
+// interfaces below, requests on files that do not implement
+// them fail with ENOSYS.
+//
+// Errors returned from these methods are sent to the client as an
+// Rlerror, see ErrorToRlerror for how the error number is chosen.
+type DotLFile interface {
+	// Walk walks each name in turn, returning a qid for each element
+	// walked and the file at the end of the walk. An empty walk
+	// must return a new reference to the same file.
+	//
+	// If only a prefix of names can be walked, return the qids for
+	// that prefix, the error is only reported if no names were walked.
+	Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error)
+	GetAttr(ctx context.Context, mask uint64) (LAttr, error)
+	Clunk() error
+}
+
+type Opener interface {
+	Open(ctx context.Context, flags uint32) (Qid, uint32, error)
+}
+
+type Reader interface {
+	Read(ctx context.Context, offset uint64, buf []byte) (uint32, error)
+}
+
+type Writer interface {
+	Write(ctx context.Context, offset uint64, buf []byte) (uint32, error)
+}
+
+type Creator interface {
+	// Create creates and opens name within this directory,
+	// the returned file replaces the directory on the fid.
+	Create(ctx context.Context, name string, flags uint32, mode uint32, gid uint32) (DotLFile, Qid, uint32, error)
+}
+
+type Mkdirer interface {
+	Mkdir(ctx context.Context, name string, mode uint32, gid uint32) (Qid, error)
+}
+
+type Readdirer interface {
+	Readdir(ctx context.Context, offset uint64, count uint32) ([]DirEnt, error)
+}
+
+type SetAttrer interface {
+	SetAttr(ctx context.Context, attr LSetAttr) error
+}
+
+type Symlinker interface {
+	Symlink(ctx context.Context, name string, target string, gid uint32) (Qid, error)
+}
+
+type Readlinker interface {
+	Readlink(ctx context.Context) (string, error)
+}
+
+type Mknoder interface {
+	Mknod(ctx context.Context, name string, mode uint32, major uint32, minor uint32, gid uint32) (Qid, error)
+}
+
+type Linker interface {
+	// Link creates name in this directory as a hard link to file.
+	Link(ctx context.Context, name string, file DotLFile) error
+}
+
+type Renamer interface {
+	Rename(ctx context.Context, dir DotLFile, name string) error
+}
+
+type Renameater interface {
+	Renameat(ctx context.Context, oldName string, newDir DotLFile, newName string) error
+}
+
+type Unlinker interface {
+	Unlinkat(ctx context.Context, name string, flags uint32) error
+}
+
+type Xattrer interface {
+	// XattrWalk returns a file for reading the named extended
+	// attribute, or the attribute list if name is empty.
+	XattrWalk(ctx context.Context, name string) (DotLFile, uint64, error)
+	// XattrCreate prepares this file to receive the attribute
+	// value via Write, it is set when the file is clunked.
+	XattrCreate(ctx context.Context, name string, size uint64, flags uint32) error
+}
+
+type Locker interface {
+	Lock(ctx context.Context, lock LSetLock) (byte, error)
+	GetLock(ctx context.Context, lock LGetLock) (LGetLock, error)
+}
+
+type Fsyncer interface {
+	Fsync(ctx context.Context) error
+}
+
+type Statfser interface {
+	Statfs(ctx context.Context) (LStatfs, error)
+}
+
+type Remover interface {
+	// Remove removes the file and releases it as Clunk does,
+	// even when the removal fails.
+	Remove(ctx context.Context) error
+}
+
+type DotLFilesystem struct {
+	Msize uint32
+
+	// Attach returns the root file for a new fid.
+	Attach func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error)
+
+	// Extensions lists the registered extensions this filesystem
+	// accepts as version suffixes, e.g. "ourext" for "9P2000.L.ourext".
+	Extensions []string
+	// ExtensionFcall handles the messages of negotiated extensions.
+	ExtensionFcall func(context.Context, Fcall) Fcall
+
+	// If non zero, clients are limited to MaxFids fids, further
+	// attaches and walks to new fids fail with EMFILE.
+	MaxFids int
+
+	// If set, the user of each Tattach is looked up in Users and the
+	// credential is carried by the fid and the fids walked from it,
+	// requests see it via CredentialFromContext.
+	Users UserDB
+	// If set, the mode bits of files are checked against credentials
+	// on walk, open, create, removal, setattr and xattr creation, for
+	// files that do not enforce permissions themselves. The sticky
+	// bit is honoured, and Tremove and the source directory of Trename
+	// are left to the file, see CheckUnlink. Requires Users.
+	CheckPermissions bool
+	// If set, requests are handled inside RunAs, which assumes the
+	// identity of cred while calling f. Requires Users.
+	RunAs func(cred *Credential, f func()) error
+
+	// Until LockGraceEnd, only locks reclaimed by clients with
+	// L_LOCK_FLAGS_RECLAIM are passed to the file, other lock
+	// requests fail with L_LOCK_GRACE. Set it to the same time for
+	// every connection after a server restart.
+	LockGraceEnd time.Time
+
+	// The negotiated msize.
+	msize uint32
+
+	filesLock sync.RWMutex
+	files     map[uint32]DotLFile
+	creds     map[uint32]*Credential
+}
+
+func (fs *DotLFilesystem) getFile(fid uint32) (DotLFile, bool) {
+	fs.filesLock.RLock()
+	defer fs.filesLock.RUnlock()
+	f, ok := fs.files[fid]
+	return f, ok
+}
+
+// checkNewFid reports why fid cannot be added, if it can't.
+func (fs *DotLFilesystem) checkNewFid(fid uint32) *Rlerror {
+	fs.filesLock.RLock()
+	defer fs.filesLock.RUnlock()
+	return fs.checkNewFidLocked(fid)
+}
+
+func (fs *DotLFilesystem) checkNewFidLocked(fid uint32) *Rlerror {
+	if _, inUse := fs.files[fid]; inUse {
+		return &Rlerror{Ecode: EEXIST}
+	}
+	if fs.MaxFids > 0 && len(fs.files) >= fs.MaxFids {
+		return &Rlerror{Ecode: EMFILE}
+	}
+	return nil
+}
+
+// addFile sets fid to f, clunking f if the fid cannot be added.
+func (fs *DotLFilesystem) addFile(fid uint32, f DotLFile) *Rlerror {
+	fs.filesLock.Lock()
+	rlerror := fs.checkNewFidLocked(fid)
+	if rlerror == nil {
+		if fs.files == nil {
+			fs.files = make(map[uint32]DotLFile)
+		}
+		fs.files[fid] = f
+	}
+	fs.filesLock.Unlock()
+	if rlerror != nil {
+		_ = f.Clunk()
+	}
+	return rlerror
+}
+
+// replaceFile points fid at f and clunks the file it replaced.
+func (fs *DotLFilesystem) replaceFile(fid uint32, f DotLFile) {
+	fs.filesLock.Lock()
+	old, ok := fs.files[fid]
+	fs.files[fid] = f
+	fs.filesLock.Unlock()
+	if ok && old != f {
+		_ = old.Clunk()
+	}
+}
+
+func (fs *DotLFilesystem) removeFile(fid uint32) (DotLFile, bool) {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+	f, ok := fs.files[fid]
+	delete(fs.files, fid)
+	delete(fs.creds, fid)
+	return f, ok
+}
+
+func (fs *DotLFilesystem) getCredential(fid uint32) (*Credential, bool) {
+	fs.filesLock.RLock()
+	defer fs.filesLock.RUnlock()
+	cred, ok := fs.creds[fid]
+	return cred, ok
+}
+
+func (fs *DotLFilesystem) setCredential(fid uint32, cred *Credential) {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+	if fs.creds == nil {
+		fs.creds = make(map[uint32]*Credential)
+	}
+	fs.creds[fid] = cred
+}
+
+func (fs *DotLFilesystem) Fcall(ctx context.Context, fc Fcall) Fcall {
+	if fs.Users != nil {
+		if fid, ok := credentialFid(fc); ok {
+			if cred, ok := fs.getCredential(fid); ok {
+				ctx = WithCredential(ctx, cred)
+				if fs.RunAs != nil {
+					var resp Fcall
+					err := fs.RunAs(cred, func() { resp = fs.fcall(ctx, fc) })
+					if err != nil {
+						return ErrorToRlerror(err)
+					}
+					return resp
+				}
+			}
+		}
+	}
+	return fs.fcall(ctx, fc)
+}
+
+func (fs *DotLFilesystem) fcall(ctx context.Context, fc Fcall) Fcall {
+	if fs.Users != nil && fs.CheckPermissions {
+		if err := fs.checkPermissions(ctx, fc); err != nil {
+			return ErrorToRlerror(err)
+		}
+	}
+	switch fc := fc.(type) {
+	case *Tversion:
+		rVersion := &Rversion{
+			Tagged: fc.Tagged,
+		}
+		if fs.Msize < fc.Msize {
+			rVersion.Msize = fs.Msize
+		} else {
+			rVersion.Msize = fc.Msize
+		}
+		rVersion.Version = NegotiateVersion(fc.Version, []string{"9P2000.L"}, fs.supportedExtensions())
+		fs.msize = rVersion.Msize
+		return rVersion
+	case *Tflush:
+		return &Rflush{}
+	case *Tattach:
+		return fs.attach(ctx, fc)
+	case *Twalk:
+		return fs.walk(ctx, fc)
+	case *Tclunk:
+		f, ok := fs.removeFile(fc.Fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		err := f.Clunk()
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		return &Rclunk{}
+	case *Tremove:
+		f, ok := fs.removeFile(fc.Fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		var err error
+		if remover, ok := f.(Remover); ok {
+			err = remover.Remove(ctx)
+		} else {
+			_ = f.Clunk()
+			err = &Rlerror{Ecode: ENOSYS}
+		}
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		return &Rremove{}
+	case *Txattrwalk:
+		f, ok := fs.getFile(fc.Fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		if rlerror := fs.checkNewFid(fc.Newfid); rlerror != nil {
+			return rlerror
+		}
+		xattrer, ok := f.(Xattrer)
+		if !ok {
+			return &Rlerror{Ecode: ENOSYS}
+		}
+		xf, size, err := xattrer.XattrWalk(ctx, fc.Name)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		if rlerror := fs.addFile(fc.Newfid, xf); rlerror != nil {
+			return rlerror
+		}
+		if cred, ok := CredentialFromContext(ctx); ok {
+			fs.setCredential(fc.Newfid, cred)
+		}
+		return &Rxattrwalk{Size: size}
+	case *Tlink:
+		dir, ok := fs.getFile(fc.Dfid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		f, ok := fs.getFile(fc.Fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		linker, ok := dir.(Linker)
+		if !ok {
+			return &Rlerror{Ecode: ENOSYS}
+		}
+		err := linker.Link(ctx, fc.Name, f)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		return &Rlink{}
+	case *Trename:
+		f, ok := fs.getFile(fc.Fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		dir, ok := fs.getFile(fc.Dfid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		renamer, ok := f.(Renamer)
+		if !ok {
+			return &Rlerror{Ecode: ENOSYS}
+		}
+		err := renamer.Rename(ctx, dir, fc.Name)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		return &Rrename{}
+	case *Trenameat:
+		oldDir, ok := fs.getFile(fc.OldDfid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		newDir, ok := fs.getFile(fc.NewDfid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		renameater, ok := oldDir.(Renameater)
+		if !ok {
+			return &Rlerror{Ecode: ENOSYS}
+		}
+		err := renameater.Renameat(ctx, fc.OldName, newDir, fc.NewName)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		return &Rrenameat{}
+	case *Tmkdir:
+		f, ok := fs.getFile(fc.Dfid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		mkdirer, ok := f.(Mkdirer)
+		if !ok {
+			return &Rlerror{Ecode: ENOSYS}
+		}
+		qid, err := mkdirer.Mkdir(ctx, fc.Name, fc.Mode, fc.Gid)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		return &Rmkdir{Qid: qid}
+	case *Tlcreate:
+		f, ok := fs.getFile(fc.Fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		creator, ok := f.(Creator)
+		if !ok {
+			return &Rlerror{Ecode: ENOSYS}
+		}
+		newf, qid, iounit, err := creator.Create(ctx, fc.Name, fc.Flags, fc.Mode, fc.Gid)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		fs.replaceFile(fc.Fid, newf)
+		return &Rlcreate{Qid: qid, Iounit: iounit}
+	}
+
+	if fid, ok := fidOf(fc); ok {
+		f, ok := fs.getFile(fid)
+		if !ok {
+			return &Rlerror{Ecode: EBADF}
+		}
+		return fs.fileFcall(ctx, f, fc)
+	}
+
+	if _, err := FcallFromKind(fc.Kind()); err != nil && fs.ExtensionFcall != nil {
+		return fs.ExtensionFcall(ctx, fc)
+	}
+	return &Rlerror{Ecode: ENOSYS}
+}
+
+// credentialFid returns the fid whose credential a request is made with.
+func credentialFid(fc Fcall) (uint32, bool) {
+	switch fc := fc.(type) {
+	case *Twalk:
+		return fc.Fid, true
+	case *Tclunk:
+		return fc.Fid, true
+	case *Tremove:
+		return fc.Fid, true
+	case *Txattrwalk:
+		return fc.Fid, true
+	case *Tlink:
+		return fc.Dfid, true
+	case *Trename:
+		return fc.Fid, true
+	case *Trenameat:
+		return fc.OldDfid, true
+	case *Tmkdir:
+		return fc.Dfid, true
+	case *Tlcreate:
+		return fc.Fid, true
+	default:
+		return fidOf(fc)
+	}
+}
+
+// fidOf returns the fid of requests that act on a single file.
+func fidOf(fc Fcall) (uint32, bool) {
+	switch fc := fc.(type) {
+	case *Tlopen:
+		return fc.Fid, true
+	case *Tread:
+		return fc.Fid, true
+	case *Twrite:
+		return fc.Fid, true
+	case *Treaddir:
+		return fc.Fid, true
+	case *Tgetattr:
+		return fc.Fid, true
+	case *Tsetattr:
+		return fc.Fid, true
+	case *Tsymlink:
+		return fc.Fid, true
+	case *Tmknod:
+		return fc.Fid, true
+	case *Treadlink:
+		return fc.Fid, true
+	case *Tunlinkat:
+		return fc.Dfid, true
+	case *Txattrcreate:
+		return fc.Fid, true
+	case *Tlock:
+		return fc.Fid, true
+	case *Tgetlock:
+		return fc.Fid, true
+	case *Tfsync:
+		return fc.Fid, true
+	case *Tstatfs:
+		return fc.Fid, true
+	default:
+		return 0, false
+	}
+}
+
+func (fs *DotLFilesystem) fileFcall(ctx context.Context, f DotLFile, fc Fcall) Fcall {
+	var err error = &Rlerror{Ecode: ENOSYS}
+	switch fc := fc.(type) {
+	case *Tlopen:
+		if f, ok := f.(Opener); ok {
+			var qid Qid
+			var iounit uint32
+			qid, iounit, err = f.Open(ctx, fc.Flags)
+			if err == nil {
+				return &Rlopen{Qid: qid, Iounit: iounit}
+			}
+		}
+	case *Tread:
+		if f, ok := f.(Reader); ok {
+			count := fc.Count
+			if max := fs.msize - IOHDRSZ; count > max {
+				count = max
+			}
+			buf := make([]byte, count)
+			var n uint32
+			n, err = f.Read(ctx, fc.Offset, buf)
+			if err == nil {
+				return &Rread{Data: buf[:n]}
+			}
+		}
+	case *Twrite:
+		if f, ok := f.(Writer); ok {
+			var n uint32
+			n, err = f.Write(ctx, fc.Offset, fc.Data)
+			if err == nil {
+				return &Rwrite{Count: n}
+			}
+		}
+	case *Treaddir:
+		if f, ok := f.(Readdirer); ok {
+			count := fc.Count
+			if max := fs.msize - READDIRHDRSZ; count > max {
+				count = max
+			}
+			var ents []DirEnt
+			ents, err = f.Readdir(ctx, fc.Offset, count)
+			if err == nil {
+				// Never reply with more than was asked for.
+				return &Rreaddir{Data: PackDirEnts(ents, count)}
+			}
+		}
+	case *Tgetattr:
+		var attr LAttr
+		attr, err = f.GetAttr(ctx, fc.Mask)
+		if err == nil {
+			return &Rgetattr{LAttr: attr}
+		}
+	case *Tsetattr:
+		if f, ok := f.(SetAttrer); ok {
+			err = f.SetAttr(ctx, fc.LSetAttr)
+			if err == nil {
+				return &Rsetattr{}
+			}
+		}
+	case *Tsymlink:
+		if f, ok := f.(Symlinker); ok {
+			var qid Qid
+			qid, err = f.Symlink(ctx, fc.Name, fc.Target, fc.Gid)
+			if err == nil {
+				return &Rsymlink{Qid: qid}
+			}
+		}
+	case *Tmknod:
+		if f, ok := f.(Mknoder); ok {
+			var qid Qid
+			qid, err = f.Mknod(ctx, fc.Name, fc.Mode, fc.Major, fc.Minor, fc.Gid)
+			if err == nil {
+				return &Rmknod{Qid: qid}
+			}
+		}
+	case *Treadlink:
+		if f, ok := f.(Readlinker); ok {
+			var target string
+			target, err = f.Readlink(ctx)
+			if err == nil {
+				return &Rreadlink{Target: target}
+			}
+		}
+	case *Tunlinkat:
+		if f, ok := f.(Unlinker); ok {
+			err = f.Unlinkat(ctx, fc.Name, fc.Flags)
+			if err == nil {
+				return &Runlinkat{}
+			}
+		}
+	case *Txattrcreate:
+		if f, ok := f.(Xattrer); ok {
+			err = f.XattrCreate(ctx, fc.Name, fc.AttrSize, fc.Flags)
+			if err == nil {
+				return &Rxattrcreate{}
+			}
+		}
+	case *Tlock:
+		if f, ok := f.(Locker); ok {
+			if fc.Typ != L_LOCK_TYPE_UNLCK && fc.Flags&L_LOCK_FLAGS_RECLAIM == 0 && time.Now().Before(fs.LockGraceEnd) {
+				return &Rlock{Status: L_LOCK_GRACE}
+			}
+			var status byte
+			status, err = f.Lock(ctx, fc.LSetLock)
+			if err == nil {
+				return &Rlock{Status: status}
+			}
+		}
+	case *Tgetlock:
+		if f, ok := f.(Locker); ok {
+			var lock LGetLock
+			lock, err = f.GetLock(ctx, fc.LGetLock)
+			if err == nil {
+				return &Rgetlock{LGetLock: lock}
+			}
+		}
+	case *Tfsync:
+		if f, ok := f.(Fsyncer); ok {
+			err = f.Fsync(ctx)
+			if err == nil {
+				return &Rfsync{}
+			}
+		}
+	case *Tstatfs:
+		if f, ok := f.(Statfser); ok {
+			var statfs LStatfs
+			statfs, err = f.Statfs(ctx)
+			if err == nil {
+				return &Rstatfs{LStatfs: statfs}
+			}
+		}
+	}
+	return ErrorToRlerror(err)
+}
+
+func (fs *DotLFilesystem) attach(ctx context.Context, fc *Tattach) Fcall {
+	if fs.Attach == nil {
+		return &Rlerror{Ecode: ENOSYS}
+	}
+	if rlerror := fs.checkNewFid(fc.Fid); rlerror != nil {
+		return rlerror
+	}
+	var cred *Credential
+	if fs.Users != nil {
+		var err error
+		cred, err = fs.Users.Lookup(fc.Uname, fc.N_uname)
+		if err != nil {
+			return ErrorToRlerror(err)
+		}
+		ctx = WithCredential(ctx, cred)
+	}
+	var f DotLFile
+	var qid Qid
+	var err error
+	if cred != nil && fs.RunAs != nil {
+		runErr := fs.RunAs(cred, func() { f, qid, err = fs.Attach(ctx, fc) })
+		if runErr != nil {
+			return ErrorToRlerror(runErr)
+		}
+	} else {
+		f, qid, err = fs.Attach(ctx, fc)
+	}
+	if err != nil {
+		return ErrorToRlerror(err)
+	}
+	if rlerror := fs.addFile(fc.Fid, f); rlerror != nil {
+		return rlerror
+	}
+	if cred != nil {
+		fs.setCredential(fc.Fid, cred)
+	}
+	return &Rattach{Qid: qid}
+}
+
+func (fs *DotLFilesystem) walk(ctx context.Context, fc *Twalk) Fcall {
+	f, ok := fs.getFile(fc.Fid)
+	if !ok {
+		return &Rlerror{Ecode: EBADF}
+	}
+	if fc.NewFid != fc.Fid {
+		if rlerror := fs.checkNewFid(fc.NewFid); rlerror != nil {
+			return rlerror
+		}
+	}
+	var qids []Qid
+	var newf DotLFile
+	var err error
+	if fs.CheckPermissions && fs.Users != nil {
+		qids, newf, err = checkedWalk(ctx, f, fc.Wnames)
+	} else {
+		qids, newf, err = f.Walk(ctx, fc.Wnames)
+	}
+	if len(qids) != len(fc.Wnames) || err != nil {
+		if newf != nil {
+			_ = newf.Clunk()
+		}
+		if len(qids) == 0 && len(fc.Wnames) != 0 {
+			if err == nil {
+				err = &Rlerror{Ecode: ENOENT}
+			}
+			return ErrorToRlerror(err)
+		}
+		if len(qids) == len(fc.Wnames) {
+			return ErrorToRlerror(err)
+		}
+		// A partial walk leaves newfid unused.
+		return &Rwalk{WQids: qids}
+	}
+	if fc.NewFid == fc.Fid {
+		fs.replaceFile(fc.Fid, newf)
+	} else if rlerror := fs.addFile(fc.NewFid, newf); rlerror != nil {
+		return rlerror
+	} else if cred, ok := CredentialFromContext(ctx); ok {
+		fs.setCredential(fc.NewFid, cred)
+	}
+	return &Rwalk{WQids: qids}
+}
+
+// supportedExtensions returns the extensions that have messages registered.
+func (fs *DotLFilesystem) supportedExtensions() []string {
+	exts := []string{}
+	for _, ext := range fs.Extensions {
+		if IsRegisteredExtension(ext) {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+func (fs *DotLFilesystem) Clunk() error {
+	fs.filesLock.Lock()
+	files := fs.files
+	creds := fs.creds
+	fs.files = nil
+	fs.creds = nil
+	fs.filesLock.Unlock()
+
+	for fid, f := range files {
+		cred, ok := creds[fid]
+		if ok && fs.RunAs != nil {
+			// Clunks may commit writes, such as a pending xattr, so
+			// they must not run with the server's identity. If the
+			// identity cannot be assumed the file is leaked.
+			_ = fs.RunAs(cred, func() { _ = f.Clunk() })
+			continue
+		}
+		_ = f.Clunk()
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package proto9
 
 import (
 	"bytes"
+	"strings"
 )
 
 func (v *DirEnt) EncodedSize() uint64 {
@@ -250,6 +251,66 @@ func (v *LAttr) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *LGetLock) EncodedSize() uint64 {
+	sz := uint64(0)
+	sz += 1 // Typ
+	sz += 8 // Start
+	sz += 8 // Length
+	sz += 4 // ProcId
+	sz += 2 + uint64(len(v.ClientId))
+	return sz
+}
+
+func (v *LGetLock) Encode(b *bytes.Buffer) error {
+	var err error
+	err = encodeByte(b, v.Typ)
+	if err != nil {
+		return err
+	}
+	err = encodeUint64(b, v.Start)
+	if err != nil {
+		return err
+	}
+	err = encodeUint64(b, v.Length)
+	if err != nil {
+		return err
+	}
+	err = encodeUint32(b, v.ProcId)
+	if err != nil {
+		return err
+	}
+	err = encodeString(b, v.ClientId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *LGetLock) Decode(b *bytes.Buffer) error {
+	var err error
+	v.Typ, err = decodeByte(b)
+	if err != nil {
+		return err
+	}
+	v.Start, err = decodeUint64(b)
+	if err != nil {
+		return err
+	}
+	v.Length, err = decodeUint64(b)
+	if err != nil {
+		return err
+	}
+	v.ProcId, err = decodeUint32(b)
+	if err != nil {
+		return err
+	}
+	v.ClientId, err = decodeString(b)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *LSetAttr) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += 4 // Valid
@@ -346,6 +407,75 @@ func (v *LSetAttr) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *LSetLock) EncodedSize() uint64 {
+	sz := uint64(0)
+	sz += 1 // Typ
+	sz += 4 // Flags
+	sz += 8 // Start
+	sz += 8 // Length
+	sz += 4 // ProcId
+	sz += 2 + uint64(len(v.ClientId))
+	return sz
+}
+
+func (v *LSetLock) Encode(b *bytes.Buffer) error {
+	var err error
+	err = encodeByte(b, v.Typ)
+	if err != nil {
+		return err
+	}
+	err = encodeUint32(b, v.Flags)
+	if err != nil {
+		return err
+	}
+	err = encodeUint64(b, v.Start)
+	if err != nil {
+		return err
+	}
+	err = encodeUint64(b, v.Length)
+	if err != nil {
+		return err
+	}
+	err = encodeUint32(b, v.ProcId)
+	if err != nil {
+		return err
+	}
+	err = encodeString(b, v.ClientId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *LSetLock) Decode(b *bytes.Buffer) error {
+	var err error
+	v.Typ, err = decodeByte(b)
+	if err != nil {
+		return err
+	}
+	v.Flags, err = decodeUint32(b)
+	if err != nil {
+		return err
+	}
+	v.Start, err = decodeUint64(b)
+	if err != nil {
+		return err
+	}
+	v.Length, err = decodeUint64(b)
+	if err != nil {
+		return err
+	}
+	v.ProcId, err = decodeUint32(b)
+	if err != nil {
+		return err
+	}
+	v.ClientId, err = decodeString(b)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *LStatfs) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += 4 // Typ
@@ -517,6 +647,23 @@ func (v *Rattach) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rattach) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rattach")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "qid", &v.Qid)
+	return b.String()
+}
+
+func (v *Rattach) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rattach", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rauth) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -550,6 +697,23 @@ func (v *Rauth) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rauth) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rauth")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "aqid", &v.Aqid)
+	return b.String()
+}
+
+func (v *Rauth) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rauth", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rclunk) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -574,6 +738,22 @@ func (v *Rclunk) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rclunk) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rclunk")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rclunk) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rclunk", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rflush) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -598,6 +778,22 @@ func (v *Rflush) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rflush) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rflush")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rflush) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rflush", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rfsync) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -622,6 +818,22 @@ func (v *Rfsync) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rfsync) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rfsync")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rfsync) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rfsync", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rgetattr) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -655,14 +867,46 @@ func (v *Rgetattr) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rgetattr) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rgetattr")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtHex(b, "valid", uint64(v.LAttr.Valid))
+	fmtQid(b, "qid", &v.LAttr.Qid)
+	fmtOctal(b, "mode", uint64(v.LAttr.Mode))
+	fmtUint(b, "uid", uint64(v.LAttr.Uid))
+	fmtUint(b, "gid", uint64(v.LAttr.Gid))
+	fmtUint(b, "nlink", uint64(v.LAttr.Nlink))
+	fmtUint(b, "rdev", uint64(v.LAttr.Rdev))
+	fmtUint(b, "size", uint64(v.LAttr.Size))
+	fmtUint(b, "blksize", uint64(v.LAttr.Blksize))
+	fmtUint(b, "blocks", uint64(v.LAttr.Blocks))
+	fmtUint(b, "atimesec", uint64(v.LAttr.AtimeSec))
+	fmtUint(b, "atimensec", uint64(v.LAttr.AtimeNsec))
+	fmtUint(b, "mtimesec", uint64(v.LAttr.MtimeSec))
+	fmtUint(b, "mtimensec", uint64(v.LAttr.MtimeNsec))
+	fmtUint(b, "ctimesec", uint64(v.LAttr.CtimeSec))
+	fmtUint(b, "ctimensec", uint64(v.LAttr.CtimeNsec))
+	fmtUint(b, "btimesec", uint64(v.LAttr.BtimeSec))
+	fmtUint(b, "btimensec", uint64(v.LAttr.BtimeNsec))
+	fmtUint(b, "gen", uint64(v.LAttr.Gen))
+	fmtUint(b, "dataversion", uint64(v.LAttr.DataVersion))
+	return b.String()
+}
+
+func (v *Rgetattr) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rgetattr", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rgetlock) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
-	sz += 1 // Typ
-	sz += 8 // Start
-	sz += 8 // Length
-	sz += 4 // ProcId
-	sz += 2 + uint64(len(v.ClientId))
+	sz += v.LGetLock.EncodedSize()
 	return sz
 }
 
@@ -672,23 +916,7 @@ func (v *Rgetlock) Encode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	err = encodeByte(b, v.Typ)
-	if err != nil {
-		return err
-	}
-	err = encodeUint64(b, v.Start)
-	if err != nil {
-		return err
-	}
-	err = encodeUint64(b, v.Length)
-	if err != nil {
-		return err
-	}
-	err = encodeUint32(b, v.ProcId)
-	if err != nil {
-		return err
-	}
-	err = encodeString(b, v.ClientId)
+	err = v.LGetLock.Encode(b)
 	if err != nil {
 		return err
 	}
@@ -701,23 +929,32 @@ func (v *Rgetlock) Decode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	v.Typ, err = decodeByte(b)
-	if err != nil {
-		return err
-	}
-	v.Start, err = decodeUint64(b)
+	err = v.LGetLock.Decode(b)
 	if err != nil {
 		return err
 	}
-	v.Length, err = decodeUint64(b)
-	if err != nil {
-		return err
-	}
-	v.ProcId, err = decodeUint32(b)
+	return nil
+}
+
+func (v *Rgetlock) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rgetlock")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "typ", uint64(v.LGetLock.Typ))
+	fmtUint(b, "start", uint64(v.LGetLock.Start))
+	fmtUint(b, "length", uint64(v.LGetLock.Length))
+	fmtUint(b, "procid", uint64(v.LGetLock.ProcId))
+	fmtString(b, "clientid", v.LGetLock.ClientId)
+	return b.String()
+}
+
+func (v *Rgetlock) Validate(msize uint32) error {
+	var err error
+	err = validateString("Rgetlock", "ClientId", v.LGetLock.ClientId)
 	if err != nil {
 		return err
 	}
-	v.ClientId, err = decodeString(b)
+	err = validateSize("Rgetlock", v.EncodedSize(), msize)
 	if err != nil {
 		return err
 	}
@@ -766,6 +1003,24 @@ func (v *Rlcreate) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rlcreate) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rlcreate")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "qid", &v.Qid)
+	fmtUint(b, "iounit", uint64(v.Iounit))
+	return b.String()
+}
+
+func (v *Rlcreate) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rlcreate", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rlerror) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -799,6 +1054,23 @@ func (v *Rlerror) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rlerror) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rlerror")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "ecode", uint64(v.Ecode))
+	return b.String()
+}
+
+func (v *Rlerror) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rlerror", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rlink) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -823,6 +1095,22 @@ func (v *Rlink) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rlink) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rlink")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rlink) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rlink", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rlock) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -856,6 +1144,23 @@ func (v *Rlock) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rlock) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rlock")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "status", uint64(v.Status))
+	return b.String()
+}
+
+func (v *Rlock) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rlock", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rlopen) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -898,6 +1203,24 @@ func (v *Rlopen) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rlopen) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rlopen")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "qid", &v.Qid)
+	fmtUint(b, "iounit", uint64(v.Iounit))
+	return b.String()
+}
+
+func (v *Rlopen) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rlopen", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rmkdir) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -931,6 +1254,23 @@ func (v *Rmkdir) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rmkdir) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rmkdir")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "qid", &v.Qid)
+	return b.String()
+}
+
+func (v *Rmkdir) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rmkdir", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rmknod) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -964,6 +1304,23 @@ func (v *Rmknod) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rmknod) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rmknod")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "qid", &v.Qid)
+	return b.String()
+}
+
+func (v *Rmknod) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rmknod", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rread) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -997,6 +1354,23 @@ func (v *Rread) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rread) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rread")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtData(b, v.Data)
+	return b.String()
+}
+
+func (v *Rread) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rread", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rreaddir) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1034,6 +1408,27 @@ func (v *Rreaddir) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rreaddir) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rreaddir")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtDirEnts(b, v.Data)
+	return b.String()
+}
+
+func (v *Rreaddir) Validate(msize uint32) error {
+	var err error
+	err = validateDirEnts("Rreaddir", "Data", v.Data)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Rreaddir", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rreadlink) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1067,6 +1462,27 @@ func (v *Rreadlink) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rreadlink) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rreadlink")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtString(b, "target", v.Target)
+	return b.String()
+}
+
+func (v *Rreadlink) Validate(msize uint32) error {
+	var err error
+	err = validateString("Rreadlink", "Target", v.Target)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Rreadlink", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rremove) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1091,6 +1507,22 @@ func (v *Rremove) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rremove) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rremove")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rremove) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rremove", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rrename) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1115,6 +1547,22 @@ func (v *Rrename) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rrename) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rrename")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rrename) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rrename", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rrenameat) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1139,6 +1587,22 @@ func (v *Rrenameat) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rrenameat) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rrenameat")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rrenameat) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rrenameat", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rsetattr) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1163,6 +1627,22 @@ func (v *Rsetattr) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rsetattr) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rsetattr")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rsetattr) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rsetattr", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rstatfs) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1196,6 +1676,31 @@ func (v *Rstatfs) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rstatfs) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rstatfs")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "typ", uint64(v.LStatfs.Typ))
+	fmtUint(b, "bsize", uint64(v.LStatfs.Bsize))
+	fmtUint(b, "blocks", uint64(v.LStatfs.Blocks))
+	fmtUint(b, "bfree", uint64(v.LStatfs.Bfree))
+	fmtUint(b, "bavail", uint64(v.LStatfs.Bavail))
+	fmtUint(b, "files", uint64(v.LStatfs.Files))
+	fmtUint(b, "ffree", uint64(v.LStatfs.Ffree))
+	fmtUint(b, "fsid", uint64(v.LStatfs.Fsid))
+	fmtUint(b, "namelen", uint64(v.LStatfs.Namelen))
+	return b.String()
+}
+
+func (v *Rstatfs) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rstatfs", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rsymlink) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1229,6 +1734,23 @@ func (v *Rsymlink) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rsymlink) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rsymlink")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQid(b, "qid", &v.Qid)
+	return b.String()
+}
+
+func (v *Rsymlink) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rsymlink", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Runlinkat) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1253,6 +1775,22 @@ func (v *Runlinkat) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Runlinkat) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Runlinkat")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Runlinkat) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Runlinkat", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rversion) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1295,6 +1833,28 @@ func (v *Rversion) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rversion) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rversion")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "msize", uint64(v.Msize))
+	fmtString(b, "version", v.Version)
+	return b.String()
+}
+
+func (v *Rversion) Validate(msize uint32) error {
+	var err error
+	err = validateString("Rversion", "Version", v.Version)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Rversion", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rwalk) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1328,6 +1888,27 @@ func (v *Rwalk) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rwalk) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rwalk")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtQids(b, "nwqid", v.WQids)
+	return b.String()
+}
+
+func (v *Rwalk) Validate(msize uint32) error {
+	var err error
+	err = validateMaxWelem("Rwalk", "WQids", len(v.WQids))
+	if err != nil {
+		return err
+	}
+	err = validateSize("Rwalk", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rwrite) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1361,6 +1942,23 @@ func (v *Rwrite) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rwrite) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rwrite")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "count", uint64(v.Count))
+	return b.String()
+}
+
+func (v *Rwrite) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rwrite", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rxattrcreate) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1385,6 +1983,22 @@ func (v *Rxattrcreate) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rxattrcreate) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rxattrcreate")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	return b.String()
+}
+
+func (v *Rxattrcreate) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rxattrcreate", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Rxattrwalk) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1418,6 +2032,23 @@ func (v *Rxattrwalk) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Rxattrwalk) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rxattrwalk")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "size", uint64(v.Size))
+	return b.String()
+}
+
+func (v *Rxattrwalk) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Rxattrwalk", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tagged) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += 2 // Tag
@@ -1511,6 +2142,35 @@ func (v *Tattach) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tattach) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tattach")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "afid", uint64(v.Afid))
+	fmtString(b, "uname", v.Uname)
+	fmtString(b, "aname", v.Aname)
+	fmtUint(b, "n_uname", uint64(v.N_uname))
+	return b.String()
+}
+
+func (v *Tattach) Validate(msize uint32) error {
+	var err error
+	err = validateString("Tattach", "Uname", v.Uname)
+	if err != nil {
+		return err
+	}
+	err = validateString("Tattach", "Aname", v.Aname)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tattach", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tauth) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1571,6 +2231,34 @@ func (v *Tauth) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tauth) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tauth")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "afid", uint64(v.Afid))
+	fmtString(b, "uname", v.Uname)
+	fmtString(b, "aname", v.Aname)
+	fmtUint(b, "nuname", uint64(v.Nuname))
+	return b.String()
+}
+
+func (v *Tauth) Validate(msize uint32) error {
+	var err error
+	err = validateString("Tauth", "Uname", v.Uname)
+	if err != nil {
+		return err
+	}
+	err = validateString("Tauth", "Aname", v.Aname)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tauth", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tclunk) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1604,6 +2292,23 @@ func (v *Tclunk) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tclunk) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tclunk")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	return b.String()
+}
+
+func (v *Tclunk) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tclunk", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tflush) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1637,6 +2342,23 @@ func (v *Tflush) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tflush) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tflush")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "oldtag", uint64(v.OldTag))
+	return b.String()
+}
+
+func (v *Tflush) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tflush", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tfsync) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1670,6 +2392,23 @@ func (v *Tfsync) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tfsync) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tfsync")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	return b.String()
+}
+
+func (v *Tfsync) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tfsync", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tgetattr) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1712,15 +2451,29 @@ func (v *Tgetattr) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tgetattr) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tgetattr")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtHex(b, "mask", uint64(v.Mask))
+	return b.String()
+}
+
+func (v *Tgetattr) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tgetattr", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tgetlock) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
 	sz += 4 // Fid
-	sz += 1 // Typ
-	sz += 8 // Start
-	sz += 8 // Length
-	sz += 4 // ProcId
-	sz += 2 + uint64(len(v.ClientId))
+	sz += v.LGetLock.EncodedSize()
 	return sz
 }
 
@@ -1734,23 +2487,7 @@ func (v *Tgetlock) Encode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	err = encodeByte(b, v.Typ)
-	if err != nil {
-		return err
-	}
-	err = encodeUint64(b, v.Start)
-	if err != nil {
-		return err
-	}
-	err = encodeUint64(b, v.Length)
-	if err != nil {
-		return err
-	}
-	err = encodeUint32(b, v.ProcId)
-	if err != nil {
-		return err
-	}
-	err = encodeString(b, v.ClientId)
+	err = v.LGetLock.Encode(b)
 	if err != nil {
 		return err
 	}
@@ -1767,23 +2504,33 @@ func (v *Tgetlock) Decode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	v.Typ, err = decodeByte(b)
-	if err != nil {
-		return err
-	}
-	v.Start, err = decodeUint64(b)
-	if err != nil {
-		return err
-	}
-	v.Length, err = decodeUint64(b)
+	err = v.LGetLock.Decode(b)
 	if err != nil {
 		return err
 	}
-	v.ProcId, err = decodeUint32(b)
+	return nil
+}
+
+func (v *Tgetlock) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tgetlock")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "typ", uint64(v.LGetLock.Typ))
+	fmtUint(b, "start", uint64(v.LGetLock.Start))
+	fmtUint(b, "length", uint64(v.LGetLock.Length))
+	fmtUint(b, "procid", uint64(v.LGetLock.ProcId))
+	fmtString(b, "clientid", v.LGetLock.ClientId)
+	return b.String()
+}
+
+func (v *Tgetlock) Validate(msize uint32) error {
+	var err error
+	err = validateString("Tgetlock", "ClientId", v.LGetLock.ClientId)
 	if err != nil {
 		return err
 	}
-	v.ClientId, err = decodeString(b)
+	err = validateSize("Tgetlock", v.EncodedSize(), msize)
 	if err != nil {
 		return err
 	}
@@ -1859,6 +2606,31 @@ func (v *Tlcreate) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tlcreate) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tlcreate")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtString(b, "name", v.Name)
+	fmtHex(b, "flags", uint64(v.Flags))
+	fmtOctal(b, "mode", uint64(v.Mode))
+	fmtUint(b, "gid", uint64(v.Gid))
+	return b.String()
+}
+
+func (v *Tlcreate) Validate(msize uint32) error {
+	var err error
+	err = validateName("Tlcreate", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tlcreate", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tlink) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -1899,98 +2671,103 @@ func (v *Tlink) Decode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	v.Fid, err = decodeUint32(b)
-	if err != nil {
-		return err
-	}
-	v.Name, err = decodeString(b)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (v *Tlock) EncodedSize() uint64 {
-	sz := uint64(0)
-	sz += v.Tagged.EncodedSize()
-	sz += 4 // Fid
-	sz += 1 // Typ
-	sz += 4 // Flags
-	sz += 8 // Start
-	sz += 8 // Length
-	sz += 4 // ProcId
-	sz += 2 + uint64(len(v.ClientId))
-	return sz
-}
-
-func (v *Tlock) Encode(b *bytes.Buffer) error {
-	var err error
-	err = v.Tagged.Encode(b)
-	if err != nil {
-		return err
-	}
-	err = encodeUint32(b, v.Fid)
-	if err != nil {
-		return err
-	}
-	err = encodeByte(b, v.Typ)
-	if err != nil {
-		return err
-	}
-	err = encodeUint32(b, v.Flags)
-	if err != nil {
-		return err
-	}
-	err = encodeUint64(b, v.Start)
+	v.Fid, err = decodeUint32(b)
 	if err != nil {
 		return err
 	}
-	err = encodeUint64(b, v.Length)
+	v.Name, err = decodeString(b)
 	if err != nil {
 		return err
 	}
-	err = encodeUint32(b, v.ProcId)
+	return nil
+}
+
+func (v *Tlink) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tlink")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "dfid", uint64(v.Dfid))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtString(b, "name", v.Name)
+	return b.String()
+}
+
+func (v *Tlink) Validate(msize uint32) error {
+	var err error
+	err = validateName("Tlink", "Name", v.Name)
 	if err != nil {
 		return err
 	}
-	err = encodeString(b, v.ClientId)
+	err = validateSize("Tlink", v.EncodedSize(), msize)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (v *Tlock) Decode(b *bytes.Buffer) error {
+func (v *Tlock) EncodedSize() uint64 {
+	sz := uint64(0)
+	sz += v.Tagged.EncodedSize()
+	sz += 4 // Fid
+	sz += v.LSetLock.EncodedSize()
+	return sz
+}
+
+func (v *Tlock) Encode(b *bytes.Buffer) error {
 	var err error
-	err = v.Tagged.Decode(b)
+	err = v.Tagged.Encode(b)
 	if err != nil {
 		return err
 	}
-	v.Fid, err = decodeUint32(b)
+	err = encodeUint32(b, v.Fid)
 	if err != nil {
 		return err
 	}
-	v.Typ, err = decodeByte(b)
+	err = v.LSetLock.Encode(b)
 	if err != nil {
 		return err
 	}
-	v.Flags, err = decodeUint32(b)
+	return nil
+}
+
+func (v *Tlock) Decode(b *bytes.Buffer) error {
+	var err error
+	err = v.Tagged.Decode(b)
 	if err != nil {
 		return err
 	}
-	v.Start, err = decodeUint64(b)
+	v.Fid, err = decodeUint32(b)
 	if err != nil {
 		return err
 	}
-	v.Length, err = decodeUint64(b)
+	err = v.LSetLock.Decode(b)
 	if err != nil {
 		return err
 	}
-	v.ProcId, err = decodeUint32(b)
+	return nil
+}
+
+func (v *Tlock) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tlock")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "typ", uint64(v.LSetLock.Typ))
+	fmtHex(b, "flags", uint64(v.LSetLock.Flags))
+	fmtUint(b, "start", uint64(v.LSetLock.Start))
+	fmtUint(b, "length", uint64(v.LSetLock.Length))
+	fmtUint(b, "procid", uint64(v.LSetLock.ProcId))
+	fmtString(b, "clientid", v.LSetLock.ClientId)
+	return b.String()
+}
+
+func (v *Tlock) Validate(msize uint32) error {
+	var err error
+	err = validateString("Tlock", "ClientId", v.LSetLock.ClientId)
 	if err != nil {
 		return err
 	}
-	v.ClientId, err = decodeString(b)
+	err = validateSize("Tlock", v.EncodedSize(), msize)
 	if err != nil {
 		return err
 	}
@@ -2039,6 +2816,24 @@ func (v *Tlopen) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tlopen) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tlopen")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtHex(b, "flags", uint64(v.Flags))
+	return b.String()
+}
+
+func (v *Tlopen) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tlopen", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tmkdir) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2099,11 +2894,36 @@ func (v *Tmkdir) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tmkdir) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tmkdir")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "dfid", uint64(v.Dfid))
+	fmtString(b, "name", v.Name)
+	fmtOctal(b, "mode", uint64(v.Mode))
+	fmtUint(b, "gid", uint64(v.Gid))
+	return b.String()
+}
+
+func (v *Tmkdir) Validate(msize uint32) error {
+	var err error
+	err = validateName("Tmkdir", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tmkdir", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tmknod) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
 	sz += 4 // Fid
 	sz += 2 + uint64(len(v.Name))
+	sz += 4 // Mode
 	sz += 4 // Major
 	sz += 4 // Minor
 	sz += 4 // Gid
@@ -2124,6 +2944,10 @@ func (v *Tmknod) Encode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
+	err = encodeUint32(b, v.Mode)
+	if err != nil {
+		return err
+	}
 	err = encodeUint32(b, v.Major)
 	if err != nil {
 		return err
@@ -2153,6 +2977,10 @@ func (v *Tmknod) Decode(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
+	v.Mode, err = decodeUint32(b)
+	if err != nil {
+		return err
+	}
 	v.Major, err = decodeUint32(b)
 	if err != nil {
 		return err
@@ -2168,6 +2996,32 @@ func (v *Tmknod) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tmknod) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tmknod")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtString(b, "name", v.Name)
+	fmtOctal(b, "mode", uint64(v.Mode))
+	fmtUint(b, "major", uint64(v.Major))
+	fmtUint(b, "minor", uint64(v.Minor))
+	fmtUint(b, "gid", uint64(v.Gid))
+	return b.String()
+}
+
+func (v *Tmknod) Validate(msize uint32) error {
+	var err error
+	err = validateName("Tmknod", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tmknod", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tread) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2219,6 +3073,25 @@ func (v *Tread) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tread) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tread")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "offset", uint64(v.Offset))
+	fmtUint(b, "count", uint64(v.Count))
+	return b.String()
+}
+
+func (v *Tread) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tread", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Treaddir) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2270,6 +3143,25 @@ func (v *Treaddir) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Treaddir) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Treaddir")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "offset", uint64(v.Offset))
+	fmtUint(b, "count", uint64(v.Count))
+	return b.String()
+}
+
+func (v *Treaddir) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Treaddir", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Treadlink) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2303,6 +3195,23 @@ func (v *Treadlink) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Treadlink) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Treadlink")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	return b.String()
+}
+
+func (v *Treadlink) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Treadlink", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tremove) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2336,6 +3245,23 @@ func (v *Tremove) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tremove) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tremove")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	return b.String()
+}
+
+func (v *Tremove) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tremove", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Trename) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2387,6 +3313,29 @@ func (v *Trename) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Trename) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Trename")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "dfid", uint64(v.Dfid))
+	fmtString(b, "name", v.Name)
+	return b.String()
+}
+
+func (v *Trename) Validate(msize uint32) error {
+	var err error
+	err = validateName("Trename", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Trename", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Trenameat) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2447,6 +3396,34 @@ func (v *Trenameat) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Trenameat) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Trenameat")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "olddfid", uint64(v.OldDfid))
+	fmtString(b, "oldname", v.OldName)
+	fmtUint(b, "newdfid", uint64(v.NewDfid))
+	fmtString(b, "newname", v.NewName)
+	return b.String()
+}
+
+func (v *Trenameat) Validate(msize uint32) error {
+	var err error
+	err = validateName("Trenameat", "OldName", v.OldName)
+	if err != nil {
+		return err
+	}
+	err = validateName("Trenameat", "NewName", v.NewName)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Trenameat", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tsetattr) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2489,6 +3466,32 @@ func (v *Tsetattr) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tsetattr) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tsetattr")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtHex(b, "valid", uint64(v.LSetAttr.Valid))
+	fmtOctal(b, "mode", uint64(v.LSetAttr.Mode))
+	fmtUint(b, "uid", uint64(v.LSetAttr.Uid))
+	fmtUint(b, "gid", uint64(v.LSetAttr.Gid))
+	fmtUint(b, "size", uint64(v.LSetAttr.Size))
+	fmtUint(b, "atimesec", uint64(v.LSetAttr.AtimeSec))
+	fmtUint(b, "atimensec", uint64(v.LSetAttr.AtimeNsec))
+	fmtUint(b, "mtimesec", uint64(v.LSetAttr.MtimeSec))
+	fmtUint(b, "mtimensec", uint64(v.LSetAttr.MtimeNsec))
+	return b.String()
+}
+
+func (v *Tsetattr) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tsetattr", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tstatfs) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2522,6 +3525,23 @@ func (v *Tstatfs) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tstatfs) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tstatfs")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	return b.String()
+}
+
+func (v *Tstatfs) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Tstatfs", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tsymlink) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2582,6 +3602,34 @@ func (v *Tsymlink) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tsymlink) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tsymlink")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtString(b, "name", v.Name)
+	fmtString(b, "target", v.Target)
+	fmtUint(b, "gid", uint64(v.Gid))
+	return b.String()
+}
+
+func (v *Tsymlink) Validate(msize uint32) error {
+	var err error
+	err = validateName("Tsymlink", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateString("Tsymlink", "Target", v.Target)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tsymlink", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tunlinkat) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2633,6 +3681,29 @@ func (v *Tunlinkat) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tunlinkat) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tunlinkat")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "dfid", uint64(v.Dfid))
+	fmtString(b, "name", v.Name)
+	fmtHex(b, "flags", uint64(v.Flags))
+	return b.String()
+}
+
+func (v *Tunlinkat) Validate(msize uint32) error {
+	var err error
+	err = validateName("Tunlinkat", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tunlinkat", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Tversion) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2675,6 +3746,28 @@ func (v *Tversion) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Tversion) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tversion")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "msize", uint64(v.Msize))
+	fmtString(b, "version", v.Version)
+	return b.String()
+}
+
+func (v *Tversion) Validate(msize uint32) error {
+	var err error
+	err = validateString("Tversion", "Version", v.Version)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Tversion", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Twalk) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2730,6 +3823,37 @@ func (v *Twalk) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Twalk) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Twalk")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "newfid", uint64(v.NewFid))
+	fmtStrings(b, "nwname", v.Wnames)
+	return b.String()
+}
+
+func (v *Twalk) Validate(msize uint32) error {
+	var err error
+	err = validateMaxWelem("Twalk", "Wnames", len(v.Wnames))
+	if err != nil {
+		return err
+	}
+	err = validateStrings("Twalk", "Wnames", v.Wnames)
+	if err != nil {
+		return err
+	}
+	err = validateNames("Twalk", "Wnames", v.Wnames)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Twalk", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Twrite) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2781,6 +3905,25 @@ func (v *Twrite) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Twrite) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Twrite")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "offset", uint64(v.Offset))
+	fmtData(b, v.Data)
+	return b.String()
+}
+
+func (v *Twrite) Validate(msize uint32) error {
+	var err error
+	err = validateSize("Twrite", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Txattrcreate) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2841,6 +3984,30 @@ func (v *Txattrcreate) Decode(b *bytes.Buffer) error {
 	return nil
 }
 
+func (v *Txattrcreate) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Txattrcreate")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtString(b, "name", v.Name)
+	fmtUint(b, "attrsize", uint64(v.AttrSize))
+	fmtHex(b, "flags", uint64(v.Flags))
+	return b.String()
+}
+
+func (v *Txattrcreate) Validate(msize uint32) error {
+	var err error
+	err = validateString("Txattrcreate", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Txattrcreate", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (v *Txattrwalk) EncodedSize() uint64 {
 	sz := uint64(0)
 	sz += v.Tagged.EncodedSize()
@@ -2891,3 +4058,26 @@ func (v *Txattrwalk) Decode(b *bytes.Buffer) error {
 	}
 	return nil
 }
+
+func (v *Txattrwalk) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Txattrwalk")
+	fmtUint(b, "tag", uint64(v.Tagged.Tag))
+	fmtUint(b, "fid", uint64(v.Fid))
+	fmtUint(b, "newfid", uint64(v.Newfid))
+	fmtString(b, "name", v.Name)
+	return b.String()
+}
+
+func (v *Txattrwalk) Validate(msize uint32) error {
+	var err error
+	err = validateString("Txattrwalk", "Name", v.Name)
+	if err != nil {
+		return err
+	}
+	err = validateSize("Txattrwalk", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ package proto9
 import (
 	"bytes"
 	"errors"
+	"fmt"
 )
 
 var (
@@ -13,6 +14,30 @@ var (
 	ErrDecodingFailed = errors.New("decoding failed, short or corrupt message")
 )
 
+// Specific decoding failures, all match ErrDecodingFailed with errors.Is.
+var (
+	errShortMessage  = fmt.Errorf("%w: message too short", ErrDecodingFailed)
+	errCountTooLarge = fmt.Errorf("%w: element count exceeds message size", ErrDecodingFailed)
+	errDirEntOverrun = fmt.Errorf("%w: directory entry overruns its section", ErrDecodingFailed)
+	errTrailingBytes = fmt.Errorf("%w: trailing bytes after message", ErrDecodingFailed)
+)
+
+// DecodeError reports a message that could not be decoded,
+// Offset is the position in the message at which decoding stopped.
+type DecodeError struct {
+	Kind   uint8
+	Offset int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding message kind %d failed at offset %d: %s", e.Kind, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 func encodeByte(b *bytes.Buffer, v byte) error {
 	return b.WriteByte(v)
 }
@@ -83,7 +108,7 @@ func encodeStringSlice(b *bytes.Buffer, v []string) error {
 }
 
 func encodeByteSlice(b *bytes.Buffer, v []byte) error {
-	if len(v) > 0xffffffff {
+	if uint64(len(v)) > 0xffffffff {
 		return ErrValueTooLong
 	}
 	err := encodeUint32(b, uint32(len(v)))
@@ -112,12 +137,12 @@ func encodeDirEntSlice(b *bytes.Buffer, v []DirEnt) error {
 	countBuf[0] = byte(count & 0xff)
 	countBuf[1] = byte((count & 0xff00) >> 8)
 	countBuf[2] = byte((count & 0xff0000) >> 16)
-	countBuf[3] = byte((count & 0xff000000) >> 24)
+	countBuf[3] = byte(count >> 24)
 	return nil
 }
 
 func encodeQids(b *bytes.Buffer, v []Qid) error {
-	if len(v) > 13 {
+	if len(v) > MAXWELEM {
 		return ErrValueTooLong
 	}
 	err := encodeUint16(b, uint16(len(v)))
@@ -136,7 +161,7 @@ func encodeQids(b *bytes.Buffer, v []Qid) error {
 func decodeByte(b *bytes.Buffer) (byte, error) {
 	v, err := b.ReadByte()
 	if err != nil {
-		return v, ErrDecodingFailed
+		return v, errShortMessage
 	}
 	return v, nil
 }
@@ -144,34 +169,31 @@ func decodeByte(b *bytes.Buffer) (byte, error) {
 func decodeUint8(b *bytes.Buffer) (uint8, error) {
 	v, err := b.ReadByte()
 	if err != nil {
-		return v, ErrDecodingFailed
+		return v, errShortMessage
 	}
 	return v, nil
 }
 
 func decodeUint16(b *bytes.Buffer) (uint16, error) {
-	buf := [2]byte{}
-	_, err := b.Read(buf[:])
-	if err != nil {
-		return 0, ErrDecodingFailed
+	buf := b.Next(2)
+	if len(buf) != 2 {
+		return 0, errShortMessage
 	}
 	return uint16(buf[0]) | (uint16(buf[1]) << 8), nil
 }
 
 func decodeUint32(b *bytes.Buffer) (uint32, error) {
-	buf := [4]byte{}
-	_, err := b.Read(buf[:])
-	if err != nil {
-		return 0, ErrDecodingFailed
+	buf := b.Next(4)
+	if len(buf) != 4 {
+		return 0, errShortMessage
 	}
 	return uint32(buf[0]) | (uint32(buf[1]) << 8) | (uint32(buf[2]) << 16) | (uint32(buf[3]) << 24), nil
 }
 
 func decodeUint64(b *bytes.Buffer) (uint64, error) {
-	buf := [8]byte{}
-	_, err := b.Read(buf[:])
-	if err != nil {
-		return 0, ErrDecodingFailed
+	buf := b.Next(8)
+	if len(buf) != 8 {
+		return 0, errShortMessage
 	}
 	return uint64(buf[0]) | (uint64(buf[1]) << 8) | (uint64(buf[2]) << 16) | (uint64(buf[3]) << 24) | (uint64(buf[4]) << 32) | (uint64(buf[5]) << 40) | (uint64(buf[6]) << 48) | (uint64(buf[7]) << 56), nil
 }
@@ -179,13 +201,12 @@ func decodeUint64(b *bytes.Buffer) (uint64, error) {
 func decodeString(b *bytes.Buffer) (string, error) {
 	l, err := decodeUint16(b)
 	if err != nil {
-		return "", ErrDecodingFailed
+		return "", err
 	}
-	buf := b.Next(int(l))
-	if len(buf) != int(l) {
-		return "", ErrDecodingFailed
+	if int(l) > b.Len() {
+		return "", errShortMessage
 	}
-	return string(buf), nil
+	return string(b.Next(int(l))), nil
 }
 
 func decodeStringSlice(b *bytes.Buffer) ([]string, error) {
@@ -193,6 +214,11 @@ func decodeStringSlice(b *bytes.Buffer) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Each string needs at least its 2 byte length prefix, so the
+	// count can't be honest if the message doesn't have room for them.
+	if int(l)*2 > b.Len() {
+		return nil, errCountTooLarge
+	}
 	strs := make([]string, 0, int(l))
 	for i := 0; i < int(l); i++ {
 		s, err := decodeString(b)
@@ -209,14 +235,13 @@ func decodeByteSlice(b *bytes.Buffer) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if uint64(l) > uint64(b.Len()) {
+		return nil, errShortMessage
+	}
 	// XXX Technically this is not allowed because the buffer documentation
 	// says the buffer is no longer valid on the next call to Read... however
 	// the implementation doesn't actually invalidate it and we avoid the copy.
-	buf := b.Next(int(l))
-	if len(buf) != int(l) {
-		return nil, ErrDecodingFailed
-	}
-	return buf, nil
+	return b.Next(int(l)), nil
 }
 
 func decodeDirEntSlice(b *bytes.Buffer) ([]DirEnt, error) {
@@ -224,16 +249,18 @@ func decodeDirEntSlice(b *bytes.Buffer) ([]DirEnt, error) {
 	if err != nil {
 		return nil, err
 	}
+	if uint64(l) > uint64(b.Len()) {
+		return nil, errShortMessage
+	}
+	// Decode from a separate buffer so entries can't run past their section.
+	section := bytes.NewBuffer(b.Next(int(l)))
 	ents := []DirEnt{}
 	ent := DirEnt{}
-	for l != 0 {
-		startLen := uint32(len(b.Bytes()))
-		err = ent.Decode(b)
+	for section.Len() != 0 {
+		err = ent.Decode(section)
 		if err != nil {
-			return nil, err
+			return nil, errDirEntOverrun
 		}
-		endLen := uint32(len(b.Bytes()))
-		l -= (startLen - endLen)
 		ents = append(ents, ent)
 	}
 	return ents, nil
@@ -244,7 +271,10 @@ func decodeQids(b *bytes.Buffer) ([]Qid, error) {
 	if err != nil {
 		return nil, err
 	}
-	qids := []Qid{}
+	if int(l)*13 > b.Len() {
+		return nil, errCountTooLarge
+	}
+	qids := make([]Qid, 0, int(l))
 	qid := Qid{}
 	for i := 0; i < int(l); i++ {
 		err = qid.Decode(b)
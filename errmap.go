@@ -0,0 +1,84 @@
+package proto9
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ErrnoMapper returns the Linux errno for errors it recognizes.
+type ErrnoMapper func(err error) (uint32, bool)
+
+var (
+	errnoMappersLock sync.RWMutex
+	errnoMappers     []ErrnoMapper
+)
+
+// RegisterErrnoMapper adds m to the mappers consulted by ErrorToRlerror,
+// mappers are consulted in order of registration, before the builtin
+// mappings.
+func RegisterErrnoMapper(m ErrnoMapper) {
+	errnoMappersLock.Lock()
+	defer errnoMappersLock.Unlock()
+	errnoMappers = append(errnoMappers, m)
+}
+
+// ErrorToRlerror converts err into an Rlerror, unwrapping errors such
+// as *os.PathError to find an *Rlerror, syscall.Errno or one of the
+// fs.Err* sentinels. Errors that cannot be mapped become EIO.
+func ErrorToRlerror(err error) *Rlerror {
+	errnoMappersLock.RLock()
+	mappers := errnoMappers
+	errnoMappersLock.RUnlock()
+	for _, m := range mappers {
+		if ecode, ok := m(err); ok {
+			return &Rlerror{Ecode: ecode}
+		}
+	}
+
+	var rlerror *Rlerror
+	if errors.As(err, &rlerror) {
+		return &Rlerror{Ecode: rlerror.Ecode}
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return &Rlerror{Ecode: SysErrnoToDotL(errno)}
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &Rlerror{Ecode: ENOENT}
+	case errors.Is(err, fs.ErrExist):
+		return &Rlerror{Ecode: EEXIST}
+	case errors.Is(err, fs.ErrPermission):
+		return &Rlerror{Ecode: EACCES}
+	case errors.Is(err, fs.ErrInvalid):
+		return &Rlerror{Ecode: EINVAL}
+	case errors.Is(err, fs.ErrClosed):
+		return &Rlerror{Ecode: EBADF}
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return &Rlerror{Ecode: ETIMEDOUT}
+	case errors.Is(err, context.Canceled):
+		return &Rlerror{Ecode: EINTR}
+	default:
+		return &Rlerror{Ecode: EIO}
+	}
+}
+
+// Is allows errors.Is to match an Rlerror against another Rlerror,
+// a syscall.Errno or the fs.Err* sentinels.
+func (e *Rlerror) Is(target error) bool {
+	switch target := target.(type) {
+	case *Rlerror:
+		return target.Ecode == e.Ecode
+	case syscall.Errno:
+		return SysErrnoToDotL(target) == e.Ecode
+	}
+	if e.Ecode == ETIMEDOUT && target == os.ErrDeadlineExceeded {
+		return true
+	}
+	return DotLToSysErrno(e.Ecode).Is(target)
+}
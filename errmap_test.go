@@ -0,0 +1,83 @@
+package proto9
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type testQuotaError struct{}
+
+func (e *testQuotaError) Error() string { return "over quota" }
+
+func TestErrorToRlerror(t *testing.T) {
+	RegisterErrnoMapper(func(err error) (uint32, bool) {
+		var quotaErr *testQuotaError
+		if errors.As(err, &quotaErr) {
+			return EDQUOT, true
+		}
+		return 0, false
+	})
+
+	for _, tc := range []struct {
+		err   error
+		ecode uint32
+	}{
+		{&Rlerror{Ecode: EXDEV}, EXDEV},
+		{fmt.Errorf("wrapped: %w", &Rlerror{Ecode: EXDEV}), EXDEV},
+		{syscall.ENOTEMPTY, ENOTEMPTY},
+		{&os.PathError{Op: "open", Path: "x", Err: syscall.ENOENT}, ENOENT},
+		{&os.LinkError{Op: "rename", Old: "a", New: "b", Err: syscall.EXDEV}, EXDEV},
+		{fs.ErrNotExist, ENOENT},
+		{os.ErrExist, EEXIST},
+		{&fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}, EACCES},
+		{fs.ErrInvalid, EINVAL},
+		{fs.ErrClosed, EBADF},
+		{context.Canceled, EINTR},
+		{context.DeadlineExceeded, ETIMEDOUT},
+		{fmt.Errorf("wrapped: %w", &testQuotaError{}), EDQUOT},
+		{errors.New("something else"), EIO},
+	} {
+		rlerror := ErrorToRlerror(tc.err)
+		if rlerror.Ecode != tc.ecode {
+			t.Errorf("ErrorToRlerror(%v) = %d, expected %d", tc.err, rlerror.Ecode, tc.ecode)
+		}
+	}
+}
+
+func TestRlerrorIs(t *testing.T) {
+	var err error = &Rlerror{Ecode: ENOENT}
+	if !errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EEXIST) {
+		t.Fatal("unexpected errno match")
+	}
+	if !errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrExist) {
+		t.Fatal("unexpected sentinel match")
+	}
+	if !errors.Is(fmt.Errorf("wrapped: %w", err), &Rlerror{Ecode: ENOENT}) {
+		t.Fatal("expected wrapped match")
+	}
+	if !errors.Is(&Rlerror{Ecode: EACCES}, fs.ErrPermission) {
+		t.Fatal("expected EACCES to match ErrPermission")
+	}
+	if !errors.Is(&Rlerror{Ecode: EEXIST}, fs.ErrExist) {
+		t.Fatal("expected EEXIST to match ErrExist")
+	}
+	if !errors.Is(&Rlerror{Ecode: ETIMEDOUT}, os.ErrDeadlineExceeded) {
+		t.Fatal("expected ETIMEDOUT to match ErrDeadlineExceeded")
+	}
+}
+
+func TestErrnoTranslation(t *testing.T) {
+	for _, m := range append(hostErrnos, portableErrnos...) {
+		if ecode := SysErrnoToDotL(m.errno); ecode != m.ecode {
+			t.Errorf("SysErrnoToDotL(%d) = %d, expected %d", m.errno, ecode, m.ecode)
+		}
+		if ecode := SysErrnoToDotL(DotLToSysErrno(m.ecode)); ecode != m.ecode {
+			t.Errorf("errno %d does not round trip, got %d", m.ecode, ecode)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package proto9
+
+import (
+	"syscall"
+)
+
+// The error numbers of 9P2000.L are those of Linux on most
+// architectures, as listed in dotlerror.go. Other platforms and
+// Linux architectures number errors differently, so host errnos are
+// translated with SysErrnoToDotL and DotLToSysErrno.
+
+type errnoMapping struct {
+	errno syscall.Errno
+	ecode uint32
+}
+
+// Errnos defined on every supported platform.
+var portableErrnos = []errnoMapping{
+	{syscall.E2BIG, E2BIG},
+	{syscall.EACCES, EACCES},
+	{syscall.EADDRINUSE, EADDRINUSE},
+	{syscall.EADDRNOTAVAIL, EADDRNOTAVAIL},
+	{syscall.EAFNOSUPPORT, EAFNOSUPPORT},
+	{syscall.EAGAIN, EAGAIN},
+	{syscall.EALREADY, EALREADY},
+	{syscall.EBADF, EBADF},
+	{syscall.EBADMSG, EBADMSG},
+	{syscall.EBUSY, EBUSY},
+	{syscall.ECANCELED, ECANCELED},
+	{syscall.ECHILD, ECHILD},
+	{syscall.ECONNABORTED, ECONNABORTED},
+	{syscall.ECONNREFUSED, ECONNREFUSED},
+	{syscall.ECONNRESET, ECONNRESET},
+	{syscall.EDEADLK, EDEADLK},
+	{syscall.EDESTADDRREQ, EDESTADDRREQ},
+	{syscall.EDOM, EDOM},
+	{syscall.EDQUOT, EDQUOT},
+	{syscall.EEXIST, EEXIST},
+	{syscall.EFAULT, EFAULT},
+	{syscall.EFBIG, EFBIG},
+	{syscall.EHOSTDOWN, EHOSTDOWN},
+	{syscall.EHOSTUNREACH, EHOSTUNREACH},
+	{syscall.EIDRM, EIDRM},
+	{syscall.EILSEQ, EILSEQ},
+	{syscall.EINPROGRESS, EINPROGRESS},
+	{syscall.EINTR, EINTR},
+	{syscall.EINVAL, EINVAL},
+	{syscall.EIO, EIO},
+	{syscall.EISCONN, EISCONN},
+	{syscall.EISDIR, EISDIR},
+	{syscall.ELOOP, ELOOP},
+	{syscall.EMFILE, EMFILE},
+	{syscall.EMLINK, EMLINK},
+	{syscall.EMSGSIZE, EMSGSIZE},
+	{syscall.ENAMETOOLONG, ENAMETOOLONG},
+	{syscall.ENETDOWN, ENETDOWN},
+	{syscall.ENETRESET, ENETRESET},
+	{syscall.ENETUNREACH, ENETUNREACH},
+	{syscall.ENFILE, ENFILE},
+	{syscall.ENOBUFS, ENOBUFS},
+	{syscall.ENODEV, ENODEV},
+	{syscall.ENOENT, ENOENT},
+	{syscall.ENOEXEC, ENOEXEC},
+	{syscall.ENOLCK, ENOLCK},
+	{syscall.ENOMEM, ENOMEM},
+	{syscall.ENOMSG, ENOMSG},
+	{syscall.ENOPROTOOPT, ENOPROTOOPT},
+	{syscall.ENOSPC, ENOSPC},
+	{syscall.ENOSYS, ENOSYS},
+	{syscall.ENOTBLK, ENOTBLK},
+	{syscall.ENOTCONN, ENOTCONN},
+	{syscall.ENOTDIR, ENOTDIR},
+	{syscall.ENOTEMPTY, ENOTEMPTY},
+	{syscall.ENOTSOCK, ENOTSOCK},
+	{syscall.ENOTSUP, ENOTSUP},
+	{syscall.ENOTTY, ENOTTY},
+	{syscall.ENXIO, ENXIO},
+	{syscall.EOPNOTSUPP, EOPNOTSUPP},
+	{syscall.EOVERFLOW, EOVERFLOW},
+	{syscall.EPERM, EPERM},
+	{syscall.EPFNOSUPPORT, EPFNOSUPPORT},
+	{syscall.EPIPE, EPIPE},
+	{syscall.EPROTO, EPROTO},
+	{syscall.EPROTONOSUPPORT, EPROTONOSUPPORT},
+	{syscall.EPROTOTYPE, EPROTOTYPE},
+	{syscall.ERANGE, ERANGE},
+	{syscall.EREMOTE, EREMOTE},
+	{syscall.EROFS, EROFS},
+	{syscall.ESHUTDOWN, ESHUTDOWN},
+	{syscall.ESOCKTNOSUPPORT, ESOCKTNOSUPPORT},
+	{syscall.ESPIPE, ESPIPE},
+	{syscall.ESRCH, ESRCH},
+	{syscall.ESTALE, ESTALE},
+	{syscall.ETIMEDOUT, ETIMEDOUT},
+	{syscall.ETOOMANYREFS, ETOOMANYREFS},
+	{syscall.ETXTBSY, ETXTBSY},
+	{syscall.EUSERS, EUSERS},
+	{syscall.EXDEV, EXDEV},
+}
+
+var (
+	sysToDotL = make(map[syscall.Errno]uint32)
+	dotLToSys = make(map[uint32]syscall.Errno)
+)
+
+func init() {
+	if hostErrnosAreDotL {
+		return
+	}
+	for _, mappings := range [][]errnoMapping{hostErrnos, portableErrnos} {
+		for _, m := range mappings {
+			if _, ok := sysToDotL[m.errno]; !ok {
+				sysToDotL[m.errno] = m.ecode
+			}
+			// Aliases such as ENOTSUP only translate from the host.
+			if _, ok := dotLToSys[m.ecode]; !ok {
+				dotLToSys[m.ecode] = m.errno
+			}
+		}
+	}
+}
+
+// SysErrnoToDotL returns the 9P2000.L number of a host errno,
+// errnos without one become EIO.
+func SysErrnoToDotL(errno syscall.Errno) uint32 {
+	if hostErrnosAreDotL {
+		return uint32(errno)
+	}
+	if ecode, ok := sysToDotL[errno]; ok {
+		return ecode
+	}
+	return EIO
+}
+
+// DotLToSysErrno returns the host errno of a 9P2000.L error number,
+// numbers without one become EIO.
+func DotLToSysErrno(ecode uint32) syscall.Errno {
+	if hostErrnosAreDotL {
+		return syscall.Errno(ecode)
+	}
+	if errno, ok := dotLToSys[ecode]; ok {
+		return errno
+	}
+	return syscall.EIO
+}
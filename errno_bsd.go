@@ -0,0 +1,15 @@
+//go:build dragonfly || freebsd || netbsd || openbsd
+// +build dragonfly freebsd netbsd openbsd
+
+package proto9
+
+import (
+	"syscall"
+)
+
+const hostErrnosAreDotL = false
+
+var hostErrnos = []errnoMapping{
+	// Missing extended attributes are ENODATA on Linux.
+	{syscall.ENOATTR, ENODATA},
+}
@@ -0,0 +1,20 @@
+package proto9
+
+import (
+	"syscall"
+)
+
+const hostErrnosAreDotL = false
+
+var hostErrnos = []errnoMapping{
+	{syscall.EMULTIHOP, EMULTIHOP},
+	{syscall.ENODATA, ENODATA},
+	{syscall.ENOLINK, ENOLINK},
+	{syscall.ENOSR, ENOSR},
+	{syscall.ENOSTR, ENOSTR},
+	{syscall.ENOTRECOVERABLE, ENOTRECOVERABLE},
+	{syscall.EOWNERDEAD, EOWNERDEAD},
+	{syscall.ETIME, ETIME},
+	// Missing extended attributes are ENODATA on Linux.
+	{syscall.ENOATTR, ENODATA},
+}
@@ -0,0 +1,8 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package proto9
+
+const hostErrnosAreDotL = true
+
+var hostErrnos []errnoMapping
@@ -0,0 +1,148 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package proto9
+
+import (
+	"syscall"
+)
+
+const hostErrnosAreDotL = false
+
+var hostErrnos = []errnoMapping{
+	{syscall.E2BIG, E2BIG},
+	{syscall.EACCES, EACCES},
+	{syscall.EADDRINUSE, EADDRINUSE},
+	{syscall.EADDRNOTAVAIL, EADDRNOTAVAIL},
+	{syscall.EADV, EADV},
+	{syscall.EAFNOSUPPORT, EAFNOSUPPORT},
+	{syscall.EAGAIN, EAGAIN},
+	{syscall.EALREADY, EALREADY},
+	{syscall.EBADE, EBADE},
+	{syscall.EBADF, EBADF},
+	{syscall.EBADFD, EBADFD},
+	{syscall.EBADMSG, EBADMSG},
+	{syscall.EBADR, EBADR},
+	{syscall.EBADRQC, EBADRQC},
+	{syscall.EBADSLT, EBADSLT},
+	{syscall.EBFONT, EBFONT},
+	{syscall.EBUSY, EBUSY},
+	{syscall.ECANCELED, ECANCELED},
+	{syscall.ECHILD, ECHILD},
+	{syscall.ECHRNG, ECHRNG},
+	{syscall.ECOMM, ECOMM},
+	{syscall.ECONNABORTED, ECONNABORTED},
+	{syscall.ECONNREFUSED, ECONNREFUSED},
+	{syscall.ECONNRESET, ECONNRESET},
+	{syscall.EDEADLK, EDEADLK},
+	{syscall.EDEADLOCK, EDEADLOCK},
+	{syscall.EDESTADDRREQ, EDESTADDRREQ},
+	{syscall.EDOM, EDOM},
+	{syscall.EDOTDOT, EDOTDOT},
+	{syscall.EDQUOT, EDQUOT},
+	{syscall.EEXIST, EEXIST},
+	{syscall.EFAULT, EFAULT},
+	{syscall.EFBIG, EFBIG},
+	{syscall.EHOSTDOWN, EHOSTDOWN},
+	{syscall.EHOSTUNREACH, EHOSTUNREACH},
+	{syscall.EHWPOISON, EHWPOISON},
+	{syscall.EIDRM, EIDRM},
+	{syscall.EILSEQ, EILSEQ},
+	{syscall.EINPROGRESS, EINPROGRESS},
+	{syscall.EINTR, EINTR},
+	{syscall.EINVAL, EINVAL},
+	{syscall.EIO, EIO},
+	{syscall.EISCONN, EISCONN},
+	{syscall.EISDIR, EISDIR},
+	{syscall.EISNAM, EISNAM},
+	{syscall.EKEYEXPIRED, EKEYEXPIRED},
+	{syscall.EKEYREJECTED, EKEYREJECTED},
+	{syscall.EKEYREVOKED, EKEYREVOKED},
+	{syscall.EL2HLT, EL2HLT},
+	{syscall.EL2NSYNC, EL2NSYNC},
+	{syscall.EL3HLT, EL3HLT},
+	{syscall.EL3RST, EL3RST},
+	{syscall.ELIBACC, ELIBACC},
+	{syscall.ELIBBAD, ELIBBAD},
+	{syscall.ELIBEXEC, ELIBEXEC},
+	{syscall.ELIBMAX, ELIBMAX},
+	{syscall.ELIBSCN, ELIBSCN},
+	{syscall.ELNRNG, ELNRNG},
+	{syscall.ELOOP, ELOOP},
+	{syscall.EMEDIUMTYPE, EMEDIUMTYPE},
+	{syscall.EMFILE, EMFILE},
+	{syscall.EMLINK, EMLINK},
+	{syscall.EMSGSIZE, EMSGSIZE},
+	{syscall.EMULTIHOP, EMULTIHOP},
+	{syscall.ENAMETOOLONG, ENAMETOOLONG},
+	{syscall.ENAVAIL, ENAVAIL},
+	{syscall.ENETDOWN, ENETDOWN},
+	{syscall.ENETRESET, ENETRESET},
+	{syscall.ENETUNREACH, ENETUNREACH},
+	{syscall.ENFILE, ENFILE},
+	{syscall.ENOANO, ENOANO},
+	{syscall.ENOBUFS, ENOBUFS},
+	{syscall.ENOCSI, ENOCSI},
+	{syscall.ENODATA, ENODATA},
+	{syscall.ENODEV, ENODEV},
+	{syscall.ENOENT, ENOENT},
+	{syscall.ENOEXEC, ENOEXEC},
+	{syscall.ENOKEY, ENOKEY},
+	{syscall.ENOLCK, ENOLCK},
+	{syscall.ENOLINK, ENOLINK},
+	{syscall.ENOMEDIUM, ENOMEDIUM},
+	{syscall.ENOMEM, ENOMEM},
+	{syscall.ENOMSG, ENOMSG},
+	{syscall.ENONET, ENONET},
+	{syscall.ENOPKG, ENOPKG},
+	{syscall.ENOPROTOOPT, ENOPROTOOPT},
+	{syscall.ENOSPC, ENOSPC},
+	{syscall.ENOSR, ENOSR},
+	{syscall.ENOSTR, ENOSTR},
+	{syscall.ENOSYS, ENOSYS},
+	{syscall.ENOTBLK, ENOTBLK},
+	{syscall.ENOTCONN, ENOTCONN},
+	{syscall.ENOTDIR, ENOTDIR},
+	{syscall.ENOTEMPTY, ENOTEMPTY},
+	{syscall.ENOTNAM, ENOTNAM},
+	{syscall.ENOTRECOVERABLE, ENOTRECOVERABLE},
+	{syscall.ENOTSOCK, ENOTSOCK},
+	{syscall.ENOTSUP, ENOTSUP},
+	{syscall.ENOTTY, ENOTTY},
+	{syscall.ENOTUNIQ, ENOTUNIQ},
+	{syscall.ENXIO, ENXIO},
+	{syscall.EOPNOTSUPP, EOPNOTSUPP},
+	{syscall.EOVERFLOW, EOVERFLOW},
+	{syscall.EOWNERDEAD, EOWNERDEAD},
+	{syscall.EPERM, EPERM},
+	{syscall.EPFNOSUPPORT, EPFNOSUPPORT},
+	{syscall.EPIPE, EPIPE},
+	{syscall.EPROTO, EPROTO},
+	{syscall.EPROTONOSUPPORT, EPROTONOSUPPORT},
+	{syscall.EPROTOTYPE, EPROTOTYPE},
+	{syscall.ERANGE, ERANGE},
+	{syscall.EREMCHG, EREMCHG},
+	{syscall.EREMOTE, EREMOTE},
+	{syscall.EREMOTEIO, EREMOTEIO},
+	{syscall.ERESTART, ERESTART},
+	{syscall.ERFKILL, ERFKILL},
+	{syscall.EROFS, EROFS},
+	{syscall.ESHUTDOWN, ESHUTDOWN},
+	{syscall.ESOCKTNOSUPPORT, ESOCKTNOSUPPORT},
+	{syscall.ESPIPE, ESPIPE},
+	{syscall.ESRCH, ESRCH},
+	{syscall.ESRMNT, ESRMNT},
+	{syscall.ESTALE, ESTALE},
+	{syscall.ESTRPIPE, ESTRPIPE},
+	{syscall.ETIME, ETIME},
+	{syscall.ETIMEDOUT, ETIMEDOUT},
+	{syscall.ETOOMANYREFS, ETOOMANYREFS},
+	{syscall.ETXTBSY, ETXTBSY},
+	{syscall.EUCLEAN, EUCLEAN},
+	{syscall.EUNATCH, EUNATCH},
+	{syscall.EUSERS, EUSERS},
+	{syscall.EWOULDBLOCK, EWOULDBLOCK},
+	{syscall.EXDEV, EXDEV},
+	{syscall.EXFULL, EXFULL},
+}
@@ -0,0 +1,136 @@
+package proto9
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Extension messages are private message kinds enabled by a suffix on
+// the negotiated protocol version, a client requesting "9P2000.L.ourext"
+// enables the messages registered for the "ourext" extension.
+//
+// Extension messages are ordinary Fcall implementations, encdec-codegen
+// can generate their methods with the -types flag.
+
+var ErrKindInUse = errors.New("message kind already in use")
+
+var (
+	extensionsLock sync.RWMutex
+	extensions     = make(map[string]map[uint8]func() Fcall)
+)
+
+// Protocol dialects in order of preference when matching a prefix.
+var baseVersions = []string{"9P2000.L", "9P2000.u", "9P2000"}
+
+// RegisterFcall registers a message kind that is decoded with newFcall
+// when the extension ext has been negotiated.
+func RegisterFcall(ext string, kind uint8, newFcall func() Fcall) error {
+	if ext == "" || strings.Contains(ext, ".") {
+		return fmt.Errorf("invalid extension name %q", ext)
+	}
+	if _, err := FcallFromKind(kind); err == nil {
+		return ErrKindInUse
+	}
+
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+
+	kinds, ok := extensions[ext]
+	if !ok {
+		kinds = make(map[uint8]func() Fcall)
+		extensions[ext] = kinds
+	}
+	if _, ok := kinds[kind]; ok {
+		return ErrKindInUse
+	}
+	kinds[kind] = newFcall
+	return nil
+}
+
+// IsRegisteredExtension reports if any messages are registered for ext.
+func IsRegisteredExtension(ext string) bool {
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+	_, ok := extensions[ext]
+	return ok
+}
+
+// SplitVersion splits a version such as "9P2000.L.ourext" into the
+// base protocol version and the extension suffixes.
+func SplitVersion(version string) (string, []string) {
+	for _, base := range baseVersions {
+		if version == base {
+			return base, nil
+		}
+		if strings.HasPrefix(version, base+".") {
+			return base, strings.Split(version[len(base)+1:], ".")
+		}
+	}
+	return version, nil
+}
+
+// NegotiateVersion returns the version a server supporting dialects,
+// such as "9P2000.L", and the extensions exts should answer a Tversion
+// requesting version with. Unknown suffixes are dropped, and a client
+// requesting an unsupported dialect is offered "9P2000" if supported.
+func NegotiateVersion(version string, dialects []string, exts []string) string {
+	if !strings.HasPrefix(version, "9P") {
+		return "unknown"
+	}
+	base, requested := SplitVersion(version)
+	if !hasString(baseVersions, base) {
+		// Only the text before the first period names the version.
+		if i := strings.Index(version, "."); i != -1 {
+			base = version[:i]
+		}
+		requested = nil
+	}
+	if !hasString(dialects, base) {
+		if base != "9P2000" && strings.HasPrefix(base, "9P2000.") && hasString(dialects, "9P2000") {
+			return "9P2000"
+		}
+		return "unknown"
+	}
+	negotiated := base
+	for _, ext := range requested {
+		if hasString(exts, ext) {
+			negotiated += "." + ext
+		}
+	}
+	return negotiated
+}
+
+func hasString(strs []string, s string) bool {
+	for _, v := range strs {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FcallFromKindVersion is like FcallFromKind, but also returns
+// extension messages enabled by the negotiated version.
+func FcallFromKindVersion(kind uint8, version string) (Fcall, error) {
+	fc, err := FcallFromKind(kind)
+	if err == nil {
+		return fc, nil
+	}
+
+	_, exts := SplitVersion(version)
+	if len(exts) == 0 {
+		return nil, err
+	}
+
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+	for _, ext := range exts {
+		newFcall, ok := extensions[ext][kind]
+		if ok {
+			return newFcall(), nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,133 @@
+package proto9_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/andrewchambers/proto9-go"
+	"github.com/andrewchambers/proto9-go/internal/copyext"
+)
+
+func init() {
+	err := copyext.Register()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	base, exts := proto9.SplitVersion("9P2000.L.copy.other")
+	if base != "9P2000.L" || len(exts) != 2 || exts[0] != "copy" || exts[1] != "other" {
+		t.Fatalf("unexpected split %q %q", base, exts)
+	}
+	base, exts = proto9.SplitVersion("9P2000")
+	if base != "9P2000" || len(exts) != 0 {
+		t.Fatalf("unexpected split %q %q", base, exts)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version  string
+		dialects []string
+		expected string
+	}{
+		{"9P2000.L", []string{"9P2000.L"}, "9P2000.L"},
+		{"9P2000.L.copy.other", []string{"9P2000.L"}, "9P2000.L.copy"},
+		{"9P2000.u", []string{"9P2000.L"}, "unknown"},
+		{"9P2000.u", []string{"9P2000.L", "9P2000"}, "9P2000"},
+		{"9P2000.u", []string{"9P2000.u"}, "9P2000.u"},
+		{"9P2000.x.y", []string{"9P2000"}, "9P2000"},
+		{"9P2000", []string{"9P2000.L"}, "unknown"},
+		{"9P2001", []string{"9P2000.L"}, "unknown"},
+		{"foo", []string{"9P2000.L"}, "unknown"},
+	} {
+		negotiated := proto9.NegotiateVersion(tc.version, tc.dialects, []string{"copy"})
+		if negotiated != tc.expected {
+			t.Errorf("NegotiateVersion(%q, %q) = %q, expected %q", tc.version, tc.dialects, negotiated, tc.expected)
+		}
+	}
+}
+
+func TestRegisterFcallConflicts(t *testing.T) {
+	err := proto9.RegisterFcall("x", 110, func() proto9.Fcall { return &proto9.Twalk{} })
+	if !errors.Is(err, proto9.ErrKindInUse) {
+		t.Fatalf("expected builtin kind conflict, got %v", err)
+	}
+	err = proto9.RegisterFcall(copyext.Name, 200, func() proto9.Fcall { return &copyext.Tcopy{} })
+	if !errors.Is(err, proto9.ErrKindInUse) {
+		t.Fatalf("expected extension kind conflict, got %v", err)
+	}
+}
+
+func testExtensionClient(t *testing.T, version string) *proto9.Client {
+	fs := &proto9.DotLFilesystem{
+		Msize:      8192,
+		Extensions: []string{copyext.Name},
+		ExtensionFcall: func(ctx context.Context, fc proto9.Fcall) proto9.Fcall {
+			switch fc := fc.(type) {
+			case *copyext.Tcopy:
+				return &copyext.Rcopy{Count: fc.Count}
+			default:
+				return &proto9.Rlerror{Ecode: proto9.ENOSYS}
+			}
+		},
+	}
+
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proto9.ServeConn(c2, fs)
+	}()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		<-done
+	})
+
+	client, err := proto9.NewClient(c1, version, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestExtensionFcall(t *testing.T) {
+	client := testExtensionClient(t, "9P2000.L."+copyext.Name)
+
+	fc, err := client.Fcall(&copyext.Tcopy{Count: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcopy, ok := fc.(*copyext.Rcopy)
+	if !ok || rcopy.Count != 1234 {
+		t.Fatalf("unexpected response %s", fc)
+	}
+}
+
+func TestExtensionNotNegotiated(t *testing.T) {
+	// The server strips unsupported extensions from the version,
+	// so the client is told the version it actually got.
+	_, err := proto9.NewClient(func() net.Conn {
+		c1, c2 := net.Pipe()
+		go proto9.ServeConn(c2, &proto9.DotLFilesystem{Msize: 8192})
+		t.Cleanup(func() { _ = c1.Close() })
+		return c1
+	}(), "9P2000.L."+copyext.Name, 8192)
+	if err == nil {
+		t.Fatal("expected version negotiation to fail")
+	}
+
+	// Without the extension the server can't decode the message.
+	client := testExtensionClient(t, "9P2000.L")
+	fc, err := client.Fcall(&copyext.Tcopy{Count: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlerror, ok := fc.(*proto9.Rlerror)
+	if !ok || rlerror.Ecode != proto9.ENOSYS {
+		t.Fatalf("expected ENOSYS, got %s", fc)
+	}
+}
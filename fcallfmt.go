@@ -0,0 +1,116 @@
+package proto9
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Helpers for the generated String methods, the output is modelled
+// on the plan9port fcall format, e.g.
+//
+//   Twalk tag 3 fid 0 newfid 1 nwname 2 0:usr 1:bin
+
+const (
+	// Maximum number of payload bytes shown for Twrite/Rread data.
+	fmtDataMax = 64
+	// Maximum number of directory entries shown for Rreaddir.
+	fmtDirEntsMax = 8
+)
+
+// String formats a qid as (path version type).
+func (q *Qid) String() string {
+	var typ [8]byte
+	n := 0
+	for _, t := range []struct {
+		bit uint8
+		c   byte
+	}{
+		{QT_DIR, 'd'},
+		{QT_APPEND, 'a'},
+		{QT_EXCL, 'l'},
+		{QT_MOUNT, 'm'},
+		{QT_AUTH, 'A'},
+		{QT_TMP, 't'},
+		{QT_SYMLINK, 'L'},
+		{QT_LINK, 'h'},
+	} {
+		if q.Typ&t.bit != 0 {
+			typ[n] = t.c
+			n += 1
+		}
+	}
+	return fmt.Sprintf("(%016x %d %s)", q.Path, q.Version, string(typ[:n]))
+}
+
+func fmtUint(b *strings.Builder, name string, v uint64) {
+	fmt.Fprintf(b, " %s %d", name, v)
+}
+
+func fmtOctal(b *strings.Builder, name string, v uint64) {
+	fmt.Fprintf(b, " %s %#o", name, v)
+}
+
+func fmtHex(b *strings.Builder, name string, v uint64) {
+	fmt.Fprintf(b, " %s %#x", name, v)
+}
+
+func fmtString(b *strings.Builder, name string, v string) {
+	fmt.Fprintf(b, " %s %s", name, v)
+}
+
+func fmtStrings(b *strings.Builder, name string, v []string) {
+	fmt.Fprintf(b, " %s %d", name, len(v))
+	for i, s := range v {
+		fmt.Fprintf(b, " %d:%s", i, s)
+	}
+}
+
+func fmtQid(b *strings.Builder, name string, q *Qid) {
+	fmt.Fprintf(b, " %s %s", name, q.String())
+}
+
+func fmtQids(b *strings.Builder, name string, v []Qid) {
+	fmt.Fprintf(b, " %s %d", name, len(v))
+	for i := range v {
+		fmt.Fprintf(b, " %d:%s", i, v[i].String())
+	}
+}
+
+func fmtDirEnts(b *strings.Builder, v []DirEnt) {
+	fmt.Fprintf(b, " ndirent %d", len(v))
+	for i := range v {
+		if i == fmtDirEntsMax {
+			b.WriteString(" ...")
+			break
+		}
+		fmt.Fprintf(b, " %d:%s%s off %d", i, v[i].Name, v[i].Qid.String(), v[i].Offset)
+	}
+}
+
+// fmtData prints the count and a truncated dump of the data,
+// as text if it is printable and hex otherwise.
+func fmtData(b *strings.Builder, v []byte) {
+	fmt.Fprintf(b, " count %d", len(v))
+	if len(v) == 0 {
+		return
+	}
+	data := v
+	if len(data) > fmtDataMax {
+		data = data[:fmtDataMax]
+	}
+	printable := true
+	for _, c := range data {
+		if c < 0x20 || c > 0x7e {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		fmt.Fprintf(b, " '%s'", data)
+	} else {
+		fmt.Fprintf(b, " %x", data)
+	}
+	if len(data) != len(v) {
+		b.WriteString("...")
+	}
+}
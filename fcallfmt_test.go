@@ -0,0 +1,70 @@
+package proto9
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFcallString(t *testing.T) {
+	cases := []struct {
+		fc       Fcall
+		expected string
+	}{
+		{
+			&Twalk{Tagged: Tagged{Tag: 3}, Fid: 0, NewFid: 1, Wnames: []string{"usr", "bin"}},
+			"Twalk tag 3 fid 0 newfid 1 nwname 2 0:usr 1:bin",
+		},
+		{
+			&Rwalk{Tagged: Tagged{Tag: 3}, WQids: []Qid{{Typ: QT_DIR, Version: 2, Path: 0x1234}}},
+			"Rwalk tag 3 nwqid 1 0:(0000000000001234 2 d)",
+		},
+		{
+			&Rread{Tagged: Tagged{Tag: 1}, Data: []byte("hello")},
+			"Rread tag 1 count 5 'hello'",
+		},
+		{
+			&Twrite{Tagged: Tagged{Tag: 1}, Fid: 2, Offset: 3, Data: []byte{0, 1, 0xff}},
+			"Twrite tag 1 fid 2 offset 3 count 3 0001ff",
+		},
+		{
+			&Tlcreate{Tagged: Tagged{Tag: 4}, Fid: 1, Name: "x", Flags: 2, Mode: 0o644, Gid: 5},
+			"Tlcreate tag 4 fid 1 name x flags 0x2 mode 0644 gid 5",
+		},
+		{
+			&Rlerror{Tagged: Tagged{Tag: 9}, Ecode: ENOENT},
+			"Rlerror tag 9 ecode 2",
+		},
+	}
+
+	for _, tc := range cases {
+		s := tc.fc.String()
+		if s != tc.expected {
+			t.Fatalf("got %q, expected %q", s, tc.expected)
+		}
+	}
+}
+
+func TestFcallStringTruncatesData(t *testing.T) {
+	fc := &Rread{Data: bytes.Repeat([]byte{'x'}, 4096)}
+	s := fc.String()
+	if !strings.HasPrefix(s, "Rread tag 0 count 4096 'xxxx") || !strings.HasSuffix(s, "'...") {
+		t.Fatalf("unexpected format: %q", s)
+	}
+	if len(s) > 128 {
+		t.Fatalf("data was not truncated: %q", s)
+	}
+}
+
+func TestFcallStringAllKinds(t *testing.T) {
+	for i := 0; i <= 0xff; i++ {
+		fc, err := FcallFromKind(byte(i))
+		if err != nil {
+			continue
+		}
+		s := fc.String()
+		if !strings.HasPrefix(s, "T") && !strings.HasPrefix(s, "R") {
+			t.Fatalf("unexpected format for kind %d: %q", i, s)
+		}
+	}
+}
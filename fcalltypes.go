@@ -2,7 +2,6 @@ package proto9
 
 import (
 	"bytes"
-	"fmt"
 )
 
 type Fcall interface {
@@ -12,6 +11,8 @@ type Fcall interface {
 	EncodedSize() uint64
 	Encode(*bytes.Buffer) error
 	Decode(*bytes.Buffer) error
+	String() string
+	Validate(msize uint32) error
 }
 
 type Tagged struct {
@@ -61,12 +62,12 @@ type Twalk struct {
 	Tagged
 	Fid    uint32
 	NewFid uint32
-	Wnames []string
+	Wnames []string `validate:"name,maxwelem"`
 }
 
 type Rwalk struct {
 	Tagged
-	WQids []Qid
+	WQids []Qid `validate:"maxwelem"`
 }
 
 type Tread struct {
@@ -180,7 +181,7 @@ type Rlopen struct {
 type Tlcreate struct {
 	Tagged
 	Fid   uint32
-	Name  string
+	Name  string `validate:"name"`
 	Flags uint32
 	Mode  uint32
 	Gid   uint32
@@ -195,7 +196,7 @@ type Rlcreate struct {
 type Tsymlink struct {
 	Tagged
 	Fid    uint32
-	Name   string
+	Name   string `validate:"name"`
 	Target string
 	Gid    uint32
 }
@@ -208,7 +209,8 @@ type Rsymlink struct {
 type Tmknod struct {
 	Tagged
 	Fid   uint32
-	Name  string
+	Name  string `validate:"name"`
+	Mode  uint32
 	Major uint32
 	Minor uint32
 	Gid   uint32
@@ -223,7 +225,7 @@ type Trename struct {
 	Tagged
 	Fid  uint32
 	Dfid uint32
-	Name string
+	Name string `validate:"name"`
 }
 
 type Rrename struct {
@@ -391,7 +393,7 @@ type Tlink struct {
 	Tagged
 	Dfid uint32
 	Fid  uint32
-	Name string
+	Name string `validate:"name"`
 }
 
 type Rlink struct {
@@ -401,7 +403,7 @@ type Rlink struct {
 type Tmkdir struct {
 	Tagged
 	Dfid uint32
-	Name string
+	Name string `validate:"name"`
 	Mode uint32
 	Gid  uint32
 }
@@ -414,9 +416,9 @@ type Rmkdir struct {
 type Trenameat struct {
 	Tagged
 	OldDfid uint32
-	OldName string
+	OldName string `validate:"name"`
 	NewDfid uint32
-	NewName string
+	NewName string `validate:"name"`
 }
 
 type Rrenameat struct {
@@ -426,7 +428,7 @@ type Rrenameat struct {
 type Tunlinkat struct {
 	Tagged
 	Dfid  uint32
-	Name  string
+	Name  string `validate:"name"`
 	Flags uint32
 }
 
@@ -573,7 +575,7 @@ func FcallFromKind(kind uint8) (Fcall, error) {
 	// case 126:
 	//	return &Rwstat{}, nil
 	default:
-		return nil, fmt.Errorf("unknown message kind: %d", kind)
+		return nil, &UnknownKindError{Kind: kind}
 	}
 }
 
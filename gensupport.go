@@ -0,0 +1,52 @@
+package proto9
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Exported forms of the encoding, formatting and validation helpers,
+// these are called by code that encdec-codegen generates for
+// extension messages defined outside this package.
+
+func EncodeByte(b *bytes.Buffer, v byte) error            { return encodeByte(b, v) }
+func EncodeUint8(b *bytes.Buffer, v uint8) error          { return encodeUint8(b, v) }
+func EncodeUint16(b *bytes.Buffer, v uint16) error        { return encodeUint16(b, v) }
+func EncodeUint32(b *bytes.Buffer, v uint32) error        { return encodeUint32(b, v) }
+func EncodeUint64(b *bytes.Buffer, v uint64) error        { return encodeUint64(b, v) }
+func EncodeString(b *bytes.Buffer, v string) error        { return encodeString(b, v) }
+func EncodeStringSlice(b *bytes.Buffer, v []string) error { return encodeStringSlice(b, v) }
+func EncodeByteSlice(b *bytes.Buffer, v []byte) error     { return encodeByteSlice(b, v) }
+func EncodeDirEntSlice(b *bytes.Buffer, v []DirEnt) error { return encodeDirEntSlice(b, v) }
+func EncodeQids(b *bytes.Buffer, v []Qid) error           { return encodeQids(b, v) }
+
+func DecodeByte(b *bytes.Buffer) (byte, error)            { return decodeByte(b) }
+func DecodeUint8(b *bytes.Buffer) (uint8, error)          { return decodeUint8(b) }
+func DecodeUint16(b *bytes.Buffer) (uint16, error)        { return decodeUint16(b) }
+func DecodeUint32(b *bytes.Buffer) (uint32, error)        { return decodeUint32(b) }
+func DecodeUint64(b *bytes.Buffer) (uint64, error)        { return decodeUint64(b) }
+func DecodeString(b *bytes.Buffer) (string, error)        { return decodeString(b) }
+func DecodeStringSlice(b *bytes.Buffer) ([]string, error) { return decodeStringSlice(b) }
+func DecodeByteSlice(b *bytes.Buffer) ([]byte, error)     { return decodeByteSlice(b) }
+func DecodeDirEntSlice(b *bytes.Buffer) ([]DirEnt, error) { return decodeDirEntSlice(b) }
+func DecodeQids(b *bytes.Buffer) ([]Qid, error)           { return decodeQids(b) }
+
+func FormatUint(b *strings.Builder, name string, v uint64)      { fmtUint(b, name, v) }
+func FormatOctal(b *strings.Builder, name string, v uint64)     { fmtOctal(b, name, v) }
+func FormatHex(b *strings.Builder, name string, v uint64)       { fmtHex(b, name, v) }
+func FormatString(b *strings.Builder, name string, v string)    { fmtString(b, name, v) }
+func FormatStrings(b *strings.Builder, name string, v []string) { fmtStrings(b, name, v) }
+func FormatQid(b *strings.Builder, name string, q *Qid)         { fmtQid(b, name, q) }
+func FormatQids(b *strings.Builder, name string, v []Qid)       { fmtQids(b, name, v) }
+func FormatDirEnts(b *strings.Builder, v []DirEnt)              { fmtDirEnts(b, v) }
+func FormatData(b *strings.Builder, v []byte)                   { fmtData(b, v) }
+
+func ValidateSize(fcall string, encodedSize uint64, msize uint32) error {
+	return validateSize(fcall, encodedSize, msize)
+}
+func ValidateString(fcall, field, v string) error           { return validateString(fcall, field, v) }
+func ValidateName(fcall, field, v string) error             { return validateName(fcall, field, v) }
+func ValidateMaxWelem(fcall, field string, n int) error     { return validateMaxWelem(fcall, field, n) }
+func ValidateStrings(fcall, field string, v []string) error { return validateStrings(fcall, field, v) }
+func ValidateNames(fcall, field string, v []string) error   { return validateNames(fcall, field, v) }
+func ValidateDirEnts(fcall, field string, v []DirEnt) error { return validateDirEnts(fcall, field, v) }
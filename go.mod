@@ -1,9 +1,12 @@
 module github.com/andrewchambers/proto9-go
 
-go 1.16
+go 1.18
 
 require (
-	github.com/google/gofuzz v1.2.0 // indirect
-	github.com/hanwen/go-fuse/v2 v2.1.0 // indirect
-	golang.org/x/tools v0.1.12 // indirect
+	github.com/google/gofuzz v1.2.0
+	github.com/hanwen/go-fuse/v2 v2.1.0
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f
+	golang.org/x/tools v0.1.12
 )
+
+require golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
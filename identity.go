@@ -0,0 +1,211 @@
+package proto9
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Credential is the identity requests on a fid are made as.
+type Credential struct {
+	Uname string
+	Uid   uint32
+	Gid   uint32
+	// Supplementary groups.
+	Groups []uint32
+}
+
+// InGroup reports whether gid is the primary or a supplementary
+// group of the credential.
+func (c *Credential) InGroup(gid uint32) bool {
+	if c.Gid == gid {
+		return true
+	}
+	for _, g := range c.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+type credentialKey struct{}
+
+// WithCredential returns a context carrying cred.
+func WithCredential(ctx context.Context, cred *Credential) context.Context {
+	return context.WithValue(ctx, credentialKey{}, cred)
+}
+
+// CredentialFromContext returns the credential of the request,
+// if the filesystem has a UserDB.
+func CredentialFromContext(ctx context.Context) (*Credential, bool) {
+	cred, ok := ctx.Value(credentialKey{}).(*Credential)
+	return cred, ok
+}
+
+// UserDB maps the user of a Tattach to a credential.
+//
+// Clients such as Linux send the uid as nuname, with a uname that may
+// not identify the user, so nuname is preferred unless it is NONUNAME.
+type UserDB interface {
+	Lookup(uname string, nuname uint32) (*Credential, error)
+}
+
+// NumericUserDB trusts the uid sent by clients, either as nuname or as
+// a decimal uname. Users are given the group with the same id, as with
+// user private groups.
+type NumericUserDB struct{}
+
+func (NumericUserDB) Lookup(uname string, nuname uint32) (*Credential, error) {
+	uid := nuname
+	if uid == NONUNAME {
+		n, err := strconv.ParseUint(uname, 10, 32)
+		if err != nil || uint32(n) == NONUNAME {
+			return nil, &Rlerror{Ecode: EACCES}
+		}
+		uid = uint32(n)
+	}
+	return &Credential{
+		Uname: strconv.FormatUint(uint64(uid), 10),
+		Uid:   uid,
+		Gid:   uid,
+	}, nil
+}
+
+// StaticUserDB is a fixed set of users keyed by name.
+type StaticUserDB map[string]Credential
+
+func (db StaticUserDB) Lookup(uname string, nuname uint32) (*Credential, error) {
+	if nuname != NONUNAME {
+		for name, cred := range db {
+			if cred.Uid == nuname {
+				cred.Uname = name
+				return &cred, nil
+			}
+		}
+		return nil, &Rlerror{Ecode: EACCES}
+	}
+	cred, ok := db[uname]
+	if !ok {
+		return nil, &Rlerror{Ecode: EACCES}
+	}
+	cred.Uname = uname
+	return &cred, nil
+}
+
+// PasswdUserDB holds the users of passwd and group files.
+type PasswdUserDB struct {
+	byName map[string]*Credential
+	byUid  map[uint32]*Credential
+}
+
+// LoadPasswd reads users from passwd and group files such as
+// /etc/passwd and /etc/group, groupPath may be empty.
+func LoadPasswd(passwdPath string, groupPath string) (*PasswdUserDB, error) {
+	passwd, err := os.Open(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+	defer passwd.Close()
+	var group io.Reader
+	if groupPath != "" {
+		f, err := os.Open(groupPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		group = f
+	}
+	return ParsePasswd(passwd, group)
+}
+
+// ParsePasswd parses users in the passwd(5) format and their
+// supplementary groups in the group(5) format, group may be nil.
+func ParsePasswd(passwd io.Reader, group io.Reader) (*PasswdUserDB, error) {
+	db := &PasswdUserDB{
+		byName: make(map[string]*Credential),
+		byUid:  make(map[uint32]*Credential),
+	}
+	err := parseColonFile(passwd, 7, func(fields []string) error {
+		uid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return err
+		}
+		cred := &Credential{Uname: fields[0], Uid: uint32(uid), Gid: uint32(gid)}
+		db.byName[cred.Uname] = cred
+		if _, ok := db.byUid[cred.Uid]; !ok {
+			db.byUid[cred.Uid] = cred
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing passwd: %w", err)
+	}
+	if group == nil {
+		return db, nil
+	}
+	err = parseColonFile(group, 4, func(fields []string) error {
+		gid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return err
+		}
+		for _, member := range strings.Split(fields[3], ",") {
+			cred, ok := db.byName[member]
+			if ok && !cred.InGroup(uint32(gid)) {
+				cred.Groups = append(cred.Groups, uint32(gid))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing group: %w", err)
+	}
+	return db, nil
+}
+
+// parseColonFile calls f with the fields of each line of r,
+// skipping blank lines and comments.
+func parseColonFile(r io.Reader, nfields int, f func(fields []string) error) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ":")
+		if len(fields) != nfields {
+			return fmt.Errorf("line %d: expected %d fields, got %d", line, nfields, len(fields))
+		}
+		err := f(fields)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (db *PasswdUserDB) Lookup(uname string, nuname uint32) (*Credential, error) {
+	var cred *Credential
+	var ok bool
+	if nuname != NONUNAME {
+		cred, ok = db.byUid[nuname]
+	} else {
+		cred, ok = db.byName[uname]
+	}
+	if !ok {
+		return nil, &Rlerror{Ecode: EACCES}
+	}
+	c := *cred
+	c.Groups = append([]uint32(nil), cred.Groups...)
+	return &c, nil
+}
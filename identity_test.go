@@ -0,0 +1,303 @@
+package proto9
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePasswd(t *testing.T) {
+	passwd := `# users
+root:x:0:0:root:/root:/bin/sh
+alice:x:1000:1000::/home/alice:/bin/sh
+
+bob:x:1001:1001::/home/bob:/bin/sh
+`
+	group := `root:x:0:
+alice:x:1000:
+wheel:x:10:alice,bob
+audio:x:29:bob
+`
+	db, err := ParsePasswd(strings.NewReader(passwd), strings.NewReader(group))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := db.Lookup("bob", NONUNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Credential{Uname: "bob", Uid: 1001, Gid: 1001, Groups: []uint32{10, 29}}
+	if !reflect.DeepEqual(cred, expected) {
+		t.Fatalf("unexpected credential %#v", cred)
+	}
+	// The uid is preferred to the name.
+	cred, err = db.Lookup("nobody", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Uname != "alice" || !cred.InGroup(10) || cred.InGroup(29) {
+		t.Fatalf("unexpected credential %#v", cred)
+	}
+	_, err = db.Lookup("mallory", NONUNAME)
+	expectRlerror(t, err, EACCES)
+
+	_, err = ParsePasswd(strings.NewReader("root:x:0:0\n"), nil)
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestUserDBs(t *testing.T) {
+	cred, err := NumericUserDB{}.Lookup("", 1000)
+	if err != nil || cred.Uid != 1000 || cred.Gid != 1000 {
+		t.Fatalf("unexpected credential %#v %v", cred, err)
+	}
+	cred, err = NumericUserDB{}.Lookup("1001", NONUNAME)
+	if err != nil || cred.Uid != 1001 {
+		t.Fatalf("unexpected credential %#v %v", cred, err)
+	}
+	_, err = NumericUserDB{}.Lookup("alice", NONUNAME)
+	expectRlerror(t, err, EACCES)
+
+	db := StaticUserDB{"alice": {Uid: 1000, Gid: 100}}
+	cred, err = db.Lookup("", 1000)
+	if err != nil || cred.Uname != "alice" || cred.Gid != 100 {
+		t.Fatalf("unexpected credential %#v %v", cred, err)
+	}
+	_, err = db.Lookup("bob", NONUNAME)
+	expectRlerror(t, err, EACCES)
+}
+
+// Create a ramfs enforcing permissions, returning a function to
+// attach to it as a user.
+func newPermTestFS(t *testing.T) (*RamFS, func(uname string) *ClientDotLFile) {
+	fs := NewRamFS()
+	fs.Users = StaticUserDB{
+		"root":  {Uid: 0, Gid: 0},
+		"alice": {Uid: 1000, Gid: 1000},
+		"bob":   {Uid: 1001, Gid: 1001, Groups: []uint32{1000}},
+		"eve":   {Uid: 1002, Gid: 1002},
+	}
+	attach := func(uname string) *ClientDotLFile {
+		client := newPipeTestClient(t, fs.NewFilesystem())
+		f, _, err := AttachDotL(client, "", uname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Clunk() })
+		return f
+	}
+	return fs, attach
+}
+
+func TestCheckPermissions(t *testing.T) {
+	fs, attach := newPermTestFS(t)
+	client := newPipeTestClient(t, fs.NewFilesystem())
+	_, _, err := AttachDotL(client, "", "mallory")
+	expectRlerror(t, err, EACCES)
+
+	root := attach("root")
+	_, err = root.Mkdir("private", 0o700, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := attach("alice")
+	_, _, err = walkRamFS(t, alice, "private").Walk([]string{"x"})
+	expectRlerror(t, err, EACCES)
+	_, err = walkRamFS(t, alice, "private").Mkdir("x", 0o755, 1000)
+	expectRlerror(t, err, EACCES)
+
+	// Alice creates a file bob may read through his group.
+	_, err = alice.Mkdir("shared", 0o755, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = walkRamFS(t, alice, "shared").Create("f", L_O_RDWR, 0o640, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := attach("bob")
+	bf := walkRamFS(t, bob, "shared", "f")
+	err = bf.Open(L_O_RDWR)
+	expectRlerror(t, err, EACCES)
+	err = walkRamFS(t, bob, "shared", "f").Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = walkRamFS(t, bob, "shared").Create("g", L_O_RDWR, 0o644, 1001)
+	expectRlerror(t, err, EACCES)
+
+	eve := attach("eve")
+	ef := walkRamFS(t, eve, "shared", "f")
+	err = ef.Open(L_O_RDONLY)
+	expectRlerror(t, err, EACCES)
+	err = ef.SetAttr(LSetAttr{Valid: L_SETATTR_MODE, Mode: 0o777})
+	expectRlerror(t, err, EPERM)
+	err = bf.SetAttr(LSetAttr{Valid: L_SETATTR_SIZE, Size: 0})
+	expectRlerror(t, err, EACCES)
+	af := walkRamFS(t, alice, "shared", "f")
+	err = af.SetAttr(LSetAttr{Valid: L_SETATTR_GID, Gid: 1001})
+	expectRlerror(t, err, EPERM)
+	err = af.SetAttr(LSetAttr{Valid: L_SETATTR_MODE, Mode: 0o644})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ef.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckPermissionsRemoval(t *testing.T) {
+	_, attach := newPermTestFS(t)
+	alice := attach("alice")
+	eve := attach("eve")
+
+	_, err := alice.Mkdir("shared", 0o755, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = walkRamFS(t, alice, "shared").Create("f", L_O_RDWR, 0o644, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Removing a walked fid needs write access to the directory.
+	err = walkRamFS(t, eve, "shared", "f").Remove()
+	expectRlerror(t, err, EACCES)
+	err = walkRamFS(t, eve, "shared", "f").Rename(eve, "stolen")
+	expectRlerror(t, err, EACCES)
+	err = walkRamFS(t, eve, "shared").Unlinkat("f", 0)
+	expectRlerror(t, err, EACCES)
+
+	// The root is sticky, so only owners may remove its entries.
+	_, _, err = walkRamFS(t, alice).Create("af", L_O_RDWR, 0o666, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = eve.Unlinkat("af", 0)
+	expectRlerror(t, err, EPERM)
+	err = eve.Renameat("af", eve, "ef")
+	expectRlerror(t, err, EPERM)
+	err = walkRamFS(t, eve, "af").Rename(eve, "ef")
+	expectRlerror(t, err, EPERM)
+	err = walkRamFS(t, eve, "af").Remove()
+	expectRlerror(t, err, EPERM)
+	_, _, err = walkRamFS(t, eve).Create("ef", L_O_RDWR, 0o666, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = eve.Renameat("ef", eve, "af")
+	expectRlerror(t, err, EPERM)
+	err = alice.Renameat("af", alice, "af2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, alice, "af2").Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckPermissionsXattrs(t *testing.T) {
+	_, attach := newPermTestFS(t)
+	alice := attach("alice")
+	eve := attach("eve")
+	_, _, err := walkRamFS(t, alice).Create("f", L_O_RDWR, 0o644, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, eve, "f").XattrCreate("user.x", 1, 0)
+	expectRlerror(t, err, EACCES)
+	err = walkRamFS(t, alice, "f").XattrCreate("trusted.x", 1, 0)
+	expectRlerror(t, err, EPERM)
+	err = walkRamFS(t, alice, "f").XattrCreate("user.x", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, attach("root"), "f").XattrCreate("trusted.x", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckPermissionsAttach(t *testing.T) {
+	fs, attach := newPermTestFS(t)
+	root := attach("root")
+	_, err := root.Mkdir("private", 0o700, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = walkRamFS(t, root, "private").Mkdir("x", 0o777, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeTestClient(t, fs.NewFilesystem())
+	_, _, err = AttachDotL(client, "private/x", "alice")
+	expectRlerror(t, err, EACCES)
+}
+
+func TestCheckPermissionsNewGid(t *testing.T) {
+	_, attach := newPermTestFS(t)
+	root := attach("root")
+	alice := attach("alice")
+	expectGid := func(f *ClientDotLFile, gid uint32, mode uint32) {
+		t.Helper()
+		attr, err := f.GetAttr(L_GETATTR_BASIC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attr.Gid != gid || attr.Mode&0o7777 != mode {
+			t.Fatalf("unexpected gid %d and mode %o", attr.Gid, attr.Mode)
+		}
+	}
+
+	// The gid from the client is ignored.
+	_, err := alice.Mkdir("d", 0o755, 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid(walkRamFS(t, alice, "d"), 1000, 0o755)
+
+	// Files in setgid directories take the group of the directory.
+	_, err = root.Mkdir("sg", 0o777, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, root, "sg").SetAttr(LSetAttr{Valid: L_SETATTR_MODE | L_SETATTR_GID, Mode: L_S_ISGID | 0o777, Gid: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = walkRamFS(t, alice, "sg").Create("f", L_O_RDWR, 0o644, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid(walkRamFS(t, alice, "sg", "f"), 50, 0o644)
+	_, err = walkRamFS(t, alice, "sg").Mkdir("d", 0o755, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid(walkRamFS(t, alice, "sg", "d"), 50, L_S_ISGID|0o755)
+}
+
+func TestCheckAccess(t *testing.T) {
+	attr := LAttr{Mode: L_S_IFREG | 0o640, Uid: 1000, Gid: 100}
+	cases := []struct {
+		cred Credential
+		want uint32
+		ok   bool
+	}{
+		{Credential{Uid: 1000, Gid: 1}, MayRead | MayWrite, true},
+		{Credential{Uid: 1000, Gid: 100}, MayExec, false},
+		{Credential{Uid: 1, Gid: 100}, MayRead, true},
+		{Credential{Uid: 1, Gid: 1, Groups: []uint32{100}}, MayWrite, false},
+		{Credential{Uid: 1, Gid: 1}, MayRead, false},
+		{Credential{Uid: 0, Gid: 0}, MayRead | MayWrite, true},
+		{Credential{Uid: 0, Gid: 0}, MayExec, false},
+	}
+	for i, c := range cases {
+		err := CheckAccess(&c.cred, attr, c.want)
+		if (err == nil) != c.ok {
+			t.Fatalf("case %d: unexpected result %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package copyext
+
+import (
+	"bytes"
+	"strings"
+
+	proto9 "github.com/andrewchambers/proto9-go"
+)
+
+func (v *Rcopy) EncodedSize() uint64 {
+	sz := uint64(0)
+	sz += v.Tagged.EncodedSize()
+	sz += 8 // Count
+	return sz
+}
+
+func (v *Rcopy) Encode(b *bytes.Buffer) error {
+	var err error
+	err = v.Tagged.Encode(b)
+	if err != nil {
+		return err
+	}
+	err = proto9.EncodeUint64(b, v.Count)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Rcopy) Decode(b *bytes.Buffer) error {
+	var err error
+	err = v.Tagged.Decode(b)
+	if err != nil {
+		return err
+	}
+	v.Count, err = proto9.DecodeUint64(b)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Rcopy) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Rcopy")
+	proto9.FormatUint(b, "tag", uint64(v.Tagged.Tag))
+	proto9.FormatUint(b, "count", uint64(v.Count))
+	return b.String()
+}
+
+func (v *Rcopy) Validate(msize uint32) error {
+	var err error
+	err = proto9.ValidateSize("Rcopy", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Tcopy) EncodedSize() uint64 {
+	sz := uint64(0)
+	sz += v.Tagged.EncodedSize()
+	sz += 4 // SrcFid
+	sz += 8 // SrcOffset
+	sz += 4 // DstFid
+	sz += 8 // DstOffset
+	sz += 8 // Count
+	return sz
+}
+
+func (v *Tcopy) Encode(b *bytes.Buffer) error {
+	var err error
+	err = v.Tagged.Encode(b)
+	if err != nil {
+		return err
+	}
+	err = proto9.EncodeUint32(b, v.SrcFid)
+	if err != nil {
+		return err
+	}
+	err = proto9.EncodeUint64(b, v.SrcOffset)
+	if err != nil {
+		return err
+	}
+	err = proto9.EncodeUint32(b, v.DstFid)
+	if err != nil {
+		return err
+	}
+	err = proto9.EncodeUint64(b, v.DstOffset)
+	if err != nil {
+		return err
+	}
+	err = proto9.EncodeUint64(b, v.Count)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Tcopy) Decode(b *bytes.Buffer) error {
+	var err error
+	err = v.Tagged.Decode(b)
+	if err != nil {
+		return err
+	}
+	v.SrcFid, err = proto9.DecodeUint32(b)
+	if err != nil {
+		return err
+	}
+	v.SrcOffset, err = proto9.DecodeUint64(b)
+	if err != nil {
+		return err
+	}
+	v.DstFid, err = proto9.DecodeUint32(b)
+	if err != nil {
+		return err
+	}
+	v.DstOffset, err = proto9.DecodeUint64(b)
+	if err != nil {
+		return err
+	}
+	v.Count, err = proto9.DecodeUint64(b)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v *Tcopy) String() string {
+	b := &strings.Builder{}
+	b.WriteString("Tcopy")
+	proto9.FormatUint(b, "tag", uint64(v.Tagged.Tag))
+	proto9.FormatUint(b, "srcfid", uint64(v.SrcFid))
+	proto9.FormatUint(b, "srcoffset", uint64(v.SrcOffset))
+	proto9.FormatUint(b, "dstfid", uint64(v.DstFid))
+	proto9.FormatUint(b, "dstoffset", uint64(v.DstOffset))
+	proto9.FormatUint(b, "count", uint64(v.Count))
+	return b.String()
+}
+
+func (v *Tcopy) Validate(msize uint32) error {
+	var err error
+	err = proto9.ValidateSize("Tcopy", v.EncodedSize(), msize)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Package copyext is an example extension adding a server side copy
+// message, it is used to test extension support.
+package copyext
+
+//go:generate go run ../../cmd/encdec-codegen -types copyext.go github.com/andrewchambers/proto9-go/internal/copyext copyext.gen.go
+//go:generate gofmt -w copyext.gen.go
+
+import (
+	"github.com/andrewchambers/proto9-go"
+)
+
+const Name = "copy"
+
+type Tcopy struct {
+	proto9.Tagged
+	SrcFid    uint32
+	SrcOffset uint64
+	DstFid    uint32
+	DstOffset uint64
+	Count     uint64
+}
+
+type Rcopy struct {
+	proto9.Tagged
+	Count uint64
+}
+
+func (m *Tcopy) Kind() uint8 { return 200 }
+func (m *Rcopy) Kind() uint8 { return 201 }
+
+func Register() error {
+	err := proto9.RegisterFcall(Name, 200, func() proto9.Fcall { return &Tcopy{} })
+	if err != nil {
+		return err
+	}
+	return proto9.RegisterFcall(Name, 201, func() proto9.Fcall { return &Rcopy{} })
+}
@@ -0,0 +1,375 @@
+package proto9
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// IOFS exports an fs.FS, such as an embed.FS, as a read only
+// filesystem. Requests that would modify it fail with EROFS.
+type IOFS struct {
+	fsys fs.FS
+}
+
+func NewIOFS(fsys fs.FS) *IOFS {
+	return &IOFS{fsys: fsys}
+}
+
+// NewFilesystem returns a Filesystem for serving a single
+// connection, it may be passed directly to Serve.
+func (iofs *IOFS) NewFilesystem() Filesystem {
+	return &DotLFilesystem{
+		Msize:  128*1024 + IOHDRSZ,
+		Attach: iofs.attach,
+	}
+}
+
+func (iofs *IOFS) attach(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+	root := &IOFSFile{iofs: iofs, path: "."}
+	names := []string{}
+	for _, name := range strings.Split(fc.Aname, "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	qids, f, err := root.Walk(ctx, names)
+	if err != nil {
+		return nil, Qid{}, err
+	}
+	if len(qids) != len(names) {
+		return nil, Qid{}, &Rlerror{Ecode: ENOENT}
+	}
+	info, err := iofs.stat(".")
+	if err != nil {
+		return nil, Qid{}, err
+	}
+	if len(qids) != 0 {
+		return f, qids[len(qids)-1], nil
+	}
+	return f, iofsQid(".", info.Mode()), nil
+}
+
+func (iofs *IOFS) stat(p string) (fs.FileInfo, error) {
+	return fs.Stat(iofs.fsys, p)
+}
+
+// iofsQid derives a qid from the path, which never changes
+// as the filesystem is read only.
+func iofsQid(p string, mode fs.FileMode) Qid {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(p))
+	return Qid{
+		Typ:  ModeToQidType(fileModeToDotL(mode)),
+		Path: h.Sum64(),
+	}
+}
+
+func fileModeToDotL(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 0o1000
+	}
+	switch {
+	case mode.IsDir():
+		m |= L_S_IFDIR
+	case mode&fs.ModeSymlink != 0:
+		m |= L_S_IFLNK
+	case mode&fs.ModeNamedPipe != 0:
+		m |= L_S_IFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= L_S_IFSOCK
+	case mode&fs.ModeCharDevice != 0:
+		m |= L_S_IFCHR
+	case mode&fs.ModeDevice != 0:
+		m |= L_S_IFBLK
+	default:
+		m |= L_S_IFREG
+	}
+	return m
+}
+
+func fileModeToDirentType(mode fs.FileMode) uint8 {
+	return modeToDirentType(fileModeToDotL(mode))
+}
+
+func modeToDirentType(mode uint32) uint8 {
+	switch mode & L_S_IFMT {
+	case L_S_IFDIR:
+		return L_DT_DIR
+	case L_S_IFLNK:
+		return L_DT_LNK
+	case L_S_IFIFO:
+		return L_DT_FIFO
+	case L_S_IFSOCK:
+		return L_DT_SOCK
+	case L_S_IFCHR:
+		return L_DT_CHR
+	case L_S_IFBLK:
+		return L_DT_BLK
+	default:
+		return L_DT_REG
+	}
+}
+
+// IOFSFile is a fid of an IOFS.
+type IOFSFile struct {
+	iofs *IOFS
+	path string
+
+	lock sync.Mutex
+	file fs.File
+	// Read position of file, for files that cannot seek.
+	pos     int64
+	dirents []DirEnt
+}
+
+func (f *IOFSFile) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	qids := make([]Qid, 0, len(names))
+	p := f.path
+	for _, name := range names {
+		info, err := f.iofs.stat(p)
+		if err != nil {
+			return qids, nil, err
+		}
+		if !info.IsDir() {
+			return qids, nil, &Rlerror{Ecode: ENOTDIR}
+		}
+		switch name {
+		case ".":
+		case "..":
+			p = path.Dir(p)
+		default:
+			p = path.Join(p, name)
+		}
+		info, err = f.iofs.stat(p)
+		if err != nil {
+			return qids, nil, err
+		}
+		qids = append(qids, iofsQid(p, info.Mode()))
+	}
+	return qids, &IOFSFile{iofs: f.iofs, path: p}, nil
+}
+
+func (f *IOFSFile) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	info, err := f.iofs.stat(f.path)
+	if err != nil {
+		return LAttr{}, err
+	}
+	size := uint64(info.Size())
+	nlink := uint64(1)
+	if info.IsDir() {
+		nlink = 2
+	}
+	mtime := info.ModTime()
+	return LAttr{
+		Valid:     L_GETATTR_BASIC,
+		Qid:       iofsQid(f.path, info.Mode()),
+		Mode:      fileModeToDotL(info.Mode()),
+		Nlink:     nlink,
+		Size:      size,
+		Blksize:   4096,
+		Blocks:    (size + 511) / 512,
+		AtimeSec:  uint64(mtime.Unix()),
+		AtimeNsec: uint64(mtime.Nanosecond()),
+		MtimeSec:  uint64(mtime.Unix()),
+		MtimeNsec: uint64(mtime.Nanosecond()),
+		CtimeSec:  uint64(mtime.Unix()),
+		CtimeNsec: uint64(mtime.Nanosecond()),
+	}, nil
+}
+
+func (f *IOFSFile) Open(ctx context.Context, flags uint32) (Qid, uint32, error) {
+	if flags&L_O_ACCMODE != L_O_RDONLY || flags&(L_O_TRUNC|L_O_CREAT|L_O_APPEND) != 0 {
+		return Qid{}, 0, &Rlerror{Ecode: EROFS}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file != nil {
+		return Qid{}, 0, &Rlerror{Ecode: EBADF}
+	}
+	file, err := f.iofs.fsys.Open(f.path)
+	if err != nil {
+		return Qid{}, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return Qid{}, 0, err
+	}
+	f.file = file
+	f.pos = 0
+	return iofsQid(f.path, info.Mode()), 0, nil
+}
+
+func (f *IOFSFile) Read(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return 0, &Rlerror{Ecode: EBADF}
+	}
+	var n int
+	var err error
+	switch file := f.file.(type) {
+	case io.ReaderAt:
+		n, err = file.ReadAt(buf, int64(offset))
+	case io.ReadSeeker:
+		_, err = file.Seek(int64(offset), io.SeekStart)
+		if err == nil {
+			n, err = io.ReadFull(file, buf)
+		}
+	default:
+		n, err = f.readSequential(int64(offset), buf)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
+// readSequential reads files that support neither ReadAt nor Seek,
+// reopening the file to read backwards.
+func (f *IOFSFile) readSequential(offset int64, buf []byte) (int, error) {
+	if offset < f.pos {
+		file, err := f.iofs.fsys.Open(f.path)
+		if err != nil {
+			return 0, err
+		}
+		_ = f.file.Close()
+		f.file = file
+		f.pos = 0
+	}
+	if offset > f.pos {
+		skipped, err := io.CopyN(io.Discard, f.file, offset-f.pos)
+		f.pos += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(f.file, buf)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *IOFSFile) Readdir(ctx context.Context, offset uint64, count uint32) ([]DirEnt, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil, &Rlerror{Ecode: EBADF}
+	}
+	if f.dirents == nil {
+		// The listing is sorted and the filesystem does not
+		// change, so offsets index into it.
+		entries, err := fs.ReadDir(f.iofs.fsys, f.path)
+		if err != nil {
+			return nil, err
+		}
+		parent := path.Dir(f.path)
+		f.dirents = make([]DirEnt, 0, len(entries)+2)
+		f.dirents = append(f.dirents,
+			DirEnt{Qid: iofsQid(f.path, fs.ModeDir), Typ: L_DT_DIR, Name: "."},
+			DirEnt{Qid: iofsQid(parent, fs.ModeDir), Typ: L_DT_DIR, Name: ".."},
+		)
+		for _, ent := range entries {
+			f.dirents = append(f.dirents, DirEnt{
+				Qid:  iofsQid(path.Join(f.path, ent.Name()), ent.Type()),
+				Typ:  fileModeToDirentType(ent.Type()),
+				Name: ent.Name(),
+			})
+		}
+		for i := range f.dirents {
+			f.dirents[i].Offset = uint64(i + 1)
+		}
+	}
+	if offset >= uint64(len(f.dirents)) {
+		return []DirEnt{}, nil
+	}
+	return PackDirEnts(f.dirents[offset:], count), nil
+}
+
+func (f *IOFSFile) Statfs(ctx context.Context) (LStatfs, error) {
+	return LStatfs{
+		Bsize:   4096,
+		Namelen: 255,
+	}, nil
+}
+
+func (f *IOFSFile) Clunk() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.dirents = nil
+	if f.file != nil {
+		err := f.file.Close()
+		f.file = nil
+		return err
+	}
+	return nil
+}
+
+// Modifying requests.
+
+func (f *IOFSFile) Create(ctx context.Context, name string, flags uint32, mode uint32, gid uint32) (DotLFile, Qid, uint32, error) {
+	return nil, Qid{}, 0, &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Write(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	return 0, &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) SetAttr(ctx context.Context, attr LSetAttr) error {
+	return &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Mkdir(ctx context.Context, name string, mode uint32, gid uint32) (Qid, error) {
+	return Qid{}, &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Symlink(ctx context.Context, name string, target string, gid uint32) (Qid, error) {
+	return Qid{}, &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Mknod(ctx context.Context, name string, mode uint32, major uint32, minor uint32, gid uint32) (Qid, error) {
+	return Qid{}, &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Link(ctx context.Context, name string, file DotLFile) error {
+	return &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Rename(ctx context.Context, dir DotLFile, name string) error {
+	return &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Renameat(ctx context.Context, oldName string, newDir DotLFile, newName string) error {
+	return &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Unlinkat(ctx context.Context, name string, flags uint32) error {
+	return &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) Remove(ctx context.Context) error {
+	_ = f.Clunk()
+	return &Rlerror{Ecode: EROFS}
+}
+
+func (f *IOFSFile) XattrWalk(ctx context.Context, name string) (DotLFile, uint64, error) {
+	return nil, 0, &Rlerror{Ecode: EOPNOTSUPP}
+}
+
+func (f *IOFSFile) XattrCreate(ctx context.Context, name string, size uint64, flags uint32) error {
+	return &Rlerror{Ecode: EROFS}
+}
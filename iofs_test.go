@@ -0,0 +1,126 @@
+package proto9
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestIOFS(t *testing.T) {
+	mtime := time.Unix(1234, 0)
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("hello world"), Mode: 0o644, ModTime: mtime},
+		"d/b.txt":   {Data: []byte("b"), Mode: 0o444},
+		"d/c.txt":   {Data: []byte("c"), Mode: 0o444},
+		"d/e/f.txt": {Data: []byte("f"), Mode: 0o444},
+	}
+	client := newPipeTestClient(t, NewIOFS(fsys).NewFilesystem())
+	root, rootQid, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Clunk()
+
+	af, qids, err := root.Walk([]string{"d", "..", "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer af.Clunk()
+	if qids[1] != rootQid {
+		t.Fatalf("unexpected qid for ..: %s", qids[1].String())
+	}
+	attr, err := af.GetAttr(L_GETATTR_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Mode != L_S_IFREG|0o644 || attr.Size != 11 || attr.MtimeSec != 1234 || attr.Qid != qids[2] {
+		t.Fatalf("unexpected attributes %#v", attr)
+	}
+
+	err = af.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := af.Read(6, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" {
+		t.Fatalf("unexpected read %q", buf[:n])
+	}
+	_, err = af.Write(0, []byte("x"))
+	expectRlerror(t, err, EROFS)
+
+	_, _, err = root.Walk([]string{"missing"})
+	expectRlerror(t, err, ENOENT)
+	wf := walkRamFS(t, root, "a.txt")
+	_, _, err = wf.Walk([]string{"x"})
+	expectRlerror(t, err, ENOTDIR)
+	err = wf.Open(L_O_RDWR)
+	expectRlerror(t, err, EROFS)
+	cf := walkRamFS(t, root)
+	_, _, err = cf.Create("x", L_O_RDWR, 0o644, 0)
+	expectRlerror(t, err, EROFS)
+	_, err = root.Mkdir("x", 0o755, 0)
+	expectRlerror(t, err, EROFS)
+	err = root.Unlinkat("a.txt", 0)
+	expectRlerror(t, err, EROFS)
+	err = wf.SetAttr(LSetAttr{Valid: L_SETATTR_MODE, Mode: 0o777})
+	expectRlerror(t, err, EROFS)
+}
+
+func TestIOFSReaddir(t *testing.T) {
+	fsys := fstest.MapFS{}
+	expected := []string{".", ".."}
+	for _, name := range []string{"c", "a", "b", "d", "e", "f"} {
+		fsys["dir/"+name] = &fstest.MapFile{Data: []byte(name)}
+	}
+	expected = append(expected, "a", "b", "c", "d", "e", "f")
+	fsys["dir/sub/x"] = &fstest.MapFile{}
+	expected = append(expected, "sub")
+
+	client := newPipeTestClient(t, NewIOFS(fsys).NewFilesystem())
+	root, _, err := AttachDotL(client, "dir", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Clunk()
+
+	err = root.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read a few entries at a time so offsets are used to resume.
+	names := []string{}
+	offset := uint64(0)
+	for {
+		ents, err := root.Readdir(offset, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ents) == 0 {
+			break
+		}
+		for _, ent := range ents {
+			names = append(names, ent.Name)
+			if ent.Name == "sub" && (ent.Typ != L_DT_DIR || ent.Qid.Typ != QT_DIR) {
+				t.Fatalf("unexpected entry %#v", ent)
+			}
+			offset = ent.Offset
+		}
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected listing %v", names)
+	}
+
+	// Offsets remain valid when restarting from an earlier one.
+	ents, err := root.Readdir(4, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) == 0 || ents[0].Name != "c" {
+		t.Fatalf("unexpected entries %v", ents)
+	}
+}
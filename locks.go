@@ -0,0 +1,274 @@
+package proto9
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LockOwner identifies the holder of a POSIX record lock, the
+// process ProcId on the client ClientId.
+type LockOwner struct {
+	ProcId   uint32
+	ClientId string
+}
+
+// LockManager implements POSIX record locks for Tlock and Tgetlock on
+// behalf of a filesystem. Files and the handles locks are taken through,
+// usually the fid's DotLFile, are identified by any comparable value.
+//
+// Locks of one owner never conflict with each other, overlapping and
+// adjacent locks of the same type are merged, and unlocking part of a
+// lock splits it. The zero value is ready to use and has no grace period.
+type LockManager struct {
+	lock     sync.Mutex
+	graceEnd time.Time
+	files    map[interface{}]*lockedFile
+	// Closed and replaced whenever a lock is released.
+	released chan struct{}
+}
+
+type lockedFile struct {
+	locks []heldLock
+	// The owners that have locked the file through each handle.
+	handles map[interface{}]map[LockOwner]struct{}
+}
+
+type heldLock struct {
+	owner LockOwner
+	typ   byte
+	start uint64
+	// Exclusive, math.MaxUint64 means to the end of the file.
+	end uint64
+}
+
+// NewLockManager returns a LockManager that, for the grace period
+// after a server restart, only grants locks being reclaimed by clients
+// with L_LOCK_FLAGS_RECLAIM. Other requests fail with L_LOCK_GRACE.
+func NewLockManager(grace time.Duration) *LockManager {
+	return &LockManager{graceEnd: time.Now().Add(grace)}
+}
+
+func lockRangeEnd(start uint64, length uint64) uint64 {
+	if length == 0 || start+length < start {
+		return math.MaxUint64
+	}
+	return start + length
+}
+
+func (l *heldLock) overlaps(start uint64, end uint64) bool {
+	return l.start < end && l.end > start
+}
+
+func (l *heldLock) conflicts(owner LockOwner, typ byte, start uint64, end uint64) bool {
+	if l.owner == owner || !l.overlaps(start, end) {
+		return false
+	}
+	return typ == L_LOCK_TYPE_WRLCK || l.typ == L_LOCK_TYPE_WRLCK
+}
+
+// file returns the state of file, m.lock must be held.
+func (m *LockManager) file(file interface{}) *lockedFile {
+	if m.files == nil {
+		m.files = make(map[interface{}]*lockedFile)
+	}
+	f, ok := m.files[file]
+	if !ok {
+		f = &lockedFile{handles: make(map[interface{}]map[LockOwner]struct{})}
+		m.files[file] = f
+	}
+	return f
+}
+
+// forget drops the state of file if it is no longer locked,
+// m.lock must be held.
+func (m *LockManager) forget(file interface{}, f *lockedFile) {
+	if len(f.locks) == 0 && len(f.handles) == 0 {
+		delete(m.files, file)
+	}
+}
+
+// wake wakes blocked lock requests after locks were released,
+// m.lock must be held.
+func (m *LockManager) wake() {
+	if m.released != nil {
+		close(m.released)
+		m.released = nil
+	}
+}
+
+// Lock handles a Tlock on file taken through handle. Requests with
+// L_LOCK_FLAGS_BLOCK wait for conflicting locks to be released or
+// for ctx to be cancelled, others fail with L_LOCK_BLOCKED.
+func (m *LockManager) Lock(ctx context.Context, file interface{}, handle interface{}, lock LSetLock) (byte, error) {
+	owner := LockOwner{ProcId: lock.ProcId, ClientId: lock.ClientId}
+	end := lockRangeEnd(lock.Start, lock.Length)
+	switch lock.Typ {
+	case L_LOCK_TYPE_RDLCK, L_LOCK_TYPE_WRLCK, L_LOCK_TYPE_UNLCK:
+	default:
+		return L_LOCK_ERROR, &Rlerror{Ecode: EINVAL}
+	}
+	for {
+		m.lock.Lock()
+		f := m.file(file)
+		if lock.Typ == L_LOCK_TYPE_UNLCK {
+			f.unlockRange(owner, lock.Start, end)
+			m.forget(file, f)
+			m.wake()
+			m.lock.Unlock()
+			return L_LOCK_SUCCESS, nil
+		}
+		if lock.Flags&L_LOCK_FLAGS_RECLAIM == 0 && time.Now().Before(m.graceEnd) {
+			m.forget(file, f)
+			m.lock.Unlock()
+			return L_LOCK_GRACE, nil
+		}
+		_, conflict := f.conflict(owner, lock.Typ, lock.Start, end)
+		if !conflict {
+			f.unlockRange(owner, lock.Start, end)
+			f.locks = append(f.locks, heldLock{
+				owner: owner,
+				typ:   lock.Typ,
+				start: lock.Start,
+				end:   end,
+			})
+			f.merge(owner)
+			owners, ok := f.handles[handle]
+			if !ok {
+				owners = make(map[LockOwner]struct{})
+				f.handles[handle] = owners
+			}
+			owners[owner] = struct{}{}
+			// Downgrading a lock may unblock readers.
+			m.wake()
+			m.lock.Unlock()
+			return L_LOCK_SUCCESS, nil
+		}
+		if lock.Flags&L_LOCK_FLAGS_BLOCK == 0 {
+			m.forget(file, f)
+			m.lock.Unlock()
+			return L_LOCK_BLOCKED, nil
+		}
+		if m.released == nil {
+			m.released = make(chan struct{})
+		}
+		released := m.released
+		m.forget(file, f)
+		m.lock.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return L_LOCK_ERROR, ctx.Err()
+		}
+	}
+}
+
+// GetLock handles a Tgetlock on file, returning a lock that would
+// prevent the given lock from being taken, or the given lock with
+// type L_LOCK_TYPE_UNLCK if there is none.
+func (m *LockManager) GetLock(file interface{}, lock LGetLock) LGetLock {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, ok := m.files[file]
+	if !ok {
+		lock.Typ = L_LOCK_TYPE_UNLCK
+		return lock
+	}
+	owner := LockOwner{ProcId: lock.ProcId, ClientId: lock.ClientId}
+	l, ok := f.conflict(owner, lock.Typ, lock.Start, lockRangeEnd(lock.Start, lock.Length))
+	if !ok {
+		lock.Typ = L_LOCK_TYPE_UNLCK
+		return lock
+	}
+	length := uint64(0)
+	if l.end != math.MaxUint64 {
+		length = l.end - l.start
+	}
+	return LGetLock{
+		Typ:      l.typ,
+		Start:    l.start,
+		Length:   length,
+		ProcId:   l.owner.ProcId,
+		ClientId: l.owner.ClientId,
+	}
+}
+
+// Release drops the locks of every owner that locked file through
+// handle, it should be called when the handle is clunked. Like POSIX
+// close, this includes the owners' locks taken through other handles.
+func (m *LockManager) Release(file interface{}, handle interface{}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, ok := m.files[file]
+	if !ok {
+		return
+	}
+	owners, ok := f.handles[handle]
+	if !ok {
+		return
+	}
+	delete(f.handles, handle)
+	for owner := range owners {
+		f.unlockRange(owner, 0, math.MaxUint64)
+	}
+	m.forget(file, f)
+	m.wake()
+}
+
+// conflict returns a lock held by another owner that conflicts
+// with the given lock.
+func (f *lockedFile) conflict(owner LockOwner, typ byte, start uint64, end uint64) (heldLock, bool) {
+	for _, l := range f.locks {
+		if l.conflicts(owner, typ, start, end) {
+			return l, true
+		}
+	}
+	return heldLock{}, false
+}
+
+// unlockRange removes the range from locks held by owner,
+// splitting locks as needed.
+func (f *lockedFile) unlockRange(owner LockOwner, start uint64, end uint64) {
+	locks := f.locks[:0:0]
+	for _, l := range f.locks {
+		if l.owner != owner || !l.overlaps(start, end) {
+			locks = append(locks, l)
+			continue
+		}
+		if l.start < start {
+			before := l
+			before.end = start
+			locks = append(locks, before)
+		}
+		if l.end > end {
+			after := l
+			after.start = end
+			locks = append(locks, after)
+		}
+	}
+	f.locks = locks
+}
+
+// merge joins the adjacent locks of owner that have the same type.
+func (f *lockedFile) merge(owner LockOwner) {
+	sort.Slice(f.locks, func(i, j int) bool {
+		return f.locks[i].start < f.locks[j].start
+	})
+	locks := f.locks[:0:0]
+	// Locks of an owner never overlap, so each only needs
+	// to be compared with the previous lock of the owner.
+	prev := -1
+	for _, l := range f.locks {
+		if l.owner == owner && prev >= 0 && locks[prev].typ == l.typ && locks[prev].end == l.start {
+			locks[prev].end = l.end
+			continue
+		}
+		locks = append(locks, l)
+		if l.owner == owner {
+			prev = len(locks) - 1
+		}
+	}
+	f.locks = locks
+}
@@ -0,0 +1,163 @@
+package proto9
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLockManager(t *testing.T) {
+	m := &LockManager{}
+	a := LSetLock{ProcId: 1, ClientId: "a"}
+	b := LSetLock{ProcId: 2, ClientId: "a"}
+	lock := func(l LSetLock, typ byte, start uint64, length uint64) byte {
+		l.Typ = typ
+		l.Start = start
+		l.Length = length
+		status, err := m.Lock(context.Background(), "file", "fid", l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+	held := func() []heldLock {
+		f, ok := m.files["file"]
+		if !ok {
+			return nil
+		}
+		return f.locks
+	}
+	owner := LockOwner{ProcId: 1, ClientId: "a"}
+
+	// Adjacent and overlapping locks of an owner merge.
+	if lock(a, L_LOCK_TYPE_WRLCK, 0, 10) != L_LOCK_SUCCESS ||
+		lock(a, L_LOCK_TYPE_WRLCK, 10, 10) != L_LOCK_SUCCESS ||
+		lock(a, L_LOCK_TYPE_WRLCK, 5, 20) != L_LOCK_SUCCESS {
+		t.Fatal("lock failed")
+	}
+	expected := []heldLock{{owner: owner, typ: L_LOCK_TYPE_WRLCK, start: 0, end: 25}}
+	if !reflect.DeepEqual(held(), expected) {
+		t.Fatalf("unexpected locks %v", held())
+	}
+
+	// Changing the type of the middle splits the lock.
+	if lock(a, L_LOCK_TYPE_RDLCK, 10, 5) != L_LOCK_SUCCESS {
+		t.Fatal("lock failed")
+	}
+	expected = []heldLock{
+		{owner: owner, typ: L_LOCK_TYPE_WRLCK, start: 0, end: 10},
+		{owner: owner, typ: L_LOCK_TYPE_RDLCK, start: 10, end: 15},
+		{owner: owner, typ: L_LOCK_TYPE_WRLCK, start: 15, end: 25},
+	}
+	if !reflect.DeepEqual(held(), expected) {
+		t.Fatalf("unexpected locks %v", held())
+	}
+
+	// Readers share, writers conflict.
+	if lock(b, L_LOCK_TYPE_RDLCK, 10, 5) != L_LOCK_SUCCESS {
+		t.Fatal("shared lock failed")
+	}
+	if lock(b, L_LOCK_TYPE_WRLCK, 12, 1) != L_LOCK_BLOCKED {
+		t.Fatal("expected write lock to block")
+	}
+	if lock(b, L_LOCK_TYPE_RDLCK, 20, 0) != L_LOCK_BLOCKED {
+		t.Fatal("expected read lock to block")
+	}
+	l := m.GetLock("file", LGetLock{Typ: L_LOCK_TYPE_RDLCK, Start: 20, ProcId: 2, ClientId: "a"})
+	if l.Typ != L_LOCK_TYPE_WRLCK || l.Start != 15 || l.Length != 10 || l.ProcId != 1 {
+		t.Fatalf("unexpected conflicting lock %#v", l)
+	}
+	l = m.GetLock("file", LGetLock{Typ: L_LOCK_TYPE_WRLCK, Start: 30, ProcId: 2, ClientId: "a"})
+	if l.Typ != L_LOCK_TYPE_UNLCK {
+		t.Fatalf("unexpected conflicting lock %#v", l)
+	}
+
+	// A blocking request waits for the conflict to be released.
+	result := make(chan byte)
+	go func() {
+		l := b
+		l.Typ = L_LOCK_TYPE_WRLCK
+		l.Flags = L_LOCK_FLAGS_BLOCK
+		l.Start = 20
+		status, _ := m.Lock(context.Background(), "file", "fid2", l)
+		result <- status
+	}()
+	select {
+	case <-result:
+		t.Fatal("blocking lock did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if lock(a, L_LOCK_TYPE_UNLCK, 0, 0) != L_LOCK_SUCCESS {
+		t.Fatal("unlock failed")
+	}
+	if status := <-result; status != L_LOCK_SUCCESS {
+		t.Fatalf("unexpected status %d", status)
+	}
+
+	// Releasing a handle drops the locks of its owners.
+	m.Release("file", "fid")
+	m.Release("file", "fid2")
+	if _, ok := m.files["file"]; ok {
+		t.Fatalf("unexpected locks %v", held())
+	}
+}
+
+func TestLockManagerCancel(t *testing.T) {
+	m := &LockManager{}
+	status, err := m.Lock(context.Background(), "file", "fid", LSetLock{Typ: L_LOCK_TYPE_WRLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("lock failed: %d %v", status, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	status, err = m.Lock(ctx, "file", "fid", LSetLock{Typ: L_LOCK_TYPE_WRLCK, Flags: L_LOCK_FLAGS_BLOCK, ProcId: 2})
+	if err != context.DeadlineExceeded || status != L_LOCK_ERROR {
+		t.Fatalf("unexpected result: %d %v", status, err)
+	}
+}
+
+func TestLockManagerGrace(t *testing.T) {
+	m := NewLockManager(time.Hour)
+	status, err := m.Lock(context.Background(), "file", "fid", LSetLock{Typ: L_LOCK_TYPE_WRLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_GRACE {
+		t.Fatalf("unexpected result: %d %v", status, err)
+	}
+	status, err = m.Lock(context.Background(), "file", "fid", LSetLock{Typ: L_LOCK_TYPE_WRLCK, Flags: L_LOCK_FLAGS_RECLAIM, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("reclaim failed: %d %v", status, err)
+	}
+	status, err = m.Lock(context.Background(), "file", "fid", LSetLock{Typ: L_LOCK_TYPE_WRLCK, Flags: L_LOCK_FLAGS_RECLAIM, ProcId: 2})
+	if err != nil || status != L_LOCK_BLOCKED {
+		t.Fatalf("unexpected result: %d %v", status, err)
+	}
+}
+
+func TestDotLFilesystemLockGrace(t *testing.T) {
+	fs := NewRamFS()
+	dotl := fs.NewFilesystem().(*DotLFilesystem)
+	dotl.LockGraceEnd = time.Now().Add(time.Hour)
+	client := newPipeTestClient(t, dotl)
+	root, _, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Clunk()
+	f := walkRamFS(t, root)
+	_, _, err = f.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := f.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_GRACE {
+		t.Fatalf("unexpected result: %d %v", status, err)
+	}
+	status, err = f.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, Flags: L_LOCK_FLAGS_RECLAIM, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("reclaim failed: %d %v", status, err)
+	}
+	status, err = f.Lock(LSetLock{Typ: L_LOCK_TYPE_UNLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("unlock failed: %d %v", status, err)
+	}
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/andrewchambers/proto9-go"
+)
+
+// AccessEntry records a request that modifies the filesystem.
+type AccessEntry struct {
+	Time time.Time
+	// The user the fid was attached as.
+	Uname string
+	Uid   uint32
+	Op    string
+	// The file modified, relative to the attach root of the server,
+	// paths are tracked lexically so are only as accurate as the
+	// walks that produced them.
+	Path string
+	// The destination of renames and links, or the target of symlinks.
+	NewPath string
+	// The error code if the request failed.
+	Ecode uint32
+}
+
+type accessFid struct {
+	uname string
+	uid   uint32
+	path  string
+}
+
+type accessFilesystem struct {
+	fs  proto9.Filesystem
+	log func(*AccessEntry)
+
+	lock sync.Mutex
+	fids map[uint32]accessFid
+}
+
+// AccessLog calls log with an entry for every request that modifies the
+// filesystem, successful or not, once it has been answered.
+func AccessLog(log func(*AccessEntry)) Middleware {
+	return func(fs proto9.Filesystem) proto9.Filesystem {
+		return &accessFilesystem{
+			fs:   fs,
+			log:  log,
+			fids: make(map[uint32]accessFid),
+		}
+	}
+}
+
+func (a *accessFilesystem) fid(fid uint32) accessFid {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f, ok := a.fids[fid]
+	if !ok {
+		return accessFid{path: "?"}
+	}
+	return f
+}
+
+func (a *accessFilesystem) Fcall(ctx context.Context, fc proto9.Fcall) proto9.Fcall {
+	var entry *AccessEntry
+	if mutates(fc) {
+		entry = a.entry(fc)
+	}
+	resp := a.fs.Fcall(ctx, fc)
+	a.track(fc, resp)
+	if entry != nil {
+		entry.Ecode = ecode(resp)
+		a.log(entry)
+	}
+	return resp
+}
+
+// entry describes a modifying request before it is handled, while
+// its fids still refer to the same files.
+func (a *accessFilesystem) entry(fc proto9.Fcall) *AccessEntry {
+	var f accessFid
+	var p, newPath string
+	switch fc := fc.(type) {
+	case *proto9.Twrite:
+		f = a.fid(fc.Fid)
+		p = f.path
+	case *proto9.Tsetattr:
+		f = a.fid(fc.Fid)
+		p = f.path
+	case *proto9.Tlopen:
+		f = a.fid(fc.Fid)
+		p = f.path
+	case *proto9.Txattrcreate:
+		f = a.fid(fc.Fid)
+		p = f.path
+	case *proto9.Tremove:
+		f = a.fid(fc.Fid)
+		p = f.path
+	case *proto9.Tlcreate:
+		f = a.fid(fc.Fid)
+		p = path.Join(f.path, fc.Name)
+	case *proto9.Tsymlink:
+		f = a.fid(fc.Fid)
+		p = path.Join(f.path, fc.Name)
+		newPath = fc.Target
+	case *proto9.Tmknod:
+		f = a.fid(fc.Fid)
+		p = path.Join(f.path, fc.Name)
+	case *proto9.Tmkdir:
+		f = a.fid(fc.Dfid)
+		p = path.Join(f.path, fc.Name)
+	case *proto9.Tunlinkat:
+		f = a.fid(fc.Dfid)
+		p = path.Join(f.path, fc.Name)
+	case *proto9.Tlink:
+		f = a.fid(fc.Fid)
+		p = f.path
+		newPath = path.Join(a.fid(fc.Dfid).path, fc.Name)
+	case *proto9.Trename:
+		f = a.fid(fc.Fid)
+		p = f.path
+		newPath = path.Join(a.fid(fc.Dfid).path, fc.Name)
+	case *proto9.Trenameat:
+		f = a.fid(fc.OldDfid)
+		p = path.Join(f.path, fc.OldName)
+		newPath = path.Join(a.fid(fc.NewDfid).path, fc.NewName)
+	}
+	return &AccessEntry{
+		Time:    time.Now(),
+		Uname:   f.uname,
+		Uid:     f.uid,
+		Op:      opName(fc),
+		Path:    p,
+		NewPath: newPath,
+	}
+}
+
+// track follows the paths of fids.
+func (a *accessFilesystem) track(fc proto9.Fcall, resp proto9.Fcall) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	failed := ecode(resp) != 0
+	switch fc := fc.(type) {
+	case *proto9.Tversion:
+		a.fids = make(map[uint32]accessFid)
+	case *proto9.Tattach:
+		if !failed {
+			a.fids[fc.Fid] = accessFid{
+				uname: fc.Uname,
+				uid:   fc.N_uname,
+				path:  path.Join("/", fc.Aname),
+			}
+		}
+	case *proto9.Twalk:
+		rwalk, ok := resp.(*proto9.Rwalk)
+		if ok && len(rwalk.WQids) == len(fc.Wnames) {
+			f, ok := a.fids[fc.Fid]
+			if !ok {
+				f.path = "?"
+			}
+			f.path = path.Join(append([]string{f.path}, fc.Wnames...)...)
+			a.fids[fc.NewFid] = f
+		}
+	case *proto9.Txattrwalk:
+		if !failed {
+			a.fids[fc.Newfid] = a.fids[fc.Fid]
+		}
+	case *proto9.Tlcreate:
+		if f, ok := a.fids[fc.Fid]; ok && !failed {
+			f.path = path.Join(f.path, fc.Name)
+			a.fids[fc.Fid] = f
+		}
+	case *proto9.Trename:
+		f, ok := a.fids[fc.Fid]
+		d, dok := a.fids[fc.Dfid]
+		if ok && dok && !failed {
+			f.path = path.Join(d.path, fc.Name)
+			a.fids[fc.Fid] = f
+		}
+	case *proto9.Tclunk:
+		delete(a.fids, fc.Fid)
+	case *proto9.Tremove:
+		delete(a.fids, fc.Fid)
+	}
+}
+
+func (a *accessFilesystem) Clunk() error {
+	a.lock.Lock()
+	a.fids = make(map[uint32]accessFid)
+	a.lock.Unlock()
+	return a.fs.Clunk()
+}
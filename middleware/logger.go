@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andrewchambers/proto9-go"
+)
+
+// LogEntry describes a completed request.
+type LogEntry struct {
+	Op       string
+	Request  proto9.Fcall
+	Response proto9.Fcall
+	Duration time.Duration
+	// The error code of an Rlerror response, 0 on success.
+	Ecode uint32
+}
+
+// String formats the entry as key=value pairs.
+func (e *LogEntry) String() string {
+	s := fmt.Sprintf("op=%s tag=%d duration=%s", e.Op, e.Request.GetTag(), e.Duration)
+	if e.Ecode != 0 {
+		s += fmt.Sprintf(" ecode=%d", e.Ecode)
+	}
+	return s
+}
+
+type loggerFilesystem struct {
+	fs  proto9.Filesystem
+	log func(*LogEntry)
+}
+
+// Logger calls log with an entry for every request once it has
+// been answered, log may be called concurrently.
+func Logger(log func(*LogEntry)) Middleware {
+	return func(fs proto9.Filesystem) proto9.Filesystem {
+		return &loggerFilesystem{fs: fs, log: log}
+	}
+}
+
+func (l *loggerFilesystem) Fcall(ctx context.Context, fc proto9.Fcall) proto9.Fcall {
+	start := time.Now()
+	resp := l.fs.Fcall(ctx, fc)
+	l.log(&LogEntry{
+		Op:       opName(fc),
+		Request:  fc,
+		Response: resp,
+		Duration: time.Since(start),
+		Ecode:    ecode(resp),
+	})
+	return resp
+}
+
+func (l *loggerFilesystem) Clunk() error {
+	return l.fs.Clunk()
+}
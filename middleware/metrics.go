@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andrewchambers/proto9-go"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram
+// buckets used when Metrics.Buckets is nil.
+var DefaultLatencyBuckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Metrics records a latency histogram of each kind of request. A single
+// Metrics is usually shared by the middleware of every connection.
+type Metrics struct {
+	// Ascending upper bounds of the histogram buckets, it must not
+	// change once requests have been recorded.
+	Buckets []time.Duration
+
+	lock sync.Mutex
+	ops  map[string]*LatencyHistogram
+}
+
+// LatencyHistogram counts the requests of one kind by latency.
+type LatencyHistogram struct {
+	Count uint64
+	// Requests answered with Rlerror.
+	Errors uint64
+	Sum    time.Duration
+	// Upper bounds of the buckets.
+	Buckets []time.Duration
+	// The number of requests in each bucket, with an extra final
+	// bucket for requests slower than the last bound.
+	Counts []uint64
+}
+
+func (m *Metrics) buckets() []time.Duration {
+	if m.Buckets == nil {
+		return DefaultLatencyBuckets
+	}
+	return m.Buckets
+}
+
+// Observe records a request of kind op that took d.
+func (m *Metrics) Observe(op string, d time.Duration, failed bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.ops == nil {
+		m.ops = make(map[string]*LatencyHistogram)
+	}
+	h, ok := m.ops[op]
+	if !ok {
+		buckets := m.buckets()
+		h = &LatencyHistogram{
+			Buckets: buckets,
+			Counts:  make([]uint64, len(buckets)+1),
+		}
+		m.ops[op] = h
+	}
+	h.Count++
+	if failed {
+		h.Errors++
+	}
+	h.Sum += d
+	i := sort.Search(len(h.Buckets), func(i int) bool {
+		return d <= h.Buckets[i]
+	})
+	h.Counts[i]++
+}
+
+// Snapshot returns a copy of the histograms, keyed by message
+// name, e.g. "Twalk".
+func (m *Metrics) Snapshot() map[string]LatencyHistogram {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	snapshot := make(map[string]LatencyHistogram, len(m.ops))
+	for op, h := range m.ops {
+		c := *h
+		c.Counts = append([]uint64(nil), h.Counts...)
+		snapshot[op] = c
+	}
+	return snapshot
+}
+
+type metricsFilesystem struct {
+	fs      proto9.Filesystem
+	metrics *Metrics
+}
+
+// Middleware returns a middleware recording requests in m.
+func (m *Metrics) Middleware() Middleware {
+	return func(fs proto9.Filesystem) proto9.Filesystem {
+		return &metricsFilesystem{fs: fs, metrics: m}
+	}
+}
+
+func (m *metricsFilesystem) Fcall(ctx context.Context, fc proto9.Fcall) proto9.Fcall {
+	start := time.Now()
+	resp := m.fs.Fcall(ctx, fc)
+	m.metrics.Observe(opName(fc), time.Since(start), ecode(resp) != 0)
+	return resp
+}
+
+func (m *metricsFilesystem) Clunk() error {
+	return m.fs.Clunk()
+}
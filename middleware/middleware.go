@@ -0,0 +1,70 @@
+// Package middleware provides wrappers that add logging, metrics and
+// access control to any proto9.Filesystem.
+//
+// Wrappers are applied per connection, for example:
+//
+//	srv.NewFilesystem = func(info proto9.ConnInfo) proto9.Filesystem {
+//		return middleware.Chain(ramfs.NewFilesystem(),
+//			middleware.Logger(logEntry),
+//			metrics.Middleware(),
+//			middleware.ReadOnly(),
+//		)
+//	}
+package middleware
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/andrewchambers/proto9-go"
+)
+
+// Middleware wraps the Filesystem of a single connection.
+type Middleware func(fs proto9.Filesystem) proto9.Filesystem
+
+// Chain wraps fs with each middleware, the first middleware
+// is outermost and sees each request first.
+func Chain(fs proto9.Filesystem, middleware ...Middleware) proto9.Filesystem {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		fs = middleware[i](fs)
+	}
+	return fs
+}
+
+// opName returns the message name of fc, e.g. "Twalk".
+func opName(fc proto9.Fcall) string {
+	return reflect.TypeOf(fc).Elem().Name()
+}
+
+// ecode returns the error code of an Rlerror reply, or 0.
+func ecode(fc proto9.Fcall) uint32 {
+	if rlerror, ok := fc.(*proto9.Rlerror); ok {
+		return rlerror.Ecode
+	}
+	return 0
+}
+
+// mutates reports whether fc changes the filesystem.
+func mutates(fc proto9.Fcall) bool {
+	switch fc := fc.(type) {
+	case *proto9.Twrite, *proto9.Tsetattr, *proto9.Tlcreate,
+		*proto9.Tsymlink, *proto9.Tmknod, *proto9.Tmkdir,
+		*proto9.Tlink, *proto9.Trename, *proto9.Trenameat,
+		*proto9.Tunlinkat, *proto9.Tremove, *proto9.Txattrcreate:
+		return true
+	case *proto9.Tlopen:
+		return fc.Flags&proto9.L_O_TRUNC != 0
+	default:
+		return false
+	}
+}
+
+// refuse fails fc with ecode without passing it on to fs, other
+// than the implied clunk of a Tremove.
+func refuse(ctx context.Context, fs proto9.Filesystem, fc proto9.Fcall, ecode uint32) proto9.Fcall {
+	if fc, ok := fc.(*proto9.Tremove); ok {
+		// The fid is clunked even when the remove fails.
+		_ = fs.Fcall(ctx, &proto9.Tclunk{Tagged: fc.Tagged, Fid: fc.Fid})
+	}
+	return &proto9.Rlerror{Ecode: ecode}
+}
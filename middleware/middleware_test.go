@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/andrewchambers/proto9-go"
+	"github.com/andrewchambers/proto9-go/internal/copyext"
+)
+
+func call(fs proto9.Filesystem, fc proto9.Fcall) proto9.Fcall {
+	return fs.Fcall(context.Background(), fc)
+}
+
+func expectOk(t *testing.T, resp proto9.Fcall) {
+	t.Helper()
+	if rlerror, ok := resp.(*proto9.Rlerror); ok {
+		t.Fatalf("unexpected error %d", rlerror.Ecode)
+	}
+}
+
+func expectEcode(t *testing.T, resp proto9.Fcall, ecode uint32) {
+	t.Helper()
+	rlerror, ok := resp.(*proto9.Rlerror)
+	if !ok || rlerror.Ecode != ecode {
+		t.Fatalf("expected ecode %d, got %s", ecode, resp.String())
+	}
+}
+
+func attach(t *testing.T, fs proto9.Filesystem, uname string) {
+	t.Helper()
+	expectOk(t, call(fs, &proto9.Tversion{Msize: 8192, Version: "9P2000.L"}))
+	expectOk(t, call(fs, &proto9.Tattach{Fid: 0, Afid: proto9.NOFID, Uname: uname, N_uname: 1000}))
+}
+
+func TestReadOnly(t *testing.T) {
+	entries := []*LogEntry{}
+	fs := Chain(proto9.NewRamFS().NewFilesystem(),
+		Logger(func(e *LogEntry) { entries = append(entries, e) }),
+		ReadOnly(),
+	)
+	attach(t, fs, "")
+	expectEcode(t, call(fs, &proto9.Tmkdir{Dfid: 0, Name: "d", Mode: 0o755}), proto9.EROFS)
+	expectOk(t, call(fs, &proto9.Twalk{Fid: 0, NewFid: 1}))
+	expectEcode(t, call(fs, &proto9.Tlopen{Fid: 1, Flags: proto9.L_O_RDWR}), proto9.EROFS)
+	expectEcode(t, call(fs, &proto9.Tlopen{Fid: 1, Flags: proto9.L_O_RDONLY | proto9.L_O_TRUNC}), proto9.EROFS)
+	expectOk(t, call(fs, &proto9.Tlopen{Fid: 1, Flags: proto9.L_O_RDONLY}))
+
+	// Messages not known to be read only are refused.
+	expectEcode(t, call(fs, &copyext.Tcopy{}), proto9.EROFS)
+
+	// A refused remove still clunks the fid.
+	expectOk(t, call(fs, &proto9.Twalk{Fid: 0, NewFid: 2}))
+	expectEcode(t, call(fs, &proto9.Tremove{Fid: 2}), proto9.EROFS)
+	expectEcode(t, call(fs, &proto9.Tgetattr{Fid: 2}), proto9.EBADF)
+
+	// The logger is outermost so sees the refused requests.
+	ops := []string{}
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	expected := []string{"Tversion", "Tattach", "Tmkdir", "Twalk", "Tlopen", "Tlopen", "Tlopen", "Tcopy", "Twalk", "Tremove", "Tgetattr"}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("unexpected log %v", ops)
+	}
+	if entries[2].Ecode != proto9.EROFS || entries[1].Ecode != 0 {
+		t.Fatalf("unexpected log entries %s %s", entries[1], entries[2])
+	}
+}
+
+func TestDenyOps(t *testing.T) {
+	fs := Chain(proto9.NewRamFS().NewFilesystem(), DenyOps(proto9.EPERM, &proto9.Tunlinkat{}))
+	attach(t, fs, "")
+	expectOk(t, call(fs, &proto9.Tmkdir{Dfid: 0, Name: "d", Mode: 0o755}))
+	expectEcode(t, call(fs, &proto9.Tunlinkat{Dfid: 0, Name: "d", Flags: proto9.L_AT_REMOVEDIR}), proto9.EPERM)
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := &Metrics{}
+	for i := 0; i < 2; i++ {
+		fs := Chain(proto9.NewRamFS().NewFilesystem(), metrics.Middleware())
+		attach(t, fs, "")
+		expectOk(t, call(fs, &proto9.Tmkdir{Dfid: 0, Name: "d", Mode: 0o755}))
+		expectEcode(t, call(fs, &proto9.Tmkdir{Dfid: 0, Name: "d", Mode: 0o755}), proto9.EEXIST)
+	}
+	snapshot := metrics.Snapshot()
+	h := snapshot["Tmkdir"]
+	if h.Count != 4 || h.Errors != 2 || len(h.Counts) != len(DefaultLatencyBuckets)+1 {
+		t.Fatalf("unexpected histogram %#v", h)
+	}
+	n := uint64(0)
+	for _, c := range h.Counts {
+		n += c
+	}
+	if n != 4 {
+		t.Fatalf("unexpected histogram counts %v", h.Counts)
+	}
+	if snapshot["Tattach"].Count != 2 {
+		t.Fatalf("unexpected snapshot %v", snapshot)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	lock := &sync.Mutex{}
+	entries := []AccessEntry{}
+	fs := Chain(proto9.NewRamFS().NewFilesystem(), AccessLog(func(e *AccessEntry) {
+		lock.Lock()
+		defer lock.Unlock()
+		entries = append(entries, *e)
+	}))
+	attach(t, fs, "alice")
+	expectOk(t, call(fs, &proto9.Tmkdir{Dfid: 0, Name: "d", Mode: 0o755}))
+	expectOk(t, call(fs, &proto9.Twalk{Fid: 0, NewFid: 1, Wnames: []string{"d"}}))
+	expectOk(t, call(fs, &proto9.Tlcreate{Fid: 1, Name: "f", Flags: proto9.L_O_RDWR, Mode: 0o644}))
+	expectOk(t, call(fs, &proto9.Twrite{Fid: 1, Data: []byte("x")}))
+	expectOk(t, call(fs, &proto9.Twalk{Fid: 0, NewFid: 2, Wnames: []string{"d", "..", "d"}}))
+	expectOk(t, call(fs, &proto9.Trenameat{OldDfid: 2, OldName: "f", NewDfid: 0, NewName: "g"}))
+	expectOk(t, call(fs, &proto9.Tgetattr{Fid: 1}))
+	expectEcode(t, call(fs, &proto9.Tunlinkat{Dfid: 2, Name: "f"}), proto9.ENOENT)
+
+	type access struct {
+		op, path, newPath string
+		ecode             uint32
+	}
+	got := []access{}
+	for _, e := range entries {
+		if e.Uname != "alice" || e.Uid != 1000 || e.Time.IsZero() {
+			t.Fatalf("unexpected entry %#v", e)
+		}
+		got = append(got, access{e.Op, e.Path, e.NewPath, e.Ecode})
+	}
+	expected := []access{
+		{"Tmkdir", "/d", "", 0},
+		{"Tlcreate", "/d/f", "", 0},
+		{"Twrite", "/d/f", "", 0},
+		{"Trenameat", "/d/f", "/g", 0},
+		{"Tunlinkat", "/d/f", "", proto9.ENOENT},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected access log %v", got)
+	}
+}
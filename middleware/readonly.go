@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/andrewchambers/proto9-go"
+)
+
+type filterFilesystem struct {
+	fs proto9.Filesystem
+	// Returns a non zero error code to refuse fc.
+	filter func(fc proto9.Fcall) uint32
+}
+
+func (f *filterFilesystem) Fcall(ctx context.Context, fc proto9.Fcall) proto9.Fcall {
+	if ecode := f.filter(fc); ecode != 0 {
+		return refuse(ctx, f.fs, fc, ecode)
+	}
+	return f.fs.Fcall(ctx, fc)
+}
+
+func (f *filterFilesystem) Clunk() error {
+	return f.fs.Clunk()
+}
+
+// ReadOnly refuses requests that could modify the filesystem,
+// including opens for writing, with EROFS. Only requests known not to
+// modify files are passed on, so extension messages are refused too.
+func ReadOnly() Middleware {
+	return func(fs proto9.Filesystem) proto9.Filesystem {
+		return &filterFilesystem{
+			fs: fs,
+			filter: func(fc proto9.Fcall) uint32 {
+				if readOnly(fc) {
+					return 0
+				}
+				return proto9.EROFS
+			},
+		}
+	}
+}
+
+func readOnly(fc proto9.Fcall) bool {
+	switch fc := fc.(type) {
+	case *proto9.Tversion, *proto9.Tflush, *proto9.Tauth,
+		*proto9.Tattach, *proto9.Twalk, *proto9.Tclunk,
+		*proto9.Tread, *proto9.Treaddir, *proto9.Treadlink,
+		*proto9.Tgetattr, *proto9.Tstatfs, *proto9.Txattrwalk,
+		*proto9.Tlock, *proto9.Tgetlock, *proto9.Tfsync:
+		return true
+	case *proto9.Tlopen:
+		return fc.Flags&proto9.L_O_ACCMODE == proto9.L_O_RDONLY && fc.Flags&proto9.L_O_TRUNC == 0
+	default:
+		return false
+	}
+}
+
+// DenyOps refuses requests of the same kinds as ops with ecode, e.g.
+//
+//	DenyOps(proto9.EPERM, &proto9.Tunlinkat{}, &proto9.Tremove{})
+//
+// Denying Tversion, Tflush or Tclunk breaks clients.
+func DenyOps(ecode uint32, ops ...proto9.Fcall) Middleware {
+	denied := make(map[uint8]struct{}, len(ops))
+	for _, op := range ops {
+		denied[op.Kind()] = struct{}{}
+	}
+	return func(fs proto9.Filesystem) proto9.Filesystem {
+		return &filterFilesystem{
+			fs: fs,
+			filter: func(fc proto9.Fcall) uint32 {
+				if _, ok := denied[fc.Kind()]; ok {
+					return ecode
+				}
+				return 0
+			},
+		}
+	}
+}
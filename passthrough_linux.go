@@ -0,0 +1,1332 @@
+package proto9
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewPassthroughFilesystem returns a filesystem exporting the host
+// directory dir, one should be created for each connection.
+//
+// The attach name selects a directory beneath dir, an empty
+// name attaches to dir itself. All requests are performed as the
+// server process, the user names sent by clients are ignored, see
+// NewMultiUserPassthroughFilesystem.
+//
+// Clients apply the umask of their users to the modes of new files,
+// so like diod the umask of the server process is cleared.
+func NewPassthroughFilesystem(dir string) *DotLFilesystem {
+	unix.Umask(0)
+	qids := &QidAllocator{}
+	return &DotLFilesystem{
+		Msize: 128*1024 + IOHDRSZ,
+		Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+			return passthroughAttach(ctx, dir, fc.Aname, qids)
+		},
+	}
+}
+
+// NewMultiUserPassthroughFilesystem is like NewPassthroughFilesystem,
+// but performs each request as the user the fid was attached as, which
+// is looked up in users. The kernel then enforces permissions and sets
+// the owner of new files, as with the multi-user mode of diod.
+//
+// Switching users requires the server to run as root, otherwise
+// clients may only attach as the server's own user.
+func NewMultiUserPassthroughFilesystem(dir string, users UserDB) *DotLFilesystem {
+	fs := NewPassthroughFilesystem(dir)
+	fs.Users = users
+	fs.RunAs = passthroughRunAs
+	return fs
+}
+
+// passthroughRunAs calls f on a thread with the filesystem uid, gid
+// and supplementary groups of cred.
+func passthroughRunAs(cred *Credential, f func()) error {
+	euid := unix.Geteuid()
+	if euid != 0 {
+		if int(cred.Uid) != euid {
+			return unix.EPERM
+		}
+		f()
+		return nil
+	}
+	errc := make(chan error, 1)
+	// A new goroutine is used so that if the thread cannot be
+	// restored, it exits with the goroutine still locked to it
+	// and is never reused.
+	go func() {
+		runtime.LockOSThread()
+		egid := unix.Getegid()
+		groups, err := unix.Getgroups()
+		if err != nil {
+			runtime.UnlockOSThread()
+			errc <- err
+			return
+		}
+		credGroups := make([]int, 0, len(cred.Groups))
+		for _, gid := range cred.Groups {
+			credGroups = append(credGroups, int(gid))
+		}
+		err = passthroughSetIds(int(cred.Uid), int(cred.Gid), credGroups)
+		if err == nil {
+			f()
+		}
+		if passthroughSetIds(euid, egid, groups) != nil {
+			errc <- unix.EIO
+			return
+		}
+		runtime.UnlockOSThread()
+		errc <- err
+	}()
+	return <-errc
+}
+
+// passthroughSetIds sets the credentials of the current thread. Unlike
+// syscall.Setgroups, unix.Setgroups only applies to the calling thread.
+func passthroughSetIds(uid int, gid int, groups []int) error {
+	err := unix.Setgroups(groups)
+	if err != nil {
+		return err
+	}
+	// setfsuid and setfsgid return the previous id, rather than
+	// an error, so the change is confirmed by reading it back.
+	_, _ = unix.SetfsgidRetGid(gid)
+	if cur, _ := unix.SetfsgidRetGid(-1); cur != gid {
+		return unix.EPERM
+	}
+	_, _ = unix.SetfsuidRetUid(uid)
+	if cur, _ := unix.SetfsuidRetUid(-1); cur != uid {
+		return unix.EPERM
+	}
+	return nil
+}
+
+// passthroughCreate calls create to make name in the directory dirFd
+// with the group gid requested by the client. A multi-user request is
+// made with gid as the filesystem gid if the user is in that group,
+// otherwise the file is given gid after it is created, if the server
+// may do so. As with the kernel, files in setgid directories keep the
+// group of the directory.
+func passthroughCreate(ctx context.Context, dirFd int, name string, gid uint32, create func() error) error {
+	if cred, ok := CredentialFromContext(ctx); ok && unix.Geteuid() == 0 {
+		if gid == cred.Gid || !cred.InGroup(gid) {
+			return create()
+		}
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		old, _ := unix.SetfsgidRetGid(-1)
+		_, _ = unix.SetfsgidRetGid(int(gid))
+		defer unix.SetfsgidRetGid(old)
+		return create()
+	}
+	err := create()
+	if err != nil {
+		return err
+	}
+	var st unix.Stat_t
+	err = unix.Fstat(dirFd, &st)
+	if err != nil || st.Mode&unix.S_ISGID != 0 {
+		return nil
+	}
+	err = unix.Fchownat(dirFd, name, -1, int(gid), unix.AT_SYMLINK_NOFOLLOW)
+	if err == unix.EPERM {
+		// The file keeps the group of the server.
+		return nil
+	}
+	return err
+}
+
+type passthroughRoot struct {
+	dev uint64
+	ino uint64
+	// Qid paths of the files seen by the connection, kept until it
+	// closes so a file never changes path while a client knows it.
+	qids *QidAllocator
+}
+
+// passthroughInode identifies a host file in a QidAllocator.
+type passthroughInode struct {
+	dev uint64
+	ino uint64
+}
+
+func (r *passthroughRoot) qid(st *unix.Stat_t) Qid {
+	return r.qids.Qid(passthroughInode{dev: uint64(st.Dev), ino: st.Ino}, st.Mode)
+}
+
+// PassthroughFile is a file served by a passthrough filesystem.
+//
+// Each file holds an O_PATH descriptor for the file itself and one
+// for its parent directory so it can be renamed or removed.
+type PassthroughFile struct {
+	root *passthroughRoot
+
+	lock     sync.Mutex
+	fd       int
+	parentFd int
+	name     string
+	qid      Qid
+	dev      uint64
+	// Descriptor opened by Tlopen or Tlcreate, -1 if unopened.
+	openFd int
+	// Set by Txattrcreate.
+	xattr *passthroughXattrWrite
+}
+
+type passthroughXattrWrite struct {
+	name  string
+	size  uint64
+	flags int
+	data  []byte
+}
+
+func passthroughAttach(ctx context.Context, dir string, aname string, qidAlloc *QidAllocator) (DotLFile, Qid, error) {
+	fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, Qid{}, err
+	}
+	var st unix.Stat_t
+	err = unix.Fstat(fd, &st)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, Qid{}, err
+	}
+	root := &PassthroughFile{
+		root: &passthroughRoot{
+			dev:  uint64(st.Dev),
+			ino:  st.Ino,
+			qids: qidAlloc,
+		},
+		fd:       fd,
+		parentFd: -1,
+		openFd:   -1,
+		dev:      uint64(st.Dev),
+	}
+	root.qid = root.root.qid(&st)
+	names := []string{}
+	for _, name := range strings.Split(aname, "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return root, root.qid, nil
+	}
+	defer root.Clunk()
+	qids, f, err := root.Walk(ctx, names)
+	if err != nil {
+		return nil, Qid{}, err
+	}
+	if len(qids) != len(names) {
+		_ = f.Clunk()
+		return nil, Qid{}, unix.ENOENT
+	}
+	return f, qids[len(qids)-1], nil
+}
+
+func procFdPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+func (f *PassthroughFile) isSymlink() bool {
+	return f.qid.Typ&QT_SYMLINK != 0
+}
+
+// symlinkPath names the symlink f via its parent, unlike the procfs
+// path of f, it does not resolve to the link target.
+func (f *PassthroughFile) symlinkPath() (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.symlinkPathLocked()
+}
+
+func (f *PassthroughFile) symlinkPathLocked() (string, error) {
+	if f.parentFd == -1 {
+		return "", unix.EOPNOTSUPP
+	}
+	return procFdPath(f.parentFd) + "/" + f.name, nil
+}
+
+func dupFd(fd int) (int, error) {
+	return unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+}
+
+var openat2Unsupported int32
+
+// openBeneath opens the single path element name in the directory
+// dirFd, failing if resolution would leave dirFd. Where openat2
+// is unavailable, the caller must ensure name has no slashes and
+// flags include O_NOFOLLOW.
+func openBeneath(dirFd int, name string, flags int, mode uint32) (int, error) {
+	if atomic.LoadInt32(&openat2Unsupported) == 0 {
+		fd, err := unix.Openat2(dirFd, name, &unix.OpenHow{
+			Flags:   uint64(flags),
+			Mode:    uint64(mode),
+			Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+		})
+		if err != unix.ENOSYS && err != unix.EPERM {
+			return fd, err
+		}
+		if err == unix.EPERM && !openat2Blocked(dirFd) {
+			// A real permission error, such as O_NOATIME on
+			// a file owned by another user.
+			return fd, err
+		}
+		// Old kernel or a seccomp filter.
+		atomic.StoreInt32(&openat2Unsupported, 1)
+	}
+	if strings.IndexByte(name, '/') != -1 || name == ".." {
+		return -1, unix.EXDEV
+	}
+	return unix.Openat(dirFd, name, flags, mode)
+}
+
+// openat2Blocked reports whether a seccomp filter denies openat2 with
+// EPERM, by probing with an open that cannot fail for lack of permission.
+func openat2Blocked(dirFd int) bool {
+	fd, err := unix.Openat2(dirFd, ".", &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH,
+	})
+	if err == nil {
+		_ = unix.Close(fd)
+	}
+	return err == unix.EPERM
+}
+
+// contains reports whether the directory fd is the root or
+// beneath it, directories may be moved out of the export by
+// the host while a fid refers to them.
+func (r *passthroughRoot) contains(fd int) (bool, error) {
+	cur, err := dupFd(fd)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = unix.Close(cur)
+	}()
+	var st unix.Stat_t
+	err = unix.Fstat(cur, &st)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < 4096; i++ {
+		if uint64(st.Dev) == r.dev && st.Ino == r.ino {
+			return true, nil
+		}
+		parent, err := unix.Openat(cur, "..", unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return false, err
+		}
+		_ = unix.Close(cur)
+		cur = parent
+		var parentSt unix.Stat_t
+		err = unix.Fstat(cur, &parentSt)
+		if err != nil {
+			return false, err
+		}
+		if parentSt.Dev == st.Dev && parentSt.Ino == st.Ino {
+			// Reached the filesystem root.
+			return false, nil
+		}
+		st = parentSt
+	}
+	return false, unix.ELOOP
+}
+
+func (f *PassthroughFile) isRoot() bool {
+	var st unix.Stat_t
+	err := unix.Fstat(f.fd, &st)
+	return err == nil && uint64(st.Dev) == f.root.dev && st.Ino == f.root.ino
+}
+
+func (f *PassthroughFile) newChild(parentFd int, fd int, name string, st *unix.Stat_t) *PassthroughFile {
+	return &PassthroughFile{
+		root:     f.root,
+		fd:       fd,
+		parentFd: parentFd,
+		name:     name,
+		openFd:   -1,
+		qid:      f.root.qid(st),
+		dev:      uint64(st.Dev),
+	}
+}
+
+func (f *PassthroughFile) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	qids := make([]Qid, 0, len(names))
+
+	cur, err := f.clone()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range names {
+		if name == ".." && cur.isRoot() {
+			// Never walk above the exported directory.
+			qids = append(qids, cur.qid)
+			continue
+		}
+		var fd int
+		if name == ".." {
+			fd, err = unix.Openat(cur.fd, "..", unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+			if err == nil {
+				var ok bool
+				ok, err = f.root.contains(fd)
+				if err == nil && !ok {
+					err = unix.EXDEV
+				}
+				if err != nil {
+					_ = unix.Close(fd)
+				}
+			}
+		} else {
+			fd, err = openBeneath(cur.fd, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		}
+		if err != nil {
+			_ = cur.Clunk()
+			return qids, nil, err
+		}
+		var st unix.Stat_t
+		err = unix.Fstat(fd, &st)
+		if err != nil {
+			_ = unix.Close(fd)
+			_ = cur.Clunk()
+			return qids, nil, err
+		}
+		if cur.parentFd != -1 {
+			_ = unix.Close(cur.parentFd)
+		}
+		next := f.newChild(cur.fd, fd, name, &st)
+		if name == ".." || name == "." {
+			// The parent is found when needed, see parentLocked.
+			_ = unix.Close(next.parentFd)
+			next.parentFd = -1
+			next.name = ""
+		}
+		cur = next
+		qids = append(qids, cur.qid)
+	}
+
+	return qids, cur, nil
+}
+
+// clone returns a new reference to the same file.
+func (f *PassthroughFile) clone() (*PassthroughFile, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c := &PassthroughFile{
+		root:     f.root,
+		parentFd: -1,
+		openFd:   -1,
+		name:     f.name,
+		qid:      f.qid,
+		dev:      f.dev,
+	}
+	var err error
+	c.fd, err = dupFd(f.fd)
+	if err != nil {
+		return nil, err
+	}
+	if f.parentFd != -1 {
+		c.parentFd, err = dupFd(f.parentFd)
+		if err != nil {
+			_ = c.Clunk()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (f *PassthroughFile) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	var st unix.Stat_t
+	err := unix.Fstat(f.fd, &st)
+	if err != nil {
+		return LAttr{}, err
+	}
+	return LAttr{
+		Valid:     L_GETATTR_BASIC,
+		Qid:       f.root.qid(&st),
+		Mode:      st.Mode,
+		Uid:       st.Uid,
+		Gid:       st.Gid,
+		Nlink:     uint64(st.Nlink),
+		Rdev:      uint64(st.Rdev),
+		Size:      uint64(st.Size),
+		Blksize:   uint64(st.Blksize),
+		Blocks:    uint64(st.Blocks),
+		AtimeSec:  uint64(st.Atim.Sec),
+		AtimeNsec: uint64(st.Atim.Nsec),
+		MtimeSec:  uint64(st.Mtim.Sec),
+		MtimeNsec: uint64(st.Mtim.Nsec),
+		CtimeSec:  uint64(st.Ctim.Sec),
+		CtimeNsec: uint64(st.Ctim.Nsec),
+	}, nil
+}
+
+// dotlOpenFlags converts 9P2000.L open flags to host flags.
+func dotlOpenFlags(flags uint32) int {
+	hostFlags := 0
+	switch flags & L_O_ACCMODE {
+	case L_O_RDONLY:
+		hostFlags = unix.O_RDONLY
+	case L_O_WRONLY:
+		hostFlags = unix.O_WRONLY
+	case L_O_RDWR:
+		hostFlags = unix.O_RDWR
+	}
+	for _, m := range []struct {
+		l    uint32
+		host int
+	}{
+		{L_O_CREAT, unix.O_CREAT},
+		{L_O_EXCL, unix.O_EXCL},
+		{L_O_TRUNC, unix.O_TRUNC},
+		{L_O_APPEND, unix.O_APPEND},
+		{L_O_NONBLOCK, unix.O_NONBLOCK},
+		{L_O_DSYNC, unix.O_DSYNC},
+		{L_O_DIRECT, unix.O_DIRECT},
+		{L_O_DIRECTORY, unix.O_DIRECTORY},
+		{L_O_NOFOLLOW, unix.O_NOFOLLOW},
+		{L_O_NOATIME, unix.O_NOATIME},
+		{L_O_SYNC, unix.O_SYNC},
+	} {
+		if flags&m.l != 0 {
+			hostFlags |= m.host
+		}
+	}
+	return hostFlags | unix.O_CLOEXEC | unix.O_NOCTTY
+}
+
+func (f *PassthroughFile) Open(ctx context.Context, flags uint32) (Qid, uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.openFd != -1 {
+		return Qid{}, 0, unix.EBADF
+	}
+	if f.qid.Typ&QT_SYMLINK != 0 {
+		return Qid{}, 0, unix.ELOOP
+	}
+	// An O_PATH descriptor can only be reopened via procfs.
+	fd, err := unix.Open(procFdPath(f.fd), dotlOpenFlags(flags&^(L_O_CREAT|L_O_EXCL)), 0)
+	if err != nil {
+		return Qid{}, 0, err
+	}
+	f.openFd = fd
+	return f.qid, 0, nil
+}
+
+func (f *PassthroughFile) getOpenFd() (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.openFd == -1 {
+		return -1, unix.EBADF
+	}
+	return f.openFd, nil
+}
+
+func (f *PassthroughFile) Create(ctx context.Context, name string, flags uint32, mode uint32, gid uint32) (DotLFile, Qid, uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	openFd := -1
+	err := passthroughCreate(ctx, f.fd, name, gid, func() error {
+		var err error
+		openFd, err = openBeneath(f.fd, name, dotlOpenFlags(flags)|unix.O_CREAT|unix.O_NOFOLLOW, mode&0o7777)
+		return err
+	})
+	if err != nil {
+		if openFd != -1 {
+			_ = unix.Close(openFd)
+		}
+		return nil, Qid{}, 0, err
+	}
+	child, err := f.openChild(name)
+	if err != nil {
+		_ = unix.Close(openFd)
+		return nil, Qid{}, 0, err
+	}
+	child.openFd = openFd
+	return child, child.qid, 0, nil
+}
+
+// openChild returns the file name in the directory f.
+func (f *PassthroughFile) openChild(name string) (*PassthroughFile, error) {
+	fd, err := openBeneath(f.fd, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	parentFd, err := dupFd(f.fd)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	var st unix.Stat_t
+	err = unix.Fstat(fd, &st)
+	if err != nil {
+		_ = unix.Close(fd)
+		_ = unix.Close(parentFd)
+		return nil, err
+	}
+	return f.newChild(parentFd, fd, name, &st), nil
+}
+
+func (f *PassthroughFile) childQid(name string) (Qid, error) {
+	var st unix.Stat_t
+	err := unix.Fstatat(f.fd, name, &st, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		return Qid{}, err
+	}
+	return f.root.qid(&st), nil
+}
+
+func (f *PassthroughFile) Read(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	fd, err := f.getOpenFd()
+	if err != nil {
+		return 0, err
+	}
+	n, err := unix.Pread(fd, buf, int64(offset))
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
+func (f *PassthroughFile) Write(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	f.lock.Lock()
+	xattr := f.xattr
+	f.lock.Unlock()
+	if xattr != nil {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		end := offset + uint64(len(buf))
+		if end > xattr.size || end < offset {
+			return 0, unix.ERANGE
+		}
+		if uint64(len(xattr.data)) < end {
+			xattr.data = append(xattr.data, make([]byte, end-uint64(len(xattr.data)))...)
+		}
+		copy(xattr.data[offset:], buf)
+		return uint32(len(buf)), nil
+	}
+
+	fd, err := f.getOpenFd()
+	if err != nil {
+		return 0, err
+	}
+	n, err := unix.Pwrite(fd, buf, int64(offset))
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
+func (f *PassthroughFile) Readdir(ctx context.Context, offset uint64, count uint32) ([]DirEnt, error) {
+	// The descriptor position is shared, so hold the lock while reading.
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.openFd == -1 {
+		return nil, unix.EBADF
+	}
+	_, err := unix.Seek(f.openFd, int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	isRoot := f.isRoot()
+	ents := []DirEnt{}
+	buf := make([]byte, count)
+	n, err := unix.Getdents(f.openFd, buf)
+	if err != nil {
+		return nil, err
+	}
+	sz := uint64(0)
+	for b := buf[:n]; len(b) > 0; {
+		dirent := (*unix.Dirent)(unsafe.Pointer(&b[0]))
+		reclen := int(dirent.Reclen)
+		name := b[unsafe.Offsetof(dirent.Name):reclen]
+		if i := bytes.IndexByte(name, 0); i != -1 {
+			name = name[:i]
+		}
+		b = b[reclen:]
+
+		ent := DirEnt{
+			Offset: uint64(dirent.Off),
+			Typ:    dirent.Type,
+			Name:   string(name),
+		}
+		sz += ent.EncodedSize()
+		if sz > uint64(count) {
+			break
+		}
+		ent.Qid = f.direntQid(ent.Name, dirent, isRoot)
+		ents = append(ents, ent)
+	}
+	return ents, nil
+}
+
+// direntQid returns the qid of the entry name of the directory f,
+// matching the qid a walk to name returns. d_ino is not used as it
+// differs from the inode number of mount points.
+func (f *PassthroughFile) direntQid(name string, dirent *unix.Dirent, isRoot bool) Qid {
+	if name == ".." && isRoot {
+		return f.qid
+	}
+	var st unix.Stat_t
+	err := unix.Fstatat(f.openFd, name, &st, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		// Removed since it was read.
+		mode := uint32(unix.S_IFREG)
+		switch dirent.Type {
+		case unix.DT_DIR:
+			mode = unix.S_IFDIR
+		case unix.DT_LNK:
+			mode = unix.S_IFLNK
+		}
+		return f.root.qids.Qid(passthroughInode{dev: f.dev, ino: dirent.Ino}, mode)
+	}
+	return f.root.qid(&st)
+}
+
+func (f *PassthroughFile) SetAttr(ctx context.Context, attr LSetAttr) error {
+	// Paths via procfs follow symlinks, so must only be used on other files.
+	path := procFdPath(f.fd)
+	if attr.Valid&L_SETATTR_MODE != 0 {
+		if f.isSymlink() {
+			return unix.EOPNOTSUPP
+		}
+		err := unix.Fchmodat(unix.AT_FDCWD, path, attr.Mode&0o7777, 0)
+		if err != nil {
+			return err
+		}
+	}
+	if attr.Valid&(L_SETATTR_UID|L_SETATTR_GID) != 0 {
+		uid, gid := -1, -1
+		if attr.Valid&L_SETATTR_UID != 0 {
+			uid = int(attr.Uid)
+		}
+		if attr.Valid&L_SETATTR_GID != 0 {
+			gid = int(attr.Gid)
+		}
+		err := unix.Fchownat(f.fd, "", uid, gid, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW)
+		if err != nil {
+			return err
+		}
+	}
+	if attr.Valid&L_SETATTR_SIZE != 0 {
+		if f.isSymlink() {
+			return unix.EINVAL
+		}
+		err := unix.Truncate(path, int64(attr.Size))
+		if err != nil {
+			return err
+		}
+	}
+	if attr.Valid&(L_SETATTR_ATIME|L_SETATTR_MTIME) != 0 {
+		ts := []unix.Timespec{
+			{Nsec: unix.UTIME_OMIT},
+			{Nsec: unix.UTIME_OMIT},
+		}
+		if attr.Valid&L_SETATTR_ATIME != 0 {
+			ts[0].Nsec = unix.UTIME_NOW
+			if attr.Valid&L_SETATTR_ATIME_SET != 0 {
+				ts[0] = unix.NsecToTimespec(int64(attr.AtimeSec)*1e9 + int64(attr.AtimeNsec))
+			}
+		}
+		if attr.Valid&L_SETATTR_MTIME != 0 {
+			ts[1].Nsec = unix.UTIME_NOW
+			if attr.Valid&L_SETATTR_MTIME_SET != 0 {
+				ts[1] = unix.NsecToTimespec(int64(attr.MtimeSec)*1e9 + int64(attr.MtimeNsec))
+			}
+		}
+		var err error
+		if f.isSymlink() {
+			var linkPath string
+			linkPath, err = f.symlinkPath()
+			if err == nil {
+				err = unix.UtimesNanoAt(unix.AT_FDCWD, linkPath, ts, unix.AT_SYMLINK_NOFOLLOW)
+			}
+		} else {
+			err = unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, 0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *PassthroughFile) Mkdir(ctx context.Context, name string, mode uint32, gid uint32) (Qid, error) {
+	err := passthroughCreate(ctx, f.fd, name, gid, func() error {
+		return unix.Mkdirat(f.fd, name, mode&0o7777)
+	})
+	if err != nil {
+		return Qid{}, err
+	}
+	return f.childQid(name)
+}
+
+func (f *PassthroughFile) Symlink(ctx context.Context, name string, target string, gid uint32) (Qid, error) {
+	err := passthroughCreate(ctx, f.fd, name, gid, func() error {
+		return unix.Symlinkat(target, f.fd, name)
+	})
+	if err != nil {
+		return Qid{}, err
+	}
+	return f.childQid(name)
+}
+
+func (f *PassthroughFile) Mknod(ctx context.Context, name string, mode uint32, major uint32, minor uint32, gid uint32) (Qid, error) {
+	err := passthroughCreate(ctx, f.fd, name, gid, func() error {
+		return unix.Mknodat(f.fd, name, mode, int(unix.Mkdev(major, minor)))
+	})
+	if err != nil {
+		return Qid{}, err
+	}
+	return f.childQid(name)
+}
+
+func (f *PassthroughFile) Readlink(ctx context.Context) (string, error) {
+	buf := make([]byte, 4096)
+	n, err := unix.Readlinkat(f.fd, "", buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+func (f *PassthroughFile) Link(ctx context.Context, name string, file DotLFile) error {
+	target, ok := file.(*PassthroughFile)
+	if !ok {
+		return unix.EXDEV
+	}
+	if target.isSymlink() {
+		linkPath, err := target.symlinkPath()
+		if err != nil {
+			return err
+		}
+		return unix.Linkat(unix.AT_FDCWD, linkPath, f.fd, name, 0)
+	}
+	return unix.Linkat(unix.AT_FDCWD, procFdPath(target.fd), f.fd, name, unix.AT_SYMLINK_FOLLOW)
+}
+
+// parentLocked returns the directory and name of f, finding them if f
+// was walked to by "." or "..". It fails with ESTALE if the name now
+// refers to another file. f.lock must be held.
+func (f *PassthroughFile) parentLocked() (int, string, error) {
+	var st unix.Stat_t
+	err := unix.Fstat(f.fd, &st)
+	if err != nil {
+		return -1, "", err
+	}
+	if f.parentFd == -1 {
+		err = f.findParentLocked(&st)
+		if err != nil {
+			return -1, "", err
+		}
+	}
+	var nameSt unix.Stat_t
+	err = unix.Fstatat(f.parentFd, f.name, &nameSt, unix.AT_SYMLINK_NOFOLLOW)
+	if err == unix.ENOENT || (err == nil && (nameSt.Dev != st.Dev || nameSt.Ino != st.Ino)) {
+		// Renamed or replaced through another fid.
+		return -1, "", unix.ESTALE
+	}
+	if err != nil {
+		return -1, "", err
+	}
+	return f.parentFd, f.name, nil
+}
+
+// findParentLocked sets the parent and name of the directory f with
+// the attributes st. f.lock must be held.
+func (f *PassthroughFile) findParentLocked(st *unix.Stat_t) error {
+	if uint64(st.Dev) == f.root.dev && st.Ino == f.root.ino {
+		return unix.EBUSY
+	}
+	parentFd, err := unix.Openat(f.fd, "..", unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	ok, err := f.root.contains(parentFd)
+	if err == nil && !ok {
+		err = unix.EXDEV
+	}
+	var names []string
+	if err == nil {
+		var dirFd int
+		dirFd, err = unix.Openat(parentFd, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err == nil {
+			dir := os.NewFile(uintptr(dirFd), "")
+			names, err = dir.Readdirnames(-1)
+			_ = dir.Close()
+		}
+	}
+	if err != nil {
+		_ = unix.Close(parentFd)
+		return err
+	}
+	for _, name := range names {
+		var nameSt unix.Stat_t
+		err := unix.Fstatat(parentFd, name, &nameSt, unix.AT_SYMLINK_NOFOLLOW)
+		if err == nil && nameSt.Dev == st.Dev && nameSt.Ino == st.Ino {
+			f.parentFd = parentFd
+			f.name = name
+			return nil
+		}
+	}
+	_ = unix.Close(parentFd)
+	return unix.ESTALE
+}
+
+func (f *PassthroughFile) Rename(ctx context.Context, dir DotLFile, name string) error {
+	newDir, ok := dir.(*PassthroughFile)
+	if !ok {
+		return unix.EXDEV
+	}
+	newParentFd, err := dupFd(newDir.fd)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	parentFd, oldName, err := f.parentLocked()
+	if err != nil {
+		_ = unix.Close(newParentFd)
+		return err
+	}
+	err = unix.Renameat(parentFd, oldName, newDir.fd, name)
+	if err != nil {
+		_ = unix.Close(newParentFd)
+		return err
+	}
+	_ = unix.Close(f.parentFd)
+	f.parentFd = newParentFd
+	f.name = name
+	return nil
+}
+
+func (f *PassthroughFile) Renameat(ctx context.Context, oldName string, newDir DotLFile, newName string) error {
+	dir, ok := newDir.(*PassthroughFile)
+	if !ok {
+		return unix.EXDEV
+	}
+	return unix.Renameat(f.fd, oldName, dir.fd, newName)
+}
+
+func (f *PassthroughFile) Unlinkat(ctx context.Context, name string, flags uint32) error {
+	hostFlags := 0
+	if flags&L_AT_REMOVEDIR != 0 {
+		hostFlags = unix.AT_REMOVEDIR
+	}
+	return unix.Unlinkat(f.fd, name, hostFlags)
+}
+
+func (f *PassthroughFile) Remove(ctx context.Context) error {
+	defer f.Clunk()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	parentFd, name, err := f.parentLocked()
+	if err != nil {
+		return err
+	}
+	flags := 0
+	if f.qid.Typ&QT_DIR != 0 {
+		flags = unix.AT_REMOVEDIR
+	}
+	return unix.Unlinkat(parentFd, name, flags)
+}
+
+// xattrPath returns the path and whether the l prefixed xattr
+// calls must be used to avoid following a symlink.
+func (f *PassthroughFile) xattrPath() (string, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.xattrPathLocked()
+}
+
+func (f *PassthroughFile) xattrPathLocked() (string, bool, error) {
+	if f.isSymlink() {
+		path, err := f.symlinkPathLocked()
+		return path, true, err
+	}
+	return procFdPath(f.fd), false, nil
+}
+
+func (f *PassthroughFile) XattrWalk(ctx context.Context, name string) (DotLFile, uint64, error) {
+	path, nofollow, err := f.xattrPath()
+	if err != nil {
+		return nil, 0, err
+	}
+	var data []byte
+	for {
+		var sz int
+		var err error
+		switch {
+		case name == "" && nofollow:
+			sz, err = unix.Llistxattr(path, data)
+		case name == "":
+			sz, err = unix.Listxattr(path, data)
+		case nofollow:
+			sz, err = unix.Lgetxattr(path, name, data)
+		default:
+			sz, err = unix.Getxattr(path, name, data)
+		}
+		if err == unix.ERANGE {
+			data = nil
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if sz <= len(data) {
+			data = data[:sz]
+			break
+		}
+		data = make([]byte, sz)
+	}
+	return &passthroughXattrFile{qid: f.qid, data: data}, uint64(len(data)), nil
+}
+
+func (f *PassthroughFile) XattrCreate(ctx context.Context, name string, size uint64, flags uint32) error {
+	if size > 65536 {
+		return unix.E2BIG
+	}
+	// Changing the filesystem uid keeps capabilities such as
+	// CAP_SYS_ADMIN, which would let any user set these.
+	if cred, ok := CredentialFromContext(ctx); ok && cred.Uid != 0 {
+		if strings.HasPrefix(name, "trusted.") || strings.HasPrefix(name, "security.") {
+			return unix.EPERM
+		}
+	}
+	hostFlags := 0
+	if flags&L_XATTR_CREATE != 0 {
+		hostFlags |= unix.XATTR_CREATE
+	}
+	if flags&L_XATTR_REPLACE != 0 {
+		hostFlags |= unix.XATTR_REPLACE
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.xattr != nil || f.openFd != -1 {
+		return unix.EBADF
+	}
+	f.xattr = &passthroughXattrWrite{
+		name:  name,
+		size:  size,
+		flags: hostFlags,
+	}
+	return nil
+}
+
+// commitXattr is called with f.lock held.
+func (f *PassthroughFile) commitXattr(xattr *passthroughXattrWrite) error {
+	path, nofollow, err := f.xattrPathLocked()
+	if err != nil {
+		return err
+	}
+	removexattr, setxattr := unix.Removexattr, unix.Setxattr
+	if nofollow {
+		removexattr, setxattr = unix.Lremovexattr, unix.Lsetxattr
+	}
+	if xattr.size == 0 && xattr.flags&unix.XATTR_CREATE == 0 {
+		// Linux clients remove attributes by setting an empty value.
+		err := removexattr(path, xattr.name)
+		if err != unix.ENODATA {
+			return err
+		}
+	}
+	if uint64(len(xattr.data)) != xattr.size {
+		return unix.EINVAL
+	}
+	return setxattr(path, xattr.name, xattr.data, xattr.flags)
+}
+
+func lockTypeToHost(typ byte) (int16, error) {
+	switch typ {
+	case L_LOCK_TYPE_RDLCK:
+		return unix.F_RDLCK, nil
+	case L_LOCK_TYPE_WRLCK:
+		return unix.F_WRLCK, nil
+	case L_LOCK_TYPE_UNLCK:
+		return unix.F_UNLCK, nil
+	default:
+		return 0, unix.EINVAL
+	}
+}
+
+// Record locks are taken as open file description locks on a
+// descriptor per file and lock owner, shared by every passthrough
+// filesystem in the process. The host kernel resolves conflicts with
+// other owners, other servers and host processes, while the locks of
+// one owner never conflict with each other, as with POSIX locks.
+var passthroughLockFds = struct {
+	lock sync.Mutex
+	fds  map[passthroughLockKey]*passthroughLockFd
+}{
+	fds: make(map[passthroughLockKey]*passthroughLockFd),
+}
+
+type passthroughLockKey struct {
+	dev   uint64
+	path  uint64
+	owner LockOwner
+}
+
+type passthroughLockFd struct {
+	fd int
+	// The files the owner has locked through.
+	handles map[*PassthroughFile]struct{}
+	// Lock requests using fd, it is closed once there are none
+	// and the owner's locks have been released.
+	users    int
+	released bool
+}
+
+func (f *PassthroughFile) lockKey(procId uint32, clientId string) passthroughLockKey {
+	return passthroughLockKey{
+		dev:   f.dev,
+		path:  f.qid.Path,
+		owner: LockOwner{ProcId: procId, ClientId: clientId},
+	}
+}
+
+// ownerLockFd returns the lock descriptor of owner, opening it if
+// create is set, or nil. The descriptor must be passed to putLockFd.
+func (f *PassthroughFile) ownerLockFd(key passthroughLockKey, create bool) (*passthroughLockFd, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.openFd == -1 {
+		return nil, unix.EBADF
+	}
+	passthroughLockFds.lock.Lock()
+	defer passthroughLockFds.lock.Unlock()
+	lfd, ok := passthroughLockFds.fds[key]
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		// Reopen the file, so the owner's locks are separate
+		// from those taken through other descriptors.
+		fd, err := unix.Open(procFdPath(f.openFd), unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+		if err != nil {
+			// Locks of the same type as the file's access mode
+			// can still be taken.
+			flags, ferr := unix.FcntlInt(uintptr(f.openFd), unix.F_GETFL, 0)
+			if ferr != nil {
+				return nil, err
+			}
+			fd, err = unix.Open(procFdPath(f.openFd), flags&unix.O_ACCMODE|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		lfd = &passthroughLockFd{fd: fd, handles: make(map[*PassthroughFile]struct{})}
+		passthroughLockFds.fds[key] = lfd
+	}
+	if create {
+		lfd.handles[f] = struct{}{}
+	}
+	lfd.users += 1
+	return lfd, nil
+}
+
+func putLockFd(lfd *passthroughLockFd) {
+	passthroughLockFds.lock.Lock()
+	defer passthroughLockFds.lock.Unlock()
+	lfd.users -= 1
+	if lfd.released && lfd.users == 0 {
+		_ = unix.Close(lfd.fd)
+	}
+}
+
+// releaseLocks drops the locks of every owner that locked through f,
+// like POSIX close this includes their locks taken through other fids.
+// f.lock must be held.
+func (f *PassthroughFile) releaseLocks() {
+	passthroughLockFds.lock.Lock()
+	defer passthroughLockFds.lock.Unlock()
+	for key, lfd := range passthroughLockFds.fds {
+		if _, ok := lfd.handles[f]; !ok {
+			continue
+		}
+		delete(passthroughLockFds.fds, key)
+		lfd.released = true
+		if lfd.users == 0 {
+			_ = unix.Close(lfd.fd)
+		}
+	}
+}
+
+func (f *PassthroughFile) Lock(ctx context.Context, lock LSetLock) (byte, error) {
+	typ, err := lockTypeToHost(lock.Typ)
+	if err != nil {
+		return L_LOCK_ERROR, err
+	}
+	flock := unix.Flock_t{
+		Type:   typ,
+		Whence: 0,
+		Start:  int64(lock.Start),
+		Len:    int64(lock.Length),
+	}
+	// Waiting in F_OFD_SETLKW could not be interrupted by a
+	// flush, so blocking requests poll instead.
+	delay := 10 * time.Millisecond
+	for {
+		status, err := f.trySetLock(lock, &flock)
+		if status != L_LOCK_BLOCKED || lock.Flags&L_LOCK_FLAGS_BLOCK == 0 {
+			return status, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return L_LOCK_ERROR, ctx.Err()
+		}
+		if delay < time.Second {
+			delay *= 2
+		}
+	}
+}
+
+func (f *PassthroughFile) trySetLock(lock LSetLock, flock *unix.Flock_t) (byte, error) {
+	lfd, err := f.ownerLockFd(f.lockKey(lock.ProcId, lock.ClientId), flock.Type != unix.F_UNLCK)
+	if err != nil {
+		return L_LOCK_ERROR, err
+	}
+	if lfd == nil {
+		// The owner holds no locks on the file.
+		return L_LOCK_SUCCESS, nil
+	}
+	defer putLockFd(lfd)
+	err = unix.FcntlFlock(uintptr(lfd.fd), unix.F_OFD_SETLK, flock)
+	switch err {
+	case nil:
+		return L_LOCK_SUCCESS, nil
+	case unix.EAGAIN, unix.EACCES:
+		return L_LOCK_BLOCKED, nil
+	default:
+		return L_LOCK_ERROR, err
+	}
+}
+
+func (f *PassthroughFile) GetLock(ctx context.Context, lock LGetLock) (LGetLock, error) {
+	typ, err := lockTypeToHost(lock.Typ)
+	if err != nil {
+		return LGetLock{}, err
+	}
+	fd, err := f.getOpenFd()
+	if err != nil {
+		return LGetLock{}, err
+	}
+	// The owner's own locks must not be reported.
+	lfd, err := f.ownerLockFd(f.lockKey(lock.ProcId, lock.ClientId), false)
+	if err != nil {
+		return LGetLock{}, err
+	}
+	if lfd != nil {
+		defer putLockFd(lfd)
+		fd = lfd.fd
+	}
+	flock := unix.Flock_t{
+		Type:   typ,
+		Whence: 0,
+		Start:  int64(lock.Start),
+		Len:    int64(lock.Length),
+	}
+	err = unix.FcntlFlock(uintptr(fd), unix.F_OFD_GETLK, &flock)
+	if err != nil {
+		return LGetLock{}, err
+	}
+	if flock.Type == unix.F_UNLCK {
+		lock.Typ = L_LOCK_TYPE_UNLCK
+		return lock, nil
+	}
+	lock.Typ = L_LOCK_TYPE_WRLCK
+	if flock.Type == unix.F_RDLCK {
+		lock.Typ = L_LOCK_TYPE_RDLCK
+	}
+	lock.Start = uint64(flock.Start)
+	lock.Length = uint64(flock.Len)
+	// The owner of an open file description lock is unknown.
+	lock.ProcId = 0xffffffff
+	lock.ClientId = ""
+	return lock, nil
+}
+
+func (f *PassthroughFile) Fsync(ctx context.Context) error {
+	fd, err := f.getOpenFd()
+	if err != nil {
+		return err
+	}
+	return unix.Fsync(fd)
+}
+
+func (f *PassthroughFile) Statfs(ctx context.Context) (LStatfs, error) {
+	var st unix.Statfs_t
+	err := unix.Fstatfs(f.fd, &st)
+	if err != nil {
+		return LStatfs{}, err
+	}
+	return LStatfs{
+		Typ:     uint32(st.Type),
+		Bsize:   uint32(st.Bsize),
+		Blocks:  st.Blocks,
+		Bfree:   st.Bfree,
+		Bavail:  st.Bavail,
+		Files:   st.Files,
+		Ffree:   st.Ffree,
+		Fsid:    uint64(uint32(st.Fsid.Val[0])) | uint64(uint32(st.Fsid.Val[1]))<<32,
+		Namelen: uint32(st.Namelen),
+	}, nil
+}
+
+func (f *PassthroughFile) Clunk() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var err error
+	if f.xattr != nil {
+		err = f.commitXattr(f.xattr)
+		f.xattr = nil
+	}
+	f.releaseLocks()
+	for _, fd := range []*int{&f.openFd, &f.parentFd, &f.fd} {
+		if *fd != -1 {
+			_ = unix.Close(*fd)
+			*fd = -1
+		}
+	}
+	return err
+}
+
+// passthroughXattrFile is the result of Txattrwalk.
+type passthroughXattrFile struct {
+	qid  Qid
+	data []byte
+}
+
+func (f *passthroughXattrFile) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	return nil, nil, unix.EINVAL
+}
+
+func (f *passthroughXattrFile) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	return LAttr{}, unix.EINVAL
+}
+
+func (f *passthroughXattrFile) Read(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	if offset >= uint64(len(f.data)) {
+		return 0, nil
+	}
+	return uint32(copy(buf, f.data[offset:])), nil
+}
+
+func (f *passthroughXattrFile) Clunk() error {
+	return nil
+}
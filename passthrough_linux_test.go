@@ -0,0 +1,696 @@
+package proto9
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// Create an export with a sibling directory holding a secret
+// file that clients must never be able to reach.
+func newEscapeTestClient(t *testing.T) (*ClientDotLFile, string, string) {
+	dir := t.TempDir()
+	export := filepath.Join(dir, "export")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{export, outside} {
+		err := os.Mkdir(d, 0o777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeTestClient(t, NewPassthroughFilesystem(export))
+	root, _, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { root.Clunk() })
+	return root, export, outside
+}
+
+func expectSecretUnchanged(t *testing.T, outside string) {
+	t.Helper()
+	st, err := os.Stat(filepath.Join(outside, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() != int64(len("secret")) || st.Mode().Perm() != 0o644 {
+		t.Fatalf("secret was modified: %d %s", st.Size(), st.Mode())
+	}
+}
+
+func TestPassthroughSymlinkEscape(t *testing.T) {
+	root, export, outside := newEscapeTestClient(t)
+
+	err := os.Symlink(outside, filepath.Join(export, "dlink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(outside, "secret"), filepath.Join(export, "flink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = root.Walk([]string{"dlink", "secret"})
+	if err == nil {
+		t.Fatal("walked through a symlink")
+	}
+
+	f, _, err := root.Walk([]string{"flink"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+	err = f.Open(L_O_RDWR)
+	if err == nil {
+		t.Fatal("opened a symlink")
+	}
+	err = f.SetAttr(LSetAttr{Valid: L_SETATTR_MODE, Mode: 0o777})
+	if err == nil {
+		t.Fatal("changed the mode of a symlink")
+	}
+	err = f.SetAttr(LSetAttr{Valid: L_SETATTR_SIZE, Size: 0})
+	if err == nil {
+		t.Fatal("truncated a symlink")
+	}
+
+	err = root.Link("hardlink", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Lstat(filepath.Join(export, "hardlink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("hard link followed the symlink")
+	}
+
+	cf, _, err := root.Walk(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Clunk()
+	_, _, err = cf.Create("flink", L_O_WRONLY|L_O_TRUNC, 0o644, 0)
+	if err == nil {
+		t.Fatal("created through a symlink")
+	}
+
+	expectSecretUnchanged(t, outside)
+}
+
+func TestPassthroughDotDotAtRoot(t *testing.T) {
+	root, _, _ := newEscapeTestClient(t)
+
+	rootAttr, err := root.GetAttr(L_GETATTR_BASIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := AttachDotL(root.Client, "../..", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+	attr, err := f.GetAttr(L_GETATTR_BASIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Qid != rootAttr.Qid {
+		t.Fatalf("attach escaped the root: %s", attr.Qid.String())
+	}
+
+	wf, qids, err := root.Walk([]string{"..", "..", ".."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wf.Clunk()
+	for _, qid := range qids {
+		if qid != rootAttr.Qid {
+			t.Fatalf("walk escaped the root: %s", qid.String())
+		}
+	}
+}
+
+func TestPassthroughMovedOutside(t *testing.T) {
+	root, export, outside := newEscapeTestClient(t)
+
+	err := os.Mkdir(filepath.Join(export, "a"), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := root.Walk([]string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+
+	err = os.Rename(filepath.Join(export, "a"), filepath.Join(outside, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = f.Walk([]string{"..", "secret"})
+	var rlerror *Rlerror
+	if !errors.As(err, &rlerror) || rlerror.Ecode != EXDEV {
+		t.Fatalf("expected EXDEV walking out of the export, got %v", err)
+	}
+}
+
+func TestPassthroughSymlinkSwap(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		name := "openat2"
+		if fallback {
+			name = "fallback"
+		}
+		t.Run(name, func(t *testing.T) {
+			if fallback {
+				old := atomic.LoadInt32(&openat2Unsupported)
+				atomic.StoreInt32(&openat2Unsupported, 1)
+				defer atomic.StoreInt32(&openat2Unsupported, old)
+			}
+			testPassthroughSymlinkSwap(t)
+		})
+	}
+}
+
+func testPassthroughSymlinkSwap(t *testing.T) {
+	root, export, outside := newEscapeTestClient(t)
+
+	d := filepath.Join(export, "d")
+	alt := filepath.Join(export, "alt")
+	err := os.Mkdir(d, 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(d, "secret"), []byte("inside"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(outside, alt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep swapping d between the directory and the symlink.
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			err := unix.Renameat2(unix.AT_FDCWD, d, unix.AT_FDCWD, alt, unix.RENAME_EXCHANGE)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	buf := make([]byte, 64)
+	for i := 0; i < 500; i++ {
+		f, _, err := root.Walk([]string{"d", "secret"})
+		if err != nil {
+			continue
+		}
+		err = f.Open(L_O_RDONLY)
+		if err == nil {
+			n, _ := f.Read(0, buf)
+			if string(buf[:n]) == "secret" {
+				_ = f.Clunk()
+				t.Fatal("read a file outside the export")
+			}
+		}
+		_ = f.Clunk()
+	}
+	expectSecretUnchanged(t, outside)
+}
+
+func TestPassthroughQids(t *testing.T) {
+	root, export, _ := newEscapeTestClient(t)
+	err := os.WriteFile(filepath.Join(export, "f"), nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"f"}
+	for _, d := range []string{"d", "m"} {
+		err := os.Mkdir(filepath.Join(export, d), 0o777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, d)
+	}
+	// The inode number of a mount point differs from d_ino.
+	err = unix.Mount("none", filepath.Join(export, "m"), "tmpfs", 0, "")
+	if err == nil {
+		t.Cleanup(func() { _ = unix.Unmount(filepath.Join(export, "m"), unix.MNT_DETACH) })
+	} else {
+		t.Logf("not testing a mount point: %s", err)
+	}
+
+	rootAttr, err := root.GetAttr(L_GETATTR_BASIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Qid{".": rootAttr.Qid, "..": rootAttr.Qid}
+	for _, name := range names {
+		qids := walkQids(t, root, name)
+		for other, qid := range expected {
+			if qid.Path == qids[0].Path && other != "." && other != ".." {
+				t.Fatalf("%s and %s share the qid path %d", name, other, qid.Path)
+			}
+		}
+		expected[name] = qids[0]
+	}
+
+	d := walkRamFS(t, root)
+	err = d.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents, err := d.ReaddirAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != len(expected) {
+		t.Fatalf("unexpected entries %v", ents)
+	}
+	for _, ent := range ents {
+		qid := expected[ent.Name]
+		if ent.Qid != qid {
+			t.Fatalf("%s: readdir qid %s differs from %s", ent.Name, ent.Qid.String(), qid.String())
+		}
+	}
+}
+
+func TestPassthroughStaleName(t *testing.T) {
+	root, export, _ := newEscapeTestClient(t)
+	for _, name := range []string{"x", "y"} {
+		err := os.WriteFile(filepath.Join(export, name), []byte(name), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	xf := walkRamFS(t, root, "x")
+	yf := walkRamFS(t, root, "y")
+
+	// Replace x through another fid.
+	err := root.Renameat("y", root, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xf.Rename(root, "z")
+	expectRlerror(t, err, ESTALE)
+	err = xf.Remove()
+	expectRlerror(t, err, ESTALE)
+	data, err := os.ReadFile(filepath.Join(export, "x"))
+	if err != nil || string(data) != "y" {
+		t.Fatalf("the replacement was changed: %q %v", data, err)
+	}
+	err = yf.Remove()
+	expectRlerror(t, err, ESTALE)
+
+	// Directories walked to by "." and ".." find their names.
+	err = os.MkdirAll(filepath.Join(export, "a", "b"), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, root, "a", ".").Rename(root, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, root, "c", "b", "..").Rename(root, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, root, "d", "b", ".").Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(export, "d", "b"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("d/b was not removed: %v", err)
+	}
+	err = walkRamFS(t, root, "d", "..").Remove()
+	expectRlerror(t, err, EBUSY)
+}
+
+func walkQids(t *testing.T, f *ClientDotLFile, names ...string) []Qid {
+	t.Helper()
+	wf, qids, err := f.Walk(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = wf.Clunk()
+	return qids
+}
+
+// Create a directory that every user may reach.
+func newMultiUserExport(t *testing.T) string {
+	dir := t.TempDir()
+	export := filepath.Join(dir, "export")
+	err := os.Mkdir(export, 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{filepath.Dir(dir), dir, export} {
+		err := os.Chmod(d, 0o777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return export
+}
+
+func TestPassthroughMultiUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	export := newMultiUserExport(t)
+	err := os.WriteFile(filepath.Join(export, "secret"), []byte("secret"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := StaticUserDB{
+		"root":  {Uid: 0, Gid: 0},
+		"alice": {Uid: 1000, Gid: 1000},
+		"bob":   {Uid: 1001, Gid: 1001},
+		"carol": {Uid: 1002, Gid: 1002, Groups: []uint32{1000}},
+	}
+	attach := func(uname string) *ClientDotLFile {
+		client := newPipeTestClient(t, NewMultiUserPassthroughFilesystem(export, users))
+		f, _, err := AttachDotL(client, "", uname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Clunk() })
+		return f
+	}
+	expectOwner := func(name string, uid uint32, gid uint32) {
+		t.Helper()
+		var st unix.Stat_t
+		err := unix.Lstat(filepath.Join(export, name), &st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Uid != uid || st.Gid != gid {
+			t.Fatalf("%s is owned by %d:%d", name, st.Uid, st.Gid)
+		}
+	}
+
+	root := attach("root")
+	err = walkRamFS(t, root, "secret").Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = walkRamFS(t, root).Create("rootfile", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOwner("rootfile", 0, 0)
+
+	alice := attach("alice")
+	err = walkRamFS(t, alice, "secret").Open(L_O_RDONLY)
+	expectRlerror(t, err, EACCES)
+	_, _, err = walkRamFS(t, alice).Create("f", L_O_RDWR, 0o644, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOwner("f", 1000, 1000)
+	_, err = alice.Mkdir("d", 0o750, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOwner("d", 1000, 1000)
+	err = walkRamFS(t, alice, "rootfile").SetAttr(LSetAttr{Valid: L_SETATTR_MODE, Mode: 0o666})
+	expectRlerror(t, err, EPERM)
+
+	// A permission error from openat2 must not be mistaken for
+	// openat2 being unavailable.
+	supported := atomic.LoadInt32(&openat2Unsupported) == 0
+	_, _, err = walkRamFS(t, attach("bob")).Create("f", L_O_RDONLY|L_O_NOATIME, 0o644, 1001)
+	expectRlerror(t, err, EPERM)
+	if supported && atomic.LoadInt32(&openat2Unsupported) != 0 {
+		t.Fatal("EPERM disabled openat2")
+	}
+
+	// Supplementary groups are honoured.
+	_, _, err = walkRamFS(t, attach("carol"), "d").Walk([]string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = walkRamFS(t, attach("bob"), "d").Walk([]string{"."})
+	expectRlerror(t, err, EACCES)
+
+	// The server's own credentials are restored after each request.
+	if os.Getuid() != 0 || os.Getegid() != 0 {
+		t.Fatal("server credentials were changed")
+	}
+	err = os.WriteFile(filepath.Join(export, "d", "fromserver"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPassthroughNewGid(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("setting arbitrary groups requires root")
+	}
+	export := newMultiUserExport(t)
+	expectGid := func(name string, gid uint32) {
+		t.Helper()
+		var st unix.Stat_t
+		err := unix.Lstat(filepath.Join(export, name), &st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Gid != gid {
+			t.Fatalf("%s has group %d, expected %d", name, st.Gid, gid)
+		}
+	}
+
+	client := newPipeTestClient(t, NewPassthroughFilesystem(export))
+	root, _, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Clunk()
+	_, err = root.Mkdir("d", 0o777, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid("d", 1234)
+	_, err = root.Symlink("l", "d", 1235)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid("l", 1235)
+	_, _, err = walkRamFS(t, root).Create("f", L_O_RDWR, 0o644, 1236)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid("f", 1236)
+
+	// Files in setgid directories keep the group of the directory.
+	err = os.Chmod(filepath.Join(export, "d"), os.ModeSetgid|0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = walkRamFS(t, root, "d").Mknod("p", L_S_IFIFO|0o644, 0, 0, 1237)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid("d/p", 1234)
+
+	// Users may only choose groups they are in.
+	users := StaticUserDB{"alice": {Uid: 1000, Gid: 1000, Groups: []uint32{1238}}}
+	client = newPipeTestClient(t, NewMultiUserPassthroughFilesystem(export, users))
+	alice, _, err := AttachDotL(client, "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Clunk()
+	_, err = alice.Mkdir("a", 0o777, 1238)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid("a", 1238)
+	_, err = alice.Mkdir("b", 0o777, 1239)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectGid("b", 1000)
+	if os.Getegid() != 0 {
+		t.Fatal("server credentials were changed")
+	}
+}
+
+func TestPassthroughMultiUserTeardown(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	export := newMultiUserExport(t)
+	path := filepath.Join(export, "rootfile")
+	err := os.WriteFile(path, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = unix.Setxattr(path, "user.probe", []byte("x"), 0)
+	if err != nil {
+		t.Skipf("user xattrs are unsupported: %s", err)
+	}
+	users := StaticUserDB{"alice": {Uid: 1000, Gid: 1000}}
+
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, NewMultiUserPassthroughFilesystem(export, users))
+	}()
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _, err := AttachDotL(client, "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	walk := func() *ClientDotLFile {
+		f, _, err := root.Walk([]string{"rootfile"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	err = walk().XattrCreate("trusted.x", 1, 0)
+	expectRlerror(t, err, EPERM)
+	f := walk()
+	err = f.XattrCreate("user.x", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(0, []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Disconnecting clunks the fid as alice, not as the server.
+	_ = c1.Close()
+	<-done
+	_, err = unix.Getxattr(path, "user.x", make([]byte, 8))
+	if !errors.Is(err, unix.ENODATA) {
+		t.Fatalf("the pending xattr was set on disconnect: %v", err)
+	}
+}
+
+func TestPassthroughMultiUserUnprivileged(t *testing.T) {
+	uid := os.Geteuid()
+	if uid == 0 {
+		t.Skip("requires a non root server")
+	}
+	export := newMultiUserExport(t)
+	users := StaticUserDB{
+		"self":  {Uid: uint32(uid), Gid: uint32(os.Getegid())},
+		"other": {Uid: uint32(uid) + 1, Gid: uint32(uid) + 1},
+	}
+	client := newPipeTestClient(t, NewMultiUserPassthroughFilesystem(export, users))
+	f, _, err := AttachDotL(client, "", "self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Clunk()
+	_, err = f.Mkdir("d", 0o755, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = AttachDotL(client, "", "other")
+	expectRlerror(t, err, EPERM)
+}
+
+func TestPassthroughLocks(t *testing.T) {
+	root, export, _ := newEscapeTestClient(t)
+	path := filepath.Join(export, "x")
+	err := os.WriteFile(path, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openLockFile := func() *ClientDotLFile {
+		f := walkRamFS(t, root, "x")
+		err := f.Open(L_O_RDWR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	expectStatus := func(f *ClientDotLFile, lock LSetLock, expected byte) {
+		t.Helper()
+		status, err := f.Lock(lock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != expected {
+			t.Fatalf("expected lock status %d, got %d", expected, status)
+		}
+	}
+	wrlck := LSetLock{Typ: L_LOCK_TYPE_WRLCK, Length: 10, ProcId: 1, ClientId: "a"}
+
+	// The same owner may lock through different fids.
+	lf1 := openLockFile()
+	lf2 := openLockFile()
+	expectStatus(lf1, wrlck, L_LOCK_SUCCESS)
+	expectStatus(lf2, wrlck, L_LOCK_SUCCESS)
+
+	// Client locks are visible to processes on the host.
+	host, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	flock := unix.Flock_t{Type: unix.F_WRLCK, Whence: 0, Start: 0, Len: 1}
+	err = unix.FcntlFlock(host.Fd(), unix.F_OFD_SETLK, &flock)
+	if !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EACCES) {
+		t.Fatalf("expected the host lock to conflict, got %v", err)
+	}
+
+	// Clunking a fid releases the locks of its owners.
+	err = lf1.Clunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lf2.Clunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = unix.FcntlFlock(host.Fd(), unix.F_OFD_SETLK, &flock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// And host locks are visible to clients.
+	lf3 := openLockFile()
+	expectStatus(lf3, wrlck, L_LOCK_BLOCKED)
+	flock.Type = unix.F_UNLCK
+	err = unix.FcntlFlock(host.Fd(), unix.F_OFD_SETLK, &flock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(lf3, wrlck, L_LOCK_SUCCESS)
+}
@@ -0,0 +1,263 @@
+package proto9
+
+import (
+	"context"
+	"strings"
+)
+
+// Access bits for CheckAccess.
+const (
+	MayExec  uint32 = 1
+	MayWrite uint32 = 2
+	MayRead  uint32 = 4
+)
+
+// CheckAccess checks the mode bits of a file with the given attributes
+// grant the access in want to cred, failing with EACCES if not. Like
+// POSIX, uid 0 is granted everything except executing files that have
+// no execute bits set.
+func CheckAccess(cred *Credential, attr LAttr, want uint32) error {
+	mode := attr.Mode
+	if cred.Uid == 0 {
+		if want&MayExec != 0 && mode&L_S_IFMT != L_S_IFDIR && mode&0o111 == 0 {
+			return &Rlerror{Ecode: EACCES}
+		}
+		return nil
+	}
+	var granted uint32
+	switch {
+	case cred.Uid == attr.Uid:
+		granted = (mode >> 6) & 7
+	case cred.InGroup(attr.Gid):
+		granted = (mode >> 3) & 7
+	default:
+		granted = mode & 7
+	}
+	if want&^granted != 0 {
+		return &Rlerror{Ecode: EACCES}
+	}
+	return nil
+}
+
+// checkAccess checks the request's credential has the access in
+// want to f.
+func checkAccess(ctx context.Context, f DotLFile, want uint32) error {
+	cred, ok := CredentialFromContext(ctx)
+	if !ok {
+		return &Rlerror{Ecode: EACCES}
+	}
+	attr, err := f.GetAttr(ctx, L_GETATTR_MODE|L_GETATTR_UID|L_GETATTR_GID)
+	if err != nil {
+		return err
+	}
+	return CheckAccess(cred, attr, want)
+}
+
+func openAccess(flags uint32) uint32 {
+	var want uint32
+	switch flags & L_O_ACCMODE {
+	case L_O_RDONLY:
+		want = MayRead
+	case L_O_WRONLY:
+		want = MayWrite
+	default:
+		want = MayRead | MayWrite
+	}
+	if flags&L_O_TRUNC != 0 {
+		want |= MayWrite
+	}
+	return want
+}
+
+// checkSetAttr applies the POSIX rules for changing attributes.
+func checkSetAttr(ctx context.Context, f DotLFile, set LSetAttr) error {
+	cred, ok := CredentialFromContext(ctx)
+	if !ok {
+		return &Rlerror{Ecode: EACCES}
+	}
+	if cred.Uid == 0 {
+		return nil
+	}
+	attr, err := f.GetAttr(ctx, L_GETATTR_MODE|L_GETATTR_UID|L_GETATTR_GID)
+	if err != nil {
+		return err
+	}
+	owner := cred.Uid == attr.Uid
+	if set.Valid&L_SETATTR_MODE != 0 && !owner {
+		return &Rlerror{Ecode: EPERM}
+	}
+	if set.Valid&L_SETATTR_UID != 0 && set.Uid != attr.Uid {
+		return &Rlerror{Ecode: EPERM}
+	}
+	if set.Valid&L_SETATTR_GID != 0 && set.Gid != attr.Gid && (!owner || !cred.InGroup(set.Gid)) {
+		return &Rlerror{Ecode: EPERM}
+	}
+	if set.Valid&(L_SETATTR_ATIME_SET|L_SETATTR_MTIME_SET) != 0 && !owner {
+		return &Rlerror{Ecode: EPERM}
+	}
+	if set.Valid&L_SETATTR_SIZE != 0 {
+		if err := CheckAccess(cred, attr, MayWrite); err != nil {
+			return err
+		}
+	}
+	if set.Valid&(L_SETATTR_ATIME|L_SETATTR_MTIME) != 0 && !owner {
+		// Setting the times to now only needs write access.
+		if err := CheckAccess(cred, attr, MayWrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckUnlink checks cred may remove or rename away a file with the
+// attributes file from a directory with the attributes dir. Only the
+// owners of the file or directory may do so if dir is sticky.
+func CheckUnlink(cred *Credential, dir LAttr, file LAttr) error {
+	err := CheckAccess(cred, dir, MayWrite|MayExec)
+	if err != nil {
+		return err
+	}
+	if dir.Mode&L_S_ISVTX != 0 && cred.Uid != 0 && cred.Uid != dir.Uid && cred.Uid != file.Uid {
+		return &Rlerror{Ecode: EPERM}
+	}
+	return nil
+}
+
+// checkUnlink checks the request's credential may remove name
+// from dir, which need not exist.
+func checkUnlink(ctx context.Context, dir DotLFile, name string) error {
+	cred, ok := CredentialFromContext(ctx)
+	if !ok {
+		return &Rlerror{Ecode: EACCES}
+	}
+	mask := uint64(L_GETATTR_MODE | L_GETATTR_UID | L_GETATTR_GID)
+	dirAttr, err := dir.GetAttr(ctx, mask)
+	if err != nil {
+		return err
+	}
+	if dirAttr.Mode&L_S_ISVTX == 0 {
+		return CheckAccess(cred, dirAttr, MayWrite|MayExec)
+	}
+	qids, f, err := dir.Walk(ctx, []string{name})
+	if f != nil {
+		defer f.Clunk()
+	}
+	if err != nil || len(qids) != 1 {
+		// Nothing is removed, the request fails or creates name.
+		return CheckAccess(cred, dirAttr, MayWrite|MayExec)
+	}
+	fileAttr, err := f.GetAttr(ctx, mask)
+	if err != nil {
+		return err
+	}
+	return CheckUnlink(cred, dirAttr, fileAttr)
+}
+
+// checkXattrCreate checks the request's credential may set the
+// extended attribute name of f. Only root may set attributes outside
+// the user namespace.
+func checkXattrCreate(ctx context.Context, f DotLFile, name string) error {
+	cred, ok := CredentialFromContext(ctx)
+	if !ok {
+		return &Rlerror{Ecode: EACCES}
+	}
+	if cred.Uid == 0 {
+		return nil
+	}
+	if !strings.HasPrefix(name, "user.") {
+		return &Rlerror{Ecode: EPERM}
+	}
+	return checkAccess(ctx, f, MayWrite)
+}
+
+// checkPermissions checks the credential of fc may make the request,
+// walks are checked by checkedWalk. The parent directory of the file
+// of a Tremove, or of the file being moved by a Trename, is unknown so
+// those directories are left to the filesystem to check, see
+// CheckUnlink.
+func (fs *DotLFilesystem) checkPermissions(ctx context.Context, fc Fcall) error {
+	// Checks requests that modify the directory dfid.
+	checkDir := func(dfid uint32) error {
+		dir, ok := fs.getFile(dfid)
+		if !ok {
+			return nil
+		}
+		return checkAccess(ctx, dir, MayWrite|MayExec)
+	}
+	// Checks requests that remove or replace name in dfid.
+	checkRemove := func(dfid uint32, name string) error {
+		dir, ok := fs.getFile(dfid)
+		if !ok {
+			return nil
+		}
+		return checkUnlink(ctx, dir, name)
+	}
+	switch fc := fc.(type) {
+	case *Tlopen:
+		if f, ok := fs.getFile(fc.Fid); ok {
+			return checkAccess(ctx, f, openAccess(fc.Flags))
+		}
+	case *Tsetattr:
+		if f, ok := fs.getFile(fc.Fid); ok {
+			return checkSetAttr(ctx, f, fc.LSetAttr)
+		}
+	case *Txattrcreate:
+		if f, ok := fs.getFile(fc.Fid); ok {
+			return checkXattrCreate(ctx, f, fc.Name)
+		}
+	case *Tlcreate:
+		return checkDir(fc.Fid)
+	case *Tmkdir:
+		return checkDir(fc.Dfid)
+	case *Tsymlink:
+		return checkDir(fc.Fid)
+	case *Tmknod:
+		return checkDir(fc.Fid)
+	case *Tlink:
+		return checkDir(fc.Dfid)
+	case *Tunlinkat:
+		return checkRemove(fc.Dfid, fc.Name)
+	case *Trename:
+		return checkRemove(fc.Dfid, fc.Name)
+	case *Trenameat:
+		if err := checkRemove(fc.OldDfid, fc.OldName); err != nil {
+			return err
+		}
+		return checkRemove(fc.NewDfid, fc.NewName)
+	}
+	return nil
+}
+
+// checkedWalk walks names one at a time, checking each directory
+// may be searched.
+func checkedWalk(ctx context.Context, f DotLFile, names []string) ([]Qid, DotLFile, error) {
+	if len(names) == 0 {
+		return f.Walk(ctx, names)
+	}
+	qids := make([]Qid, 0, len(names))
+	cur := f
+	release := func() {
+		if cur != f {
+			_ = cur.Clunk()
+		}
+	}
+	for _, name := range names {
+		err := checkAccess(ctx, cur, MayExec)
+		if err != nil {
+			release()
+			return qids, nil, err
+		}
+		stepQids, next, err := cur.Walk(ctx, []string{name})
+		if err != nil || len(stepQids) != 1 {
+			if next != nil {
+				_ = next.Clunk()
+			}
+			release()
+			return qids, nil, err
+		}
+		release()
+		qids = append(qids, stepQids[0])
+		cur = next
+	}
+	return qids, cur, nil
+}
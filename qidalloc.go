@@ -0,0 +1,78 @@
+package proto9
+
+import (
+	"sync"
+)
+
+// QidAllocator maps the identities of backend objects, such as inode
+// numbers or database keys, to qids with unique paths. Clients such as
+// 9pfuse2 use the qid path as an inode number, so two objects must never
+// share one. Paths are never reused, even after Forget.
+//
+// Keys must be comparable, the zero value is ready to use.
+type QidAllocator struct {
+	lock     sync.Mutex
+	nextPath uint64
+	qids     map[interface{}]Qid
+}
+
+// ModeToQidType returns the QT_* bits for a 9P2000.L file mode.
+func ModeToQidType(mode uint32) uint8 {
+	switch mode & L_S_IFMT {
+	case L_S_IFDIR:
+		return QT_DIR
+	case L_S_IFLNK:
+		return QT_SYMLINK
+	default:
+		return QT_FILE
+	}
+}
+
+// Qid returns the qid of the object identified by key, allocating a
+// path the first time key is seen. The type is set from mode.
+func (a *QidAllocator) Qid(key interface{}, mode uint32) Qid {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	qid, ok := a.qids[key]
+	if !ok {
+		if a.qids == nil {
+			a.qids = make(map[interface{}]Qid)
+		}
+		a.nextPath++
+		qid.Path = a.nextPath
+	}
+	qid.Typ = ModeToQidType(mode)
+	a.qids[key] = qid
+	return qid
+}
+
+// Lookup returns the qid of key without allocating one.
+func (a *QidAllocator) Lookup(key interface{}) (Qid, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	qid, ok := a.qids[key]
+	return qid, ok
+}
+
+// Modified increments the version of the qid of key, it should be
+// called whenever the object is written. It reports false if key
+// has no qid.
+func (a *QidAllocator) Modified(key interface{}) (Qid, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	qid, ok := a.qids[key]
+	if !ok {
+		return Qid{}, false
+	}
+	qid.Version++
+	a.qids[key] = qid
+	return qid, true
+}
+
+// Forget drops the qid of key, for example once the object has been
+// removed. If key is seen again it is given a new path.
+func (a *QidAllocator) Forget(key interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.qids, key)
+}
@@ -0,0 +1,65 @@
+package proto9
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQidAllocator(t *testing.T) {
+	type inode struct{ dev, ino uint64 }
+	a := &QidAllocator{}
+
+	f := a.Qid(inode{1, 10}, L_S_IFREG|0o644)
+	d := a.Qid(inode{2, 10}, L_S_IFDIR|0o755)
+	l := a.Qid("link", L_S_IFLNK|0o777)
+	if f.Path == d.Path || f.Path == l.Path || d.Path == l.Path {
+		t.Fatalf("paths collide %v %v %v", f, d, l)
+	}
+	if f.Typ != QT_FILE || d.Typ != QT_DIR || l.Typ != QT_SYMLINK {
+		t.Fatalf("unexpected types %v %v %v", f, d, l)
+	}
+	if a.Qid(inode{1, 10}, L_S_IFREG) != f {
+		t.Fatal("qid is not stable")
+	}
+
+	modified, ok := a.Modified(inode{1, 10})
+	if !ok || modified.Path != f.Path || modified.Version != f.Version+1 {
+		t.Fatalf("unexpected modified qid %v", modified)
+	}
+	if qid, ok := a.Lookup(inode{1, 10}); !ok || qid != modified {
+		t.Fatalf("unexpected lookup %v", qid)
+	}
+	if _, ok := a.Modified("missing"); ok {
+		t.Fatal("unknown key was modified")
+	}
+
+	a.Forget(inode{1, 10})
+	if _, ok := a.Lookup(inode{1, 10}); ok {
+		t.Fatal("forgotten key was found")
+	}
+	if qid := a.Qid(inode{1, 10}, L_S_IFREG); qid.Path == f.Path || qid.Version != 0 {
+		t.Fatalf("forgotten path was reused %v", qid)
+	}
+}
+
+func TestQidAllocatorConcurrent(t *testing.T) {
+	a := &QidAllocator{}
+	wg := &sync.WaitGroup{}
+	qids := make([]Qid, 100)
+	for i := range qids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			qids[i] = a.Qid(i, L_S_IFREG)
+			a.Modified(i)
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[uint64]struct{})
+	for _, qid := range qids {
+		if _, ok := seen[qid.Path]; ok {
+			t.Fatalf("duplicate path %d", qid.Path)
+		}
+		seen[qid.Path] = struct{}{}
+	}
+}
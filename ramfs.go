@@ -0,0 +1,855 @@
+package proto9
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RamFS is a filesystem held in memory. The tree is shared by
+// every connection served from NewFilesystem.
+type RamFS struct {
+	// If set, clients are identified with Users and file
+	// permissions are enforced, see DotLFilesystem.
+	Users UserDB
+	// The largest size of a file, writes and truncates beyond it
+	// fail with EFBIG. If zero, DefaultRamFSMaxFileSize is used.
+	MaxFileSize uint64
+
+	lock     sync.Mutex
+	root     *ramNode
+	nextPath uint64
+	// Record locks, keyed by *ramNode.
+	locks LockManager
+}
+
+type ramNode struct {
+	qid   Qid
+	mode  uint32
+	uid   uint32
+	gid   uint32
+	nlink uint64
+	rdev  uint64
+	atime time.Time
+	mtime time.Time
+	ctime time.Time
+
+	data     []byte
+	target   string
+	children map[string]*ramNode
+	parent   *ramNode
+	xattrs   map[string][]byte
+	// Readdir offsets of the children.
+	cookies DirCookies
+}
+
+const DefaultRamFSMaxFileSize = 1 << 30
+
+func NewRamFS() *RamFS {
+	fs := &RamFS{}
+	fs.root = fs.newNode(L_S_IFDIR|L_S_ISVTX|0o777, 0, 0)
+	fs.root.parent = fs.root
+	return fs
+}
+
+func (fs *RamFS) maxFileSize() uint64 {
+	if fs.MaxFileSize == 0 {
+		return DefaultRamFSMaxFileSize
+	}
+	return fs.MaxFileSize
+}
+
+// NewFilesystem returns a Filesystem for serving a single
+// connection, it may be passed directly to Serve.
+func (fs *RamFS) NewFilesystem() Filesystem {
+	return &DotLFilesystem{
+		Msize:            128*1024 + IOHDRSZ,
+		Attach:           fs.attach,
+		Users:            fs.Users,
+		CheckPermissions: fs.Users != nil,
+	}
+}
+
+func (fs *RamFS) attach(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+	uid := uint32(0)
+	if cred, ok := CredentialFromContext(ctx); ok {
+		uid = cred.Uid
+	} else if fc.N_uname != NONUNAME {
+		uid = fc.N_uname
+	}
+	root := &RamFile{fs: fs, node: fs.root, uid: uid}
+	names := []string{}
+	for _, name := range strings.Split(fc.Aname, "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	var qids []Qid
+	var f DotLFile
+	var err error
+	if _, ok := CredentialFromContext(ctx); ok {
+		qids, f, err = checkedWalk(ctx, root, names)
+	} else {
+		qids, f, err = root.Walk(ctx, names)
+	}
+	if err != nil {
+		return nil, Qid{}, err
+	}
+	if len(qids) != len(names) {
+		return nil, Qid{}, &Rlerror{Ecode: ENOENT}
+	}
+	rf := f.(*RamFile)
+	return rf, rf.node.qid, nil
+}
+
+func (fs *RamFS) newNode(mode uint32, uid uint32, gid uint32) *ramNode {
+	fs.nextPath++
+	now := time.Now()
+	n := &ramNode{
+		qid: Qid{
+			Typ:  ModeToQidType(mode),
+			Path: fs.nextPath,
+		},
+		mode:  mode,
+		uid:   uid,
+		gid:   gid,
+		nlink: 1,
+		atime: now,
+		mtime: now,
+		ctime: now,
+	}
+	if mode&L_S_IFMT == L_S_IFDIR {
+		n.nlink = 2
+		n.children = make(map[string]*ramNode)
+	}
+	return n
+}
+
+// permAttr returns the attributes used to check permissions.
+func (n *ramNode) permAttr() LAttr {
+	return LAttr{Mode: n.mode, Uid: n.uid, Gid: n.gid}
+}
+
+func (n *ramNode) isDir() bool {
+	return n.mode&L_S_IFMT == L_S_IFDIR
+}
+
+// modified records a change to the contents of n.
+func (n *ramNode) modified() {
+	n.qid.Version++
+	n.mtime = time.Now()
+	n.ctime = n.mtime
+}
+
+func (n *ramNode) direntType() uint8 {
+	switch n.mode & L_S_IFMT {
+	case L_S_IFDIR:
+		return L_DT_DIR
+	case L_S_IFREG:
+		return L_DT_REG
+	case L_S_IFLNK:
+		return L_DT_LNK
+	case L_S_IFIFO:
+		return L_DT_FIFO
+	case L_S_IFCHR:
+		return L_DT_CHR
+	case L_S_IFBLK:
+		return L_DT_BLK
+	case L_S_IFSOCK:
+		return L_DT_SOCK
+	default:
+		return L_DT_UNKNOWN
+	}
+}
+
+func (n *ramNode) size() uint64 {
+	if n.mode&L_S_IFMT == L_S_IFLNK {
+		return uint64(len(n.target))
+	}
+	return uint64(len(n.data))
+}
+
+// RamFile is a fid of a RamFS.
+type RamFile struct {
+	fs   *RamFS
+	node *ramNode
+	// The directory and name the file was walked through,
+	// dir is nil for the root.
+	dir  *ramNode
+	name string
+	// The attaching user, the owner of new files.
+	uid uint32
+
+	opened bool
+	flags  uint32
+	// Set by XattrCreate.
+	xattr *ramXattrWrite
+}
+
+type ramXattrWrite struct {
+	name  string
+	size  uint64
+	flags uint32
+	data  []byte
+}
+
+func (f *RamFile) child(n *ramNode, dir *ramNode, name string) *RamFile {
+	return &RamFile{
+		fs:   f.fs,
+		node: n,
+		dir:  dir,
+		name: name,
+		uid:  f.uid,
+	}
+}
+
+func (f *RamFile) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+
+	qids := make([]Qid, 0, len(names))
+	cur := f.child(f.node, f.dir, f.name)
+	for _, name := range names {
+		if !cur.node.isDir() {
+			return qids, nil, &Rlerror{Ecode: ENOTDIR}
+		}
+		var next *RamFile
+		switch name {
+		case ".":
+			next = f.child(cur.node, nil, "")
+		case "..":
+			next = f.child(cur.node.parent, nil, "")
+		default:
+			n, ok := cur.node.children[name]
+			if !ok {
+				return qids, nil, &Rlerror{Ecode: ENOENT}
+			}
+			next = f.child(n, cur.node, name)
+		}
+		cur = next
+		qids = append(qids, cur.node.qid)
+	}
+	return qids, cur, nil
+}
+
+func (f *RamFile) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	n := f.node
+	size := n.size()
+	return LAttr{
+		Valid:     L_GETATTR_BASIC,
+		Qid:       n.qid,
+		Mode:      n.mode,
+		Uid:       n.uid,
+		Gid:       n.gid,
+		Nlink:     n.nlink,
+		Rdev:      n.rdev,
+		Size:      size,
+		Blksize:   4096,
+		Blocks:    (size + 511) / 512,
+		AtimeSec:  uint64(n.atime.Unix()),
+		AtimeNsec: uint64(n.atime.Nanosecond()),
+		MtimeSec:  uint64(n.mtime.Unix()),
+		MtimeNsec: uint64(n.mtime.Nanosecond()),
+		CtimeSec:  uint64(n.ctime.Unix()),
+		CtimeNsec: uint64(n.ctime.Nanosecond()),
+	}, nil
+}
+
+func (f *RamFile) Open(ctx context.Context, flags uint32) (Qid, uint32, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if f.opened || f.xattr != nil {
+		return Qid{}, 0, &Rlerror{Ecode: EBADF}
+	}
+	n := f.node
+	switch n.mode & L_S_IFMT {
+	case L_S_IFLNK:
+		return Qid{}, 0, &Rlerror{Ecode: ELOOP}
+	case L_S_IFDIR:
+		if flags&L_O_ACCMODE != L_O_RDONLY {
+			return Qid{}, 0, &Rlerror{Ecode: EISDIR}
+		}
+	case L_S_IFREG:
+	default:
+		// Devices, fifos and sockets only exist as names.
+		return Qid{}, 0, &Rlerror{Ecode: EOPNOTSUPP}
+	}
+	if flags&L_O_TRUNC != 0 && flags&L_O_ACCMODE != L_O_RDONLY && len(n.data) != 0 {
+		n.data = nil
+		n.modified()
+	}
+	f.opened = true
+	f.flags = flags
+	return n.qid, 0, nil
+}
+
+func (f *RamFile) Create(ctx context.Context, name string, flags uint32, mode uint32, gid uint32) (DotLFile, Qid, uint32, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	dir := f.node
+	if !dir.isDir() {
+		return nil, Qid{}, 0, &Rlerror{Ecode: ENOTDIR}
+	}
+	if _, ok := dir.children[name]; ok {
+		return nil, Qid{}, 0, &Rlerror{Ecode: EEXIST}
+	}
+	n := f.fs.newNode(L_S_IFREG|(mode&0o7777), f.uid, newGid(ctx, dir, gid))
+	dir.children[name] = n
+	dir.modified()
+	newf := f.child(n, dir, name)
+	newf.opened = true
+	newf.flags = flags
+	return newf, n.qid, 0, nil
+}
+
+func (f *RamFile) Read(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if !f.opened || f.flags&L_O_ACCMODE == L_O_WRONLY {
+		return 0, &Rlerror{Ecode: EBADF}
+	}
+	n := f.node
+	if n.isDir() {
+		return 0, &Rlerror{Ecode: EISDIR}
+	}
+	n.atime = time.Now()
+	if offset >= uint64(len(n.data)) {
+		return 0, nil
+	}
+	return uint32(copy(buf, n.data[offset:])), nil
+}
+
+func (f *RamFile) Write(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if f.xattr != nil {
+		end := offset + uint64(len(buf))
+		if end > f.xattr.size || end < offset {
+			return 0, &Rlerror{Ecode: ERANGE}
+		}
+		if uint64(len(f.xattr.data)) < end {
+			f.xattr.data = append(f.xattr.data, make([]byte, end-uint64(len(f.xattr.data)))...)
+		}
+		copy(f.xattr.data[offset:], buf)
+		return uint32(len(buf)), nil
+	}
+	if !f.opened || f.flags&L_O_ACCMODE == L_O_RDONLY {
+		return 0, &Rlerror{Ecode: EBADF}
+	}
+	n := f.node
+	if f.flags&L_O_APPEND != 0 {
+		offset = uint64(len(n.data))
+	}
+	end := offset + uint64(len(buf))
+	if end < offset || end > f.fs.maxFileSize() {
+		return 0, &Rlerror{Ecode: EFBIG}
+	}
+	if end > uint64(len(n.data)) {
+		if end > uint64(cap(n.data)) {
+			size := end + end/2
+			if size > f.fs.maxFileSize() {
+				size = f.fs.maxFileSize()
+			}
+			data := make([]byte, end, size)
+			copy(data, n.data)
+			n.data = data
+		} else {
+			n.data = n.data[:end]
+		}
+	}
+	copy(n.data[offset:], buf)
+	n.modified()
+	return uint32(len(buf)), nil
+}
+
+func (f *RamFile) Readdir(ctx context.Context, offset uint64, count uint32) ([]DirEnt, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	n := f.node
+	if !f.opened {
+		return nil, &Rlerror{Ecode: EBADF}
+	}
+	if !n.isDir() {
+		return nil, &Rlerror{Ecode: ENOTDIR}
+	}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ents := make([]DirEnt, 0, len(names))
+	for _, name := range names {
+		child := n.children[name]
+		ents = append(ents, DirEnt{
+			Qid:  child.qid,
+			Typ:  child.direntType(),
+			Name: name,
+		})
+	}
+	n.atime = time.Now()
+	ents = n.cookies.Readdir(n.qid, n.parent.qid, ents, offset, count)
+	return ents, nil
+}
+
+func (f *RamFile) SetAttr(ctx context.Context, attr LSetAttr) error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	n := f.node
+	now := time.Now()
+	if attr.Valid&L_SETATTR_SIZE != 0 {
+		if n.mode&L_S_IFMT != L_S_IFREG {
+			return &Rlerror{Ecode: EINVAL}
+		}
+		if attr.Size > f.fs.maxFileSize() {
+			return &Rlerror{Ecode: EFBIG}
+		}
+		if attr.Size < uint64(len(n.data)) {
+			n.data = n.data[:attr.Size]
+		} else if attr.Size > uint64(len(n.data)) {
+			n.data = append(n.data, make([]byte, attr.Size-uint64(len(n.data)))...)
+		}
+		n.modified()
+	}
+	if attr.Valid&L_SETATTR_MODE != 0 {
+		n.mode = (n.mode & L_S_IFMT) | (attr.Mode & 0o7777)
+	}
+	if attr.Valid&L_SETATTR_UID != 0 {
+		n.uid = attr.Uid
+	}
+	if attr.Valid&L_SETATTR_GID != 0 {
+		n.gid = attr.Gid
+	}
+	if attr.Valid&L_SETATTR_ATIME != 0 {
+		n.atime = now
+		if attr.Valid&L_SETATTR_ATIME_SET != 0 {
+			n.atime = time.Unix(int64(attr.AtimeSec), int64(attr.AtimeNsec))
+		}
+	}
+	if attr.Valid&L_SETATTR_MTIME != 0 {
+		n.mtime = now
+		if attr.Valid&L_SETATTR_MTIME_SET != 0 {
+			n.mtime = time.Unix(int64(attr.MtimeSec), int64(attr.MtimeNsec))
+		}
+	}
+	n.ctime = now
+	return nil
+}
+
+// newGid returns the group of a file created in dir, as with Linux
+// that is the group of dir if it is setgid, otherwise the group of
+// the creator. Without a credential the gid from the client is used.
+func newGid(ctx context.Context, dir *ramNode, gid uint32) uint32 {
+	if dir.mode&L_S_ISGID != 0 {
+		return dir.gid
+	}
+	if cred, ok := CredentialFromContext(ctx); ok {
+		return cred.Gid
+	}
+	return gid
+}
+
+// addChild creates a node in the directory f, f.fs.lock must be held.
+func (f *RamFile) addChild(ctx context.Context, name string, mode uint32, gid uint32) (*ramNode, error) {
+	dir := f.node
+	if !dir.isDir() {
+		return nil, &Rlerror{Ecode: ENOTDIR}
+	}
+	if _, ok := dir.children[name]; ok {
+		return nil, &Rlerror{Ecode: EEXIST}
+	}
+	if mode&L_S_IFMT == L_S_IFDIR && dir.mode&L_S_ISGID != 0 {
+		mode |= L_S_ISGID
+	}
+	n := f.fs.newNode(mode, f.uid, newGid(ctx, dir, gid))
+	dir.children[name] = n
+	dir.modified()
+	if n.isDir() {
+		n.parent = dir
+		dir.nlink++
+	}
+	return n, nil
+}
+
+func (f *RamFile) Mkdir(ctx context.Context, name string, mode uint32, gid uint32) (Qid, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	n, err := f.addChild(ctx, name, L_S_IFDIR|(mode&0o7777), gid)
+	if err != nil {
+		return Qid{}, err
+	}
+	return n.qid, nil
+}
+
+func (f *RamFile) Symlink(ctx context.Context, name string, target string, gid uint32) (Qid, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	n, err := f.addChild(ctx, name, L_S_IFLNK|0o777, gid)
+	if err != nil {
+		return Qid{}, err
+	}
+	n.target = target
+	return n.qid, nil
+}
+
+func (f *RamFile) Mknod(ctx context.Context, name string, mode uint32, major uint32, minor uint32, gid uint32) (Qid, error) {
+	switch mode & L_S_IFMT {
+	case L_S_IFREG, L_S_IFIFO, L_S_IFCHR, L_S_IFBLK, L_S_IFSOCK:
+	default:
+		return Qid{}, &Rlerror{Ecode: EINVAL}
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	n, err := f.addChild(ctx, name, mode, gid)
+	if err != nil {
+		return Qid{}, err
+	}
+	// The encoding used by glibc makedev.
+	n.rdev = uint64(minor&0xff) | uint64(major&0xfff)<<8 |
+		uint64(minor&^0xff)<<12 | uint64(major&^0xfff)<<32
+	return n.qid, nil
+}
+
+func (f *RamFile) Readlink(ctx context.Context) (string, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if f.node.mode&L_S_IFMT != L_S_IFLNK {
+		return "", &Rlerror{Ecode: EINVAL}
+	}
+	return f.node.target, nil
+}
+
+func (f *RamFile) Link(ctx context.Context, name string, file DotLFile) error {
+	target, ok := file.(*RamFile)
+	if !ok || target.fs != f.fs {
+		return &Rlerror{Ecode: EXDEV}
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	dir := f.node
+	if !dir.isDir() {
+		return &Rlerror{Ecode: ENOTDIR}
+	}
+	if target.node.isDir() {
+		return &Rlerror{Ecode: EPERM}
+	}
+	if _, ok := dir.children[name]; ok {
+		return &Rlerror{Ecode: EEXIST}
+	}
+	dir.children[name] = target.node
+	dir.modified()
+	target.node.nlink++
+	target.node.ctime = time.Now()
+	return nil
+}
+
+// isAncestor reports if a is d or a directory above it.
+func isAncestor(a *ramNode, d *ramNode) bool {
+	for {
+		if a == d {
+			return true
+		}
+		if d.parent == d {
+			return false
+		}
+		d = d.parent
+	}
+}
+
+// rename moves oldName in oldDir, f.fs.lock must be held.
+func (fs *RamFS) rename(oldDir *ramNode, oldName string, newDir *ramNode, newName string) error {
+	if !oldDir.isDir() || !newDir.isDir() {
+		return &Rlerror{Ecode: ENOTDIR}
+	}
+	n, ok := oldDir.children[oldName]
+	if !ok {
+		return &Rlerror{Ecode: ENOENT}
+	}
+	if n.isDir() && isAncestor(n, newDir) {
+		return &Rlerror{Ecode: EINVAL}
+	}
+	if existing, ok := newDir.children[newName]; ok {
+		if existing == n {
+			return nil
+		}
+		if n.isDir() {
+			if !existing.isDir() {
+				return &Rlerror{Ecode: ENOTDIR}
+			}
+			if len(existing.children) != 0 {
+				return &Rlerror{Ecode: ENOTEMPTY}
+			}
+		} else if existing.isDir() {
+			return &Rlerror{Ecode: EISDIR}
+		}
+		fs.unlink(newDir, newName)
+	}
+	delete(oldDir.children, oldName)
+	newDir.children[newName] = n
+	if n.isDir() {
+		oldDir.nlink--
+		newDir.nlink++
+		n.parent = newDir
+	}
+	oldDir.modified()
+	newDir.modified()
+	n.ctime = time.Now()
+	return nil
+}
+
+// unlink removes name from dir, f.fs.lock must be held.
+func (fs *RamFS) unlink(dir *ramNode, name string) {
+	n := dir.children[name]
+	delete(dir.children, name)
+	dir.modified()
+	if n.isDir() {
+		dir.nlink--
+		n.nlink = 0
+	} else {
+		n.nlink--
+	}
+	n.ctime = time.Now()
+}
+
+func (f *RamFile) Rename(ctx context.Context, dir DotLFile, name string) error {
+	newDir, ok := dir.(*RamFile)
+	if !ok || newDir.fs != f.fs {
+		return &Rlerror{Ecode: EXDEV}
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if f.dir == nil {
+		return &Rlerror{Ecode: EBUSY}
+	}
+	if f.dir.children[f.name] != f.node {
+		return &Rlerror{Ecode: ENOENT}
+	}
+	if cred, ok := CredentialFromContext(ctx); ok {
+		err := CheckUnlink(cred, f.dir.permAttr(), f.node.permAttr())
+		if err != nil {
+			return err
+		}
+	}
+	err := f.fs.rename(f.dir, f.name, newDir.node, name)
+	if err != nil {
+		return err
+	}
+	f.dir = newDir.node
+	f.name = name
+	return nil
+}
+
+func (f *RamFile) Renameat(ctx context.Context, oldName string, newDir DotLFile, newName string) error {
+	dir, ok := newDir.(*RamFile)
+	if !ok || dir.fs != f.fs {
+		return &Rlerror{Ecode: EXDEV}
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	return f.fs.rename(f.node, oldName, dir.node, newName)
+}
+
+// unlinkat removes name from dir, f.fs.lock must be held.
+func (fs *RamFS) unlinkat(dir *ramNode, name string, flags uint32) error {
+	if !dir.isDir() {
+		return &Rlerror{Ecode: ENOTDIR}
+	}
+	n, ok := dir.children[name]
+	if !ok {
+		return &Rlerror{Ecode: ENOENT}
+	}
+	if flags&L_AT_REMOVEDIR != 0 {
+		if !n.isDir() {
+			return &Rlerror{Ecode: ENOTDIR}
+		}
+		if len(n.children) != 0 {
+			return &Rlerror{Ecode: ENOTEMPTY}
+		}
+	} else if n.isDir() {
+		return &Rlerror{Ecode: EISDIR}
+	}
+	fs.unlink(dir, name)
+	return nil
+}
+
+func (f *RamFile) Unlinkat(ctx context.Context, name string, flags uint32) error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	return f.fs.unlinkat(f.node, name, flags)
+}
+
+func (f *RamFile) Remove(ctx context.Context) error {
+	defer f.Clunk()
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if f.dir == nil {
+		return &Rlerror{Ecode: EBUSY}
+	}
+	if f.dir.children[f.name] != f.node {
+		return &Rlerror{Ecode: ENOENT}
+	}
+	if cred, ok := CredentialFromContext(ctx); ok {
+		err := CheckUnlink(cred, f.dir.permAttr(), f.node.permAttr())
+		if err != nil {
+			return err
+		}
+	}
+	flags := uint32(0)
+	if f.node.isDir() {
+		flags = L_AT_REMOVEDIR
+	}
+	return f.fs.unlinkat(f.dir, f.name, flags)
+}
+
+func (f *RamFile) XattrWalk(ctx context.Context, name string) (DotLFile, uint64, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	var data []byte
+	if name == "" {
+		names := make([]string, 0, len(f.node.xattrs))
+		for name := range f.node.xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			data = append(data, name...)
+			data = append(data, 0)
+		}
+	} else {
+		value, ok := f.node.xattrs[name]
+		if !ok {
+			return nil, 0, &Rlerror{Ecode: ENODATA}
+		}
+		data = append([]byte{}, value...)
+	}
+	return &ramXattrFile{qid: f.node.qid, data: data}, uint64(len(data)), nil
+}
+
+func (f *RamFile) XattrCreate(ctx context.Context, name string, size uint64, flags uint32) error {
+	if size > 65536 {
+		return &Rlerror{Ecode: E2BIG}
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if f.opened || f.xattr != nil {
+		return &Rlerror{Ecode: EBADF}
+	}
+	f.xattr = &ramXattrWrite{
+		name:  name,
+		size:  size,
+		flags: flags,
+	}
+	return nil
+}
+
+// commitXattr sets the attribute written after XattrCreate,
+// f.fs.lock must be held.
+func (f *RamFile) commitXattr() error {
+	xattr := f.xattr
+	f.xattr = nil
+	n := f.node
+	_, exists := n.xattrs[xattr.name]
+	if xattr.flags&L_XATTR_CREATE != 0 && exists {
+		return &Rlerror{Ecode: EEXIST}
+	}
+	if xattr.flags&L_XATTR_REPLACE != 0 && !exists {
+		return &Rlerror{Ecode: ENODATA}
+	}
+	if uint64(len(xattr.data)) != xattr.size {
+		return &Rlerror{Ecode: EINVAL}
+	}
+	if xattr.size == 0 && xattr.flags&L_XATTR_CREATE == 0 {
+		// Linux clients remove attributes by setting an empty value.
+		if !exists {
+			return &Rlerror{Ecode: ENODATA}
+		}
+		delete(n.xattrs, xattr.name)
+	} else {
+		if n.xattrs == nil {
+			n.xattrs = make(map[string][]byte)
+		}
+		n.xattrs[xattr.name] = xattr.data
+	}
+	n.ctime = time.Now()
+	return nil
+}
+
+func (f *RamFile) Lock(ctx context.Context, lock LSetLock) (byte, error) {
+	f.fs.lock.Lock()
+	opened := f.opened
+	f.fs.lock.Unlock()
+	if !opened {
+		return L_LOCK_ERROR, &Rlerror{Ecode: EBADF}
+	}
+	// Blocking requests wait without holding f.fs.lock.
+	status, err := f.fs.locks.Lock(ctx, f.node, f, lock)
+	if err != nil || status != L_LOCK_SUCCESS {
+		return status, err
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	if !f.opened {
+		// Clunked while the lock was being taken, the release
+		// by Clunk may have come first.
+		f.fs.locks.Release(f.node, f)
+		return L_LOCK_ERROR, &Rlerror{Ecode: EBADF}
+	}
+	return status, nil
+}
+
+func (f *RamFile) GetLock(ctx context.Context, lock LGetLock) (LGetLock, error) {
+	return f.fs.locks.GetLock(f.node, lock), nil
+}
+
+func (f *RamFile) Fsync(ctx context.Context) error {
+	return nil
+}
+
+func (f *RamFile) Statfs(ctx context.Context) (LStatfs, error) {
+	return LStatfs{
+		Typ:     0x858458f6, // RAMFS_MAGIC
+		Bsize:   4096,
+		Namelen: 255,
+	}, nil
+}
+
+func (f *RamFile) Clunk() error {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	var err error
+	if f.xattr != nil {
+		err = f.commitXattr()
+	}
+	// Like POSIX, closing a file drops its owners' locks.
+	f.fs.locks.Release(f.node, f)
+	f.opened = false
+	return err
+}
+
+// ramXattrFile is the result of Txattrwalk.
+type ramXattrFile struct {
+	qid  Qid
+	data []byte
+}
+
+func (f *ramXattrFile) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	return nil, nil, &Rlerror{Ecode: EINVAL}
+}
+
+func (f *ramXattrFile) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	return LAttr{}, &Rlerror{Ecode: EINVAL}
+}
+
+func (f *ramXattrFile) Read(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	if offset >= uint64(len(f.data)) {
+		return 0, nil
+	}
+	return uint32(copy(buf, f.data[offset:])), nil
+}
+
+func (f *ramXattrFile) Clunk() error {
+	return nil
+}
@@ -0,0 +1,392 @@
+package proto9
+
+import (
+	"reflect"
+	"testing"
+)
+
+func attachRamFS(t *testing.T, fs *RamFS) *ClientDotLFile {
+	client := newPipeTestClient(t, fs.NewFilesystem())
+	f, _, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Clunk() })
+	return f
+}
+
+func walkRamFS(t *testing.T, f *ClientDotLFile, names ...string) *ClientDotLFile {
+	wf, _, err := f.Walk(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { wf.Clunk() })
+	return wf
+}
+
+func expectRlerror(t *testing.T, err error, ecode uint32) {
+	t.Helper()
+	rlerror, ok := err.(*Rlerror)
+	if !ok || rlerror.Ecode != ecode {
+		t.Fatalf("expected errno %d, got %v", ecode, err)
+	}
+}
+
+func TestRamFSReadWrite(t *testing.T) {
+	fs := NewRamFS()
+	root := attachRamFS(t, fs)
+
+	cf := walkRamFS(t, root)
+	qid, _, err := cf.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(0, []byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another connection sees the same tree.
+	xf := walkRamFS(t, attachRamFS(t, fs), "x")
+	attr, err := xf.GetAttr(L_GETATTR_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Size != 11 || attr.Mode != L_S_IFREG|0o644 {
+		t.Fatalf("unexpected attributes %#v", attr)
+	}
+	if attr.Qid.Path != qid.Path || attr.Qid.Version <= qid.Version {
+		t.Fatalf("expected qid version to increase: %s -> %s", qid.String(), attr.Qid.String())
+	}
+
+	err = xf.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := xf.Read(6, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" {
+		t.Fatalf("unexpected read %q", buf[:n])
+	}
+	_, err = xf.Write(0, []byte("x"))
+	expectRlerror(t, err, EBADF)
+}
+
+func TestRamFSMaxFileSize(t *testing.T) {
+	fs := NewRamFS()
+	fs.MaxFileSize = 16
+	root := attachRamFS(t, fs)
+
+	cf := walkRamFS(t, root)
+	_, _, err := cf.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(1<<60, []byte("x"))
+	expectRlerror(t, err, EFBIG)
+	_, err = cf.Write(16, []byte("x"))
+	expectRlerror(t, err, EFBIG)
+	_, err = cf.Write(15, []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xf := walkRamFS(t, root, "x")
+	err = xf.SetAttr(LSetAttr{Valid: L_SETATTR_SIZE, Size: 1 << 60})
+	expectRlerror(t, err, EFBIG)
+	err = xf.SetAttr(LSetAttr{Valid: L_SETATTR_SIZE, Size: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default limit applies when MaxFileSize is zero.
+	root = attachRamFS(t, NewRamFS())
+	cf = walkRamFS(t, root)
+	_, _, err = cf.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(1<<60, []byte("x"))
+	expectRlerror(t, err, EFBIG)
+	err = walkRamFS(t, root, "x").SetAttr(LSetAttr{Valid: L_SETATTR_SIZE, Size: 1 << 60})
+	expectRlerror(t, err, EFBIG)
+}
+
+func TestRamFSDirectories(t *testing.T) {
+	root := attachRamFS(t, NewRamFS())
+
+	_, err := root.Mkdir("d", 0o755, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := walkRamFS(t, root, "d")
+	for _, name := range []string{"c", "a", "b"} {
+		_, err = d.Mkdir(name, 0o755, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = d.Mkdir("a", 0o755, 0)
+	expectRlerror(t, err, EEXIST)
+
+	ld := walkRamFS(t, d)
+	err = ld.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents, err := ld.ReaddirAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, ent := range ents {
+		names = append(names, ent.Name)
+	}
+	if !reflect.DeepEqual(names, []string{".", "..", "a", "b", "c"}) {
+		t.Fatalf("unexpected listing %v", names)
+	}
+
+	attr, err := d.GetAttr(L_GETATTR_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Nlink != 5 {
+		t.Fatalf("unexpected link count %d", attr.Nlink)
+	}
+
+	err = d.Renameat("a", root, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = root.Renameat("d", walkRamFS(t, root, "d", "c"), "d")
+	expectRlerror(t, err, EINVAL)
+	err = root.Unlinkat("d", L_AT_REMOVEDIR)
+	expectRlerror(t, err, ENOTEMPTY)
+	err = root.Unlinkat("a", 0)
+	expectRlerror(t, err, EISDIR)
+	err = root.Unlinkat("a", L_AT_REMOVEDIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bf := walkRamFS(t, d, "b")
+	err = bf.Rename(root, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = root.Walk([]string{"b", ".."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = walkRamFS(t, root, "b").Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = root.Walk([]string{"b"})
+	expectRlerror(t, err, ENOENT)
+}
+
+func TestRamFSLinks(t *testing.T) {
+	root := attachRamFS(t, NewRamFS())
+
+	_, err := root.Symlink("sym", "some/target", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := walkRamFS(t, root, "sym").Readlink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "some/target" {
+		t.Fatalf("unexpected target %q", target)
+	}
+
+	cf := walkRamFS(t, root)
+	_, _, err = cf.Create("x", L_O_WRONLY, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(0, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = root.Link("y", walkRamFS(t, root, "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = root.Unlinkat("x", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yf := walkRamFS(t, root, "y")
+	attr, err := yf.GetAttr(L_GETATTR_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Nlink != 1 || attr.Size != 4 {
+		t.Fatalf("unexpected attributes %#v", attr)
+	}
+}
+
+func TestRamFSSetAttr(t *testing.T) {
+	root := attachRamFS(t, NewRamFS())
+
+	cf := walkRamFS(t, root)
+	_, _, err := cf.Create("x", L_O_WRONLY, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(0, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xf := walkRamFS(t, root, "x")
+	err = xf.SetAttr(LSetAttr{
+		Valid:    L_SETATTR_MODE | L_SETATTR_SIZE | L_SETATTR_MTIME | L_SETATTR_MTIME_SET,
+		Mode:     0o600,
+		Size:     2,
+		MtimeSec: 1234,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr, err := xf.GetAttr(L_GETATTR_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Mode != L_S_IFREG|0o600 || attr.Size != 2 || attr.MtimeSec != 1234 {
+		t.Fatalf("unexpected attributes %#v", attr)
+	}
+}
+
+func TestRamFSXattr(t *testing.T) {
+	root := attachRamFS(t, NewRamFS())
+
+	setXattr := func(name string, value []byte, flags uint32) error {
+		f, _, err := root.Walk(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.XattrCreate(name, uint64(len(value)), flags)
+		if err != nil {
+			_ = f.Clunk()
+			return err
+		}
+		if len(value) != 0 {
+			_, err = f.Write(0, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return f.Clunk()
+	}
+	getXattr := func(name string) ([]byte, error) {
+		xf, size, err := root.XattrWalk(name)
+		if err != nil {
+			return nil, err
+		}
+		defer xf.Clunk()
+		buf := make([]byte, size)
+		n, err := xf.Read(0, buf)
+		return buf[:n], err
+	}
+
+	err := setXattr("user.a", []byte("1"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setXattr("user.b", []byte("2"), L_XATTR_CREATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setXattr("user.b", []byte("3"), L_XATTR_CREATE)
+	expectRlerror(t, err, EEXIST)
+
+	value, err := getXattr("user.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "2" {
+		t.Fatalf("unexpected value %q", value)
+	}
+	list, err := getXattr("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(list) != "user.a\x00user.b\x00" {
+		t.Fatalf("unexpected list %q", list)
+	}
+
+	err = setXattr("user.a", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = getXattr("user.a")
+	expectRlerror(t, err, ENODATA)
+}
+
+func TestRamFSLocks(t *testing.T) {
+	fs := NewRamFS()
+	root := attachRamFS(t, fs)
+
+	cf := walkRamFS(t, root)
+	_, _, err := cf.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf1, _, err := root.Walk([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lf1.Open(L_O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf2 := walkRamFS(t, attachRamFS(t, fs), "x")
+	err = lf2.Open(L_O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := lf1.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, Start: 0, Length: 10, ProcId: 1, ClientId: "a"})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("lock failed: %d %v", status, err)
+	}
+	// Unlocking the middle splits the lock.
+	status, err = lf1.Lock(LSetLock{Typ: L_LOCK_TYPE_UNLCK, Start: 4, Length: 2, ProcId: 1, ClientId: "a"})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("unlock failed: %d %v", status, err)
+	}
+
+	status, err = lf2.Lock(LSetLock{Typ: L_LOCK_TYPE_RDLCK, Start: 4, Length: 2, ProcId: 2, ClientId: "b"})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("lock failed: %d %v", status, err)
+	}
+	status, err = lf2.Lock(LSetLock{Typ: L_LOCK_TYPE_RDLCK, Start: 8, Length: 0, ProcId: 2, ClientId: "b"})
+	if err != nil || status != L_LOCK_BLOCKED {
+		t.Fatalf("expected lock to block: %d %v", status, err)
+	}
+	l, err := lf2.GetLock(LGetLock{Typ: L_LOCK_TYPE_WRLCK, Start: 0, Length: 0, ProcId: 2, ClientId: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Typ != L_LOCK_TYPE_WRLCK || l.Start != 0 || l.Length != 4 || l.ProcId != 1 || l.ClientId != "a" {
+		t.Fatalf("unexpected conflicting lock %#v", l)
+	}
+
+	// Clunking releases the locks taken through it.
+	err = lf1.Clunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = lf2.Lock(LSetLock{Typ: L_LOCK_TYPE_RDLCK, Start: 8, Length: 0, ProcId: 2, ClientId: "b"})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("lock failed: %d %v", status, err)
+	}
+}
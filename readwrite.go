@@ -2,11 +2,48 @@ package proto9
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
 	"io"
 )
 
-func WriteFcall(fc Fcall, msize uint32, w io.Writer) error {
+type fcallOptions struct {
+	validate bool
+	version  string
+}
+
+// FcallOption enables optional behaviour in ReadFcall,
+// ReadFcallInto and WriteFcall.
+type FcallOption func(*fcallOptions)
+
+// ValidateFcalls rejects messages that fail Fcall.Validate.
+var ValidateFcalls FcallOption = func(o *fcallOptions) {
+	o.validate = true
+}
+
+// WithVersion decodes the extension messages enabled by
+// the negotiated protocol version.
+func WithVersion(version string) FcallOption {
+	return func(o *fcallOptions) {
+		o.version = version
+	}
+}
+
+func makeFcallOptions(opts []FcallOption) fcallOptions {
+	o := fcallOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func WriteFcall(fc Fcall, msize uint32, w io.Writer, opts ...FcallOption) error {
+	if makeFcallOptions(opts).validate {
+		err := fc.Validate(msize)
+		if err != nil {
+			return err
+		}
+	}
+
 	// TODO No copy fast path for things like Twrite and Rread.
 	// TODO Take buffer from a pool.
 	var b bytes.Buffer
@@ -31,13 +68,62 @@ func WriteFcall(fc Fcall, msize uint32, w io.Writer) error {
 	buf[0] = byte(l & 0xff)
 	buf[1] = byte((l & 0xff00) >> 8)
 	buf[2] = byte((l & 0xff0000) >> 16)
-	buf[3] = byte((l & 0xff000000) >> 24)
+	buf[3] = byte(l >> 24)
 
 	_, err = w.Write(buf)
 	return err
 }
 
-func ReadFcallInto(msize uint32, r io.Reader, b *bytes.Buffer) (Fcall, error) {
+// TruncatedFrameError reports a connection that ended or failed
+// part way through a frame.
+type TruncatedFrameError struct {
+	Expected int64
+	Read     int64
+	Err      error
+}
+
+func (e *TruncatedFrameError) Error() string {
+	return fmt.Sprintf("truncated 9p frame, read %d of %d bytes: %s", e.Read, e.Expected, e.Err)
+}
+
+func (e *TruncatedFrameError) Unwrap() error {
+	return e.Err
+}
+
+// FrameSizeError reports a frame with a size larger than msize
+// or too small to hold a message.
+type FrameSizeError struct {
+	Size  uint32
+	Msize uint32
+}
+
+func (e *FrameSizeError) Error() string {
+	return fmt.Sprintf("9p frame size %d outside valid range, msize is %d", e.Size, e.Msize)
+}
+
+// UnknownKindError reports a message kind with no known decoder. When
+// returned from ReadFcallInto the frame has been consumed and Tag holds
+// its tag, so the connection remains usable.
+type UnknownKindError struct {
+	Kind uint8
+	Tag  uint16
+}
+
+func (e *UnknownKindError) Error() string {
+	return fmt.Sprintf("unknown message kind: %d", e.Kind)
+}
+
+// ReadFcallInto reads a message using b as the read buffer.
+//
+// A connection closed cleanly between messages returns io.EOF, other
+// failures are reported as a *TruncatedFrameError, *FrameSizeError,
+// *UnknownKindError or *DecodeError, or the underlying read error.
+//
+// When validation is enabled and the message fails validation, the
+// decoded message is returned along with the error so callers may
+// still reply to it.
+func ReadFcallInto(msize uint32, r io.Reader, b *bytes.Buffer, opts ...FcallOption) (Fcall, error) {
+	o := makeFcallOptions(opts)
 
 	lr := io.LimitedReader{
 		R: r,
@@ -51,19 +137,33 @@ func ReadFcallInto(msize uint32, r io.Reader, b *bytes.Buffer) (Fcall, error) {
 
 	nRead, err := b.ReadFrom(&lr)
 	if nRead != 5 {
-		return nil, io.EOF
+		if nRead == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &TruncatedFrameError{
+			Expected: 5,
+			Read:     nRead,
+			Err:      err,
+		}
 	}
 
 	hdr := b.Next(5)
 
 	sz := uint32(hdr[0]) | (uint32(hdr[1]) << 8) | (uint32(hdr[2]) << 16) | (uint32(hdr[3]) << 24)
-	if sz <= 5 || sz > msize {
-		return nil, errors.New("message size is outside valid range")
-	}
-
-	fc, err := FcallFromKind(hdr[4])
-	if err != nil {
-		return nil, err
+	// Reading the body may reuse the header bytes.
+	kind := hdr[4]
+	// The smallest message is a header and a tag.
+	if sz < 7 || sz > msize {
+		return nil, &FrameSizeError{
+			Size:  sz,
+			Msize: msize,
+		}
 	}
 
 	toRead := int64(sz - 5)
@@ -72,20 +172,47 @@ func ReadFcallInto(msize uint32, r io.Reader, b *bytes.Buffer) (Fcall, error) {
 	nRead, err = b.ReadFrom(&lr)
 	if nRead != toRead {
 		if err == nil {
-			err = io.EOF
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &TruncatedFrameError{
+			Expected: int64(sz),
+			Read:     5 + nRead,
+			Err:      err,
+		}
+	}
+
+	fc, err := FcallFromKindVersion(kind, o.version)
+	if err != nil {
+		tagBytes := b.Bytes()
+		return nil, &UnknownKindError{
+			Kind: kind,
+			Tag:  uint16(tagBytes[0]) | (uint16(tagBytes[1]) << 8),
 		}
-		return nil, err
 	}
 
 	err = fc.Decode(b)
+	if err == nil && b.Len() != 0 {
+		err = errTrailingBytes
+	}
 	if err != nil {
-		return nil, err
+		return nil, &DecodeError{
+			Kind:   kind,
+			Offset: int(sz) - b.Len(),
+			Err:    err,
+		}
+	}
+
+	if o.validate {
+		err = fc.Validate(msize)
+		if err != nil {
+			return fc, err
+		}
 	}
 
-	return fc, err
+	return fc, nil
 }
 
-func ReadFcall(msize uint32, r io.Reader) (Fcall, error) {
+func ReadFcall(msize uint32, r io.Reader, opts ...FcallOption) (Fcall, error) {
 	b := bytes.NewBuffer(make([]byte, 0, msize))
-	return ReadFcallInto(msize, r, b)
+	return ReadFcallInto(msize, r, b, opts...)
 }
@@ -2,6 +2,8 @@ package proto9
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"reflect"
 	"sync"
 	"testing"
@@ -35,18 +37,159 @@ func TestReadWrite(t *testing.T) {
 				}
 
 				if uint64(buf.Len()-5) != fc.EncodedSize() {
-					t.Fatalf("EncodedSize %d did not match actual size %d for %#v", fc.EncodedSize(), buf.Len()-5, fc)
+					t.Errorf("EncodedSize %d did not match actual size %d for %#v", fc.EncodedSize(), buf.Len()-5, fc)
+					return
 				}
 
 				fc2, err := ReadFcall(msize, &buf)
 				if err != nil {
-					t.Fatalf("encoding %v failed with error %s", fc, err)
+					t.Errorf("encoding %v failed with error %s", fc, err)
+					return
 				}
 				if !reflect.DeepEqual(fc, fc2) {
-					t.Fatalf("%#v\n should equal\n %#v", fc2, fc)
+					t.Errorf("%#v\n should equal\n %#v", fc2, fc)
+					return
 				}
 			}
 		}(i)
 	}
 
 }
+
+func encodeTestFrame(kind uint8, body []byte) []byte {
+	sz := len(body) + 5
+	return append([]byte{byte(sz), byte(sz >> 8), byte(sz >> 16), byte(sz >> 24), kind}, body...)
+}
+
+func TestReadHostile(t *testing.T) {
+	msize := uint32(8192)
+
+	cases := []struct {
+		name string
+		kind uint8
+		body []byte
+	}{
+		// Twalk claiming 0xffff names with no room for them.
+		{"string count", 110, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}},
+		// Rwalk claiming 0xffff qids.
+		{"qid count", 111, []byte{0, 0, 0xff, 0xff, 0}},
+		// Rreaddir with a section length larger than the message.
+		{"dirent section", 41, []byte{0, 0, 0xff, 0xff, 0, 0}},
+		// Rreaddir with an entry that doesn't fit in its section.
+		{"dirent overrun", 41, append([]byte{0, 0, 1, 0, 0, 0}, make([]byte, 24)...)},
+		// Rread with a count larger than the message.
+		{"byte count", 117, []byte{0, 0, 0xff, 0xff, 0xff, 0xff}},
+		// Rclunk followed by garbage.
+		{"trailing bytes", 121, []byte{0, 0, 1, 2, 3}},
+		// Rlerror with a partial errno.
+		{"short", 7, []byte{0, 0, 1, 2}},
+	}
+
+	for _, tc := range cases {
+		frame := encodeTestFrame(tc.kind, tc.body)
+		_, err := ReadFcall(msize, bytes.NewReader(frame))
+		if !errors.Is(err, ErrDecodingFailed) {
+			t.Fatalf("%s: expected decoding failure, got %v", tc.name, err)
+		}
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("%s: expected DecodeError, got %v", tc.name, err)
+		}
+		if decodeErr.Kind != tc.kind {
+			t.Fatalf("%s: unexpected kind %d", tc.name, decodeErr.Kind)
+		}
+		if decodeErr.Offset < 5 || decodeErr.Offset > len(frame) {
+			t.Fatalf("%s: unexpected offset %d", tc.name, decodeErr.Offset)
+		}
+	}
+}
+
+func FuzzReadFcall(f *testing.F) {
+	msize := uint32(64 * 1024)
+	fuzzer := fuzz.NewWithSeed(1).NilChance(0.0).NumElements(0, 4)
+	for i := 0; i <= 0xff; i++ {
+		fc, err := FcallFromKind(byte(i))
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		err = WriteFcall(fc, msize, &buf)
+		if err == nil {
+			f.Add(buf.Bytes())
+		}
+		fuzzer.Fuzz(fc)
+		buf.Reset()
+		err = WriteFcall(fc, msize, &buf)
+		if err == nil {
+			f.Add(buf.Bytes())
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fc, err := ReadFcall(msize, bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Every byte of a successfully decoded frame is accounted
+		// for, so encoding must reproduce it exactly.
+		var buf bytes.Buffer
+		err = WriteFcall(fc, msize, &buf)
+		if err != nil {
+			t.Fatalf("re-encoding %s failed: %s", fc, err)
+		}
+		if buf.Len() > len(data) {
+			t.Fatalf("re-encoding %s grew from %d to %d bytes", fc, len(data), buf.Len())
+		}
+		if !bytes.Equal(buf.Bytes(), data[:buf.Len()]) {
+			t.Fatalf("re-encoding %s did not round trip", fc)
+		}
+	})
+}
+
+func TestReadFramingErrors(t *testing.T) {
+	msize := uint32(8192)
+
+	_, err := ReadFcall(msize, bytes.NewReader(nil))
+	if err != io.EOF {
+		t.Fatalf("expected clean EOF, got %v", err)
+	}
+
+	var truncated *TruncatedFrameError
+	_, err = ReadFcall(msize, bytes.NewReader([]byte{7, 0}))
+	if !errors.As(err, &truncated) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected truncated header, got %v", err)
+	}
+	frame := encodeTestFrame(121, []byte{1, 0})
+	_, err = ReadFcall(msize, bytes.NewReader(frame[:6]))
+	if !errors.As(err, &truncated) || truncated.Expected != 7 || truncated.Read != 6 {
+		t.Fatalf("expected truncated body, got %v", err)
+	}
+
+	var frameSize *FrameSizeError
+	_, err = ReadFcall(msize, bytes.NewReader([]byte{0, 0, 1, 0, 121}))
+	if !errors.As(err, &frameSize) || frameSize.Size != 0x10000 {
+		t.Fatalf("expected oversize frame, got %v", err)
+	}
+
+	// An unknown message is skipped, leaving the stream usable.
+	stream := append(encodeTestFrame(250, []byte{3, 0, 1, 2, 3}), frame...)
+	r := bytes.NewReader(stream)
+	var unknownKind *UnknownKindError
+	_, err = ReadFcall(msize, r)
+	if !errors.As(err, &unknownKind) || unknownKind.Kind != 250 || unknownKind.Tag != 3 {
+		t.Fatalf("expected unknown kind, got %v", err)
+	}
+	fc, err := ReadFcall(msize, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fc.(*Rclunk); !ok || fc.GetTag() != 1 {
+		t.Fatalf("unexpected message %s", fc)
+	}
+
+	var decodeErr *DecodeError
+	_, err = ReadFcall(msize, bytes.NewReader(encodeTestFrame(7, []byte{0, 0})))
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected decode error, got %v", err)
+	}
+}
@@ -1,123 +1,713 @@
 package proto9
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Filesystem interface {
-	Fcall(Fcall) Fcall
+	// Fcall handles a request, ctx is cancelled if the request
+	// is flushed or the connection is closed.
+	Fcall(ctx context.Context, fc Fcall) Fcall
+	// Clunk releases all fids, it is called when the connection
+	// closes and when a Tversion starts a new session.
 	Clunk() error
 }
 
+var ErrServerClosed = errors.New("server closed")
+
 func Serve(l net.Listener, makeFilesystem func() Filesystem) error {
+	srv := &Server{
+		NewFilesystem: func(ConnInfo) Filesystem {
+			return makeFilesystem()
+		},
+	}
+	return srv.Serve(l)
+}
+
+// ConnInfo describes an accepted connection.
+type ConnInfo struct {
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// Set for tls connections, after the handshake.
+	TLS *tls.ConnectionState
+}
+
+type ConnState int
+
+const (
+	// The connection is being served, but has not
+	// negotiated a version.
+	StateNew ConnState = iota
+	// Requests are in flight.
+	StateActive
+	// No requests are in flight.
+	StateIdle
+	// The connection is closed and its filesystem clunked.
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+const DefaultMaxInflight = 64
+
+// MinMsize is the smallest msize a server will negotiate.
+const MinMsize = uint32(4096)
+
+// versionMsize bounds a Tversion with the longest possible version.
+const versionMsize = uint32(4 + 1 + 2 + 4 + 2 + 0xFFFF)
+
+// Server holds optional settings for serving 9p connections,
+// the zero value is ready to use.
+type Server struct {
+	// If set, each message received and sent is logged via Tracef.
+	Tracef func(format string, args ...interface{})
+
+	// Workers bounds the goroutines handling requests across all
+	// connections, if zero each request gets its own goroutine.
+	// Workers are started as needed and kept for reuse until the
+	// last connection closes after Shutdown or Close. Requests
+	// waiting for a worker are queued per connection and connections
+	// take turns. Tclunk, Tflush, blocking Tlocks and unlocks never
+	// wait for a worker, so waiting for a lock never holds one.
+	Workers int
+	// MaxInflight bounds the outstanding requests of each connection,
+	// reading pauses when it is reached. If zero, DefaultMaxInflight
+	// is used. Flushes do not count towards the limit.
+	MaxInflight int
+	// If non zero, connections beyond MaxConns are refused by
+	// answering their Tversion with EUSERS.
+	MaxConns int
+
+	// NewFilesystem returns the filesystem for each connection
+	// accepted by Serve.
+	NewFilesystem func(info ConnInfo) Filesystem
+	// If set, ConnState is called as connections change state.
+	ConnState func(rwc io.ReadWriteCloser, state ConnState)
+
+	nconns int32
+
+	lock         sync.Mutex
+	shuttingDown bool
+	listeners    map[net.Listener]struct{}
+	conns        map[*serverConn]struct{}
+
+	poolLock sync.Mutex
+	poolCond *sync.Cond
+	nworkers int
+	// Workers waiting for requests, not yet signalled.
+	idle int
+	// Connections with queued requests, in turn order.
+	ready []*serverConn
+	// Set to stop idle workers.
+	stopWorkers bool
+}
+
+// run calls f on a worker, queueing it on conn while all workers
+// are busy. It never blocks, the queue is bounded by MaxInflight.
+func (srv *Server) run(conn *serverConn, f func()) {
+	if srv.Workers <= 0 {
+		go f()
+		return
+	}
+	srv.poolLock.Lock()
+	defer srv.poolLock.Unlock()
+	if srv.poolCond == nil {
+		srv.poolCond = sync.NewCond(&srv.poolLock)
+	}
+	srv.stopWorkers = false
+	if len(conn.queued) == 0 {
+		srv.ready = append(srv.ready, conn)
+	}
+	conn.queued = append(conn.queued, f)
+	if srv.idle > 0 {
+		srv.idle -= 1
+		srv.poolCond.Signal()
+	} else if srv.nworkers < srv.Workers {
+		srv.nworkers += 1
+		go srv.worker()
+	}
+}
+
+func (srv *Server) worker() {
+	srv.poolLock.Lock()
+	for {
+		for len(srv.ready) == 0 {
+			if srv.stopWorkers {
+				srv.nworkers -= 1
+				srv.poolLock.Unlock()
+				return
+			}
+			srv.idle += 1
+			srv.poolCond.Wait()
+		}
+		conn := srv.ready[0]
+		srv.ready = srv.ready[1:]
+		f := conn.queued[0]
+		conn.queued[0] = nil
+		conn.queued = conn.queued[1:]
+		if len(conn.queued) != 0 {
+			// Other connections go first.
+			srv.ready = append(srv.ready, conn)
+		}
+		srv.poolLock.Unlock()
+		f()
+		srv.poolLock.Lock()
+	}
+}
+
+// stopIdleWorkers stops the workers once the server is shutting down
+// and its last connection has closed.
+func (srv *Server) stopIdleWorkers() {
+	srv.lock.Lock()
+	stop := srv.shuttingDown && len(srv.conns) == 0
+	srv.lock.Unlock()
+	if !stop {
+		return
+	}
+	srv.poolLock.Lock()
+	defer srv.poolLock.Unlock()
+	if srv.poolCond == nil {
+		return
+	}
+	srv.stopWorkers = true
+	srv.idle = 0
+	srv.poolCond.Broadcast()
+}
+
+// serverSession holds the requests between Tversions.
+type serverSession struct {
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+	// Set when a Tversion abandons the session's requests.
+	aborted bool
+}
+
+type serverResponse struct {
+	fc    Fcall
+	msize uint32
+	// Set for responses to requests counted by beginRequest.
+	endsRequest bool
+	// If set, the response is flushed and then written is closed.
+	written chan struct{}
+}
+
+// serverConn tracks a connection for Shutdown.
+type serverConn struct {
+	rwc io.ReadWriteCloser
+	// Orders state changes, so hooks see them in order.
+	stateLock sync.Mutex
+	// Protected by the server lock.
+	inflight int
+	// Requests waiting for a worker, protected by the pool lock.
+	queued []func()
+}
+
+// setState calls the ConnState hook, conn.stateLock must be held.
+func (srv *Server) setState(conn *serverConn, state ConnState) {
+	if srv.ConnState != nil {
+		srv.ConnState(conn.rwc, state)
+	}
+}
+
+func (srv *Server) trackConn(conn *serverConn, add bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if add {
+		if srv.conns == nil {
+			srv.conns = make(map[*serverConn]struct{})
+		}
+		srv.conns[conn] = struct{}{}
+	} else {
+		delete(srv.conns, conn)
+	}
+}
+
+// beginRequest counts a new request on conn, it returns false
+// once the server is shutting down.
+func (srv *Server) beginRequest(conn *serverConn) bool {
+	conn.stateLock.Lock()
+	defer conn.stateLock.Unlock()
+	srv.lock.Lock()
+	if srv.shuttingDown {
+		srv.lock.Unlock()
+		return false
+	}
+	conn.inflight += 1
+	active := conn.inflight == 1
+	srv.lock.Unlock()
+	if active {
+		srv.setState(conn, StateActive)
+	}
+	return true
+}
+
+func (srv *Server) endRequest(conn *serverConn) {
+	conn.stateLock.Lock()
+	defer conn.stateLock.Unlock()
+	srv.lock.Lock()
+	conn.inflight -= 1
+	idle := conn.inflight == 0
+	srv.lock.Unlock()
+	if idle {
+		srv.setState(conn, StateIdle)
+	}
+}
+
+// Serve accepts connections from l, serving each with a filesystem
+// from srv.NewFilesystem. Serve waits for its connections to
+// finish before returning, after Shutdown or Close it returns
+// ErrServerClosed.
+func (srv *Server) Serve(l net.Listener) error {
+	if srv.NewFilesystem == nil {
+		return errors.New("server has no NewFilesystem")
+	}
+
+	srv.lock.Lock()
+	if srv.shuttingDown {
+		srv.lock.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[net.Listener]struct{})
+	}
+	srv.listeners[l] = struct{}{}
+	srv.lock.Unlock()
+
 	wg := &sync.WaitGroup{}
-	defer wg.Done()
-	defer l.Close()
+	defer wg.Wait()
+	defer func() {
+		srv.lock.Lock()
+		delete(srv.listeners, l)
+		srv.lock.Unlock()
+		_ = l.Close()
+	}()
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			srv.lock.Lock()
+			shuttingDown := srv.shuttingDown
+			srv.lock.Unlock()
+			if shuttingDown {
+				return ErrServerClosed
+			}
 			return err
 		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			ServeConn(c, makeFilesystem())
+			info := ConnInfo{
+				LocalAddr:  c.LocalAddr(),
+				RemoteAddr: c.RemoteAddr(),
+			}
+			if tlsConn, ok := c.(*tls.Conn); ok {
+				err := tlsConn.Handshake()
+				if err != nil {
+					if srv.Tracef != nil {
+						srv.Tracef("tls handshake failed: %s", err)
+					}
+					_ = c.Close()
+					return
+				}
+				state := tlsConn.ConnectionState()
+				info.TLS = &state
+			}
+			srv.ServeConn(c, srv.NewFilesystem(info))
 		}()
 	}
 }
 
+// closeListeners stops Serve accepting connections.
+func (srv *Server) closeListeners() {
+	srv.lock.Lock()
+	srv.shuttingDown = true
+	for l := range srv.listeners {
+		_ = l.Close()
+	}
+	srv.lock.Unlock()
+	srv.stopIdleWorkers()
+}
+
+// Shutdown stops accepting connections and refuses new requests with
+// ESHUTDOWN, closing each connection once its in flight requests
+// finish. Shutdown returns once all connections are closed, or
+// with the error of ctx if it is done first.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.closeListeners()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		srv.lock.Lock()
+		for conn := range srv.conns {
+			if conn.inflight == 0 {
+				_ = conn.rwc.Close()
+			}
+		}
+		remaining := len(srv.conns)
+		srv.lock.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops accepting connections and closes all connections,
+// cancelling their in flight requests.
+func (srv *Server) Close() error {
+	srv.closeListeners()
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	for conn := range srv.conns {
+		_ = conn.rwc.Close()
+	}
+	return nil
+}
+
+// bypassesWorkers reports if fc must not wait for a worker. Clunks
+// and unlocks release locks that queued requests may be waiting for,
+// and blocking locks would hold a worker while they wait.
+func bypassesWorkers(fc Fcall) bool {
+	switch fc := fc.(type) {
+	case *Tclunk:
+		return true
+	case *Tlock:
+		return fc.Flags&L_LOCK_FLAGS_BLOCK != 0 || fc.Typ == L_LOCK_TYPE_UNLCK
+	default:
+		return false
+	}
+}
+
 func ServeConn(rwc io.ReadWriteCloser, fs Filesystem) {
+	srv := &Server{}
+	srv.ServeConn(rwc, fs)
+}
+
+// readFcall reads a validated request, if the request is invalid
+// it is returned along with the validation error.
+func (srv *Server) readFcall(msize uint32, version string, r io.Reader) (Fcall, error) {
+	fc, err := ReadFcall(msize, r, ValidateFcalls, WithVersion(version))
+	if fc != nil && srv.Tracef != nil {
+		srv.Tracef("<- %s", fc.String())
+	}
+	return fc, err
+}
+
+func (srv *Server) writeFcall(fc Fcall, msize uint32, w io.Writer) error {
+	if err := fc.Validate(msize); err != nil {
+		// Never put a malformed response on the wire.
+		if srv.Tracef != nil {
+			srv.Tracef("invalid response: %s", err)
+		}
+		fc = &Rlerror{
+			Tagged: Tagged{Tag: fc.GetTag()},
+			Ecode:  EIO,
+		}
+	}
+	if srv.Tracef != nil {
+		srv.Tracef("-> %s", fc.String())
+	}
+	return WriteFcall(fc, msize, w)
+}
+
+// inflightRequest tracks a request that has not been answered.
+type inflightRequest struct {
+	cancel func()
+	// Set when the request is flushed.
+	flushed bool
+	// Closed once the response has been sent or abandoned.
+	done chan struct{}
+}
+
+func (srv *Server) ServeConn(rwc io.ReadWriteCloser, fs Filesystem) {
 	wg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	responses := make(chan serverResponse, 64)
+	writerDone := make(chan struct{})
+
+	conn := &serverConn{rwc: rwc}
+	srv.trackConn(conn, true)
+	conn.stateLock.Lock()
+	srv.setState(conn, StateNew)
+	conn.stateLock.Unlock()
 
 	defer func() {
 		_ = rwc.Close()
-		wg.Done()
+		cancel()
+		wg.Wait()
+		close(responses)
+		<-writerDone
 		fs.Clunk()
+		srv.trackConn(conn, false)
+		srv.stopIdleWorkers()
+		conn.stateLock.Lock()
+		srv.setState(conn, StateClosed)
+		conn.stateLock.Unlock()
 	}()
 
-	msize := uint32(4096)
+	nconns := atomic.AddInt32(&srv.nconns, 1)
+	defer atomic.AddInt32(&srv.nconns, -1)
 
-	fc, err := ReadFcall(msize, rwc)
-	switch fc := fc.(type) {
-	case *Tversion:
-		switch rVersion := fs.Fcall(fc).(type) {
-		case *Rversion:
-			msize = rVersion.Msize
-			err = WriteFcall(rVersion, msize, rwc)
-			if err != nil || rVersion.Version == "unknown" {
-				return
+	go func() {
+		defer close(writerDone)
+		w := bufio.NewWriterSize(rwc, 64*1024)
+		var err error
+		// Requests are only finished once their response is flushed,
+		// so Shutdown never closes a connection with replies pending.
+		unflushed := 0
+		for resp := range responses {
+			if resp.endsRequest {
+				unflushed += 1
+			}
+			if err == nil {
+				err = srv.writeFcall(resp.fc, resp.msize, w)
+				if err == nil && (len(responses) == 0 || resp.written != nil) {
+					err = w.Flush()
+				}
+				if err != nil {
+					if srv.Tracef != nil {
+						srv.Tracef("write failed: %s", err)
+					}
+					// Unblocks the reader and ends the connection.
+					_ = rwc.Close()
+				}
+			}
+			if err != nil || len(responses) == 0 {
+				for ; unflushed > 0; unflushed-- {
+					srv.endRequest(conn)
+				}
+			}
+			if resp.written != nil {
+				close(resp.written)
 			}
-		default:
-			return
 		}
-	default:
-		return
+	}()
+
+	// Until a version is negotiated, only a Tversion is accepted,
+	// which may be up to versionMsize bytes.
+	negotiated := false
+	msize := versionMsize
+	version := ""
+
+	maxInflight := srv.MaxInflight
+	if maxInflight <= 0 {
+		maxInflight = DefaultMaxInflight
 	}
+	// Holds a slot per outstanding request.
+	slots := make(chan struct{}, maxInflight)
 
-	for {
-		// XXX integrate buffer pool.
-		fc, err := ReadFcall(msize, rwc)
-		if err != nil {
-			return
+	inflightLock := &sync.Mutex{}
+	inflight := make(map[uint16]*inflightRequest)
+
+	finish := func(tag uint16, req *inflightRequest) {
+		inflightLock.Lock()
+		if inflight[tag] == req {
+			delete(inflight, tag)
 		}
-		wg.Add(1)
-		// XXX investigate performance of reusing goroutines.
-		go func() {
-			defer wg.Done()
-			resp := fs.Fcall(fc)
-			_ = WriteFcall(resp, msize, rwc)
-		}()
+		inflightLock.Unlock()
+		req.cancel()
+		close(req.done)
 	}
-}
 
-type DotLFile interface {
-	Remove() error
-	Clunk() error
-}
+	newSession := func() *serverSession {
+		sess := &serverSession{}
+		sess.ctx, sess.cancel = context.WithCancel(ctx)
+		return sess
+	}
+	sess := newSession()
 
-type DotLFilesystem struct {
-	Msize uint32
+	// abortSession abandons all requests of the session, waiting
+	// for them to finish, then clunks all fids.
+	abortSession := func() {
+		inflightLock.Lock()
+		sess.aborted = true
+		inflightLock.Unlock()
+		sess.cancel()
+		sess.wg.Wait()
+		fs.Clunk()
+		sess = newSession()
+	}
 
-	filesLock sync.RWMutex
-	files     map[uint32]DotLFile
-}
+	for {
+		// Wait for a free slot before reading, pausing the client.
+		slots <- struct{}{}
+		// XXX integrate buffer pool.
+		fc, err := srv.readFcall(msize, version, rwc)
+		if err != nil {
+			<-slots
+			rlerror := &Rlerror{}
+			var unknownKind *UnknownKindError
+			if fc != nil {
+				rlerror.Tag = fc.GetTag()
+				rlerror.Ecode = EINVAL
+			} else if errors.As(err, &unknownKind) {
+				rlerror.Tag = unknownKind.Tag
+				rlerror.Ecode = ENOSYS
+			} else {
+				if err != io.EOF && srv.Tracef != nil {
+					srv.Tracef("read failed: %s", err)
+				}
+				return
+			}
+			responses <- serverResponse{fc: rlerror, msize: msize}
+			continue
+		}
 
-func (fs *DotLFilesystem) Fcall(fc Fcall) Fcall {
-	switch fc := fc.(type) {
-	case *Tversion:
-		rVersion := &Rversion{
-			Tagged: fc.Tagged,
+		tag := fc.GetTag()
+
+		if tversion, ok := fc.(*Tversion); ok {
+			<-slots
+			if !negotiated && srv.MaxConns > 0 && int(nconns) > srv.MaxConns {
+				written := make(chan struct{})
+				responses <- serverResponse{
+					fc:      &Rlerror{Tagged: tversion.Tagged, Ecode: EUSERS},
+					msize:   msize,
+					written: written,
+				}
+				// Closing the connection must not lose the reply.
+				<-written
+				return
+			}
+			// A Tversion starts a new session.
+			abortSession()
+			negotiated = false
+			msize = versionMsize
+			version = ""
+			switch resp := fs.Fcall(ctx, tversion).(type) {
+			case *Rversion:
+				resp.SetTag(tag)
+				if resp.Version != "unknown" && resp.Msize < MinMsize {
+					responses <- serverResponse{fc: &Rlerror{Tagged: Tagged{Tag: tag}, Ecode: EINVAL}, msize: msize}
+					continue
+				}
+				responses <- serverResponse{fc: resp, msize: msize}
+				if resp.Version != "unknown" {
+					negotiated = true
+					msize = resp.Msize
+					version = resp.Version
+				}
+			case *Rlerror:
+				resp.SetTag(tag)
+				responses <- serverResponse{fc: resp, msize: msize}
+			default:
+				return
+			}
+			continue
 		}
-		if fs.Msize < fc.Msize {
-			rVersion.Msize = fs.Msize
-		} else {
-			rVersion.Msize = fc.Msize
+
+		if !negotiated {
+			<-slots
+			responses <- serverResponse{fc: &Rlerror{Tagged: Tagged{Tag: tag}, Ecode: EPROTO}, msize: msize}
+			continue
 		}
-		if fc.Version == "9P2000.L" {
-			rVersion.Version = fc.Version
-		} else {
-			rVersion.Version = "unknown"
+
+		req := &inflightRequest{done: make(chan struct{})}
+
+		if tflush, ok := fc.(*Tflush); ok {
+			// A flush must not wait for a slot or worker held by the
+			// request it is flushing.
+			<-slots
+			// Flushes are tracked too, so a flush may itself be flushed.
+			req.cancel = func() {}
+			inflightLock.Lock()
+			old := inflight[tflush.OldTag]
+			if old != nil {
+				old.flushed = true
+				old.cancel()
+			}
+			inflight[tag] = req
+			inflightLock.Unlock()
+
+			reqSess := sess
+			reqMsize := msize
+			wg.Add(1)
+			reqSess.wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer reqSess.wg.Done()
+				defer finish(tag, req)
+				// The Rflush must follow any response to the old request.
+				if old != nil {
+					<-old.done
+				}
+				inflightLock.Lock()
+				aborted := reqSess.aborted
+				inflightLock.Unlock()
+				if !aborted {
+					responses <- serverResponse{fc: &Rflush{Tagged: Tagged{Tag: tag}}, msize: reqMsize}
+				}
+			}()
+			continue
 		}
-		return rVersion
-	case *Tattach:
-		panic("TODO")
-	default:
-		return &Rlerror{
-			Ecode: 123, // XXX TODO error codes.
+
+		if !srv.beginRequest(conn) {
+			<-slots
+			responses <- serverResponse{fc: &Rlerror{Tagged: Tagged{Tag: tag}, Ecode: ESHUTDOWN}, msize: msize}
+			continue
 		}
-	}
-}
 
-func (fs *DotLFilesystem) Clunk() error {
-	fs.filesLock.RLock()
-	defer fs.filesLock.RUnlock()
+		reqSess := sess
+		reqMsize := msize
+		var reqCtx context.Context
+		reqCtx, req.cancel = context.WithCancel(reqSess.ctx)
+		inflightLock.Lock()
+		inflight[tag] = req
+		inflightLock.Unlock()
 
-	for _, f := range fs.files {
-		_ = f.Clunk()
+		handle := func() {
+			defer wg.Done()
+			defer reqSess.wg.Done()
+			defer func() { <-slots }()
+			defer finish(tag, req)
+			resp := fs.Fcall(reqCtx, fc)
+			resp.SetTag(tag)
+			inflightLock.Lock()
+			flushed := req.flushed
+			aborted := reqSess.aborted
+			inflightLock.Unlock()
+			if _, ok := resp.(*Rlerror); (ok && flushed) || aborted {
+				// The request was abandoned, the client discards
+				// its tag once it gets the Rflush or Rversion.
+				srv.endRequest(conn)
+				return
+			}
+			responses <- serverResponse{fc: resp, msize: reqMsize, endsRequest: true}
+		}
+		wg.Add(1)
+		reqSess.wg.Add(1)
+		if bypassesWorkers(fc) {
+			go handle()
+		} else {
+			srv.run(conn, handle)
+		}
 	}
-
-	return nil
 }
@@ -0,0 +1,951 @@
+package proto9
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Serve fs over a pipe and return a connected client.
+func newPipeTestClient(t *testing.T, fs Filesystem) *Client {
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, fs)
+	}()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		<-done
+	})
+
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestServerUnknownKind(t *testing.T) {
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, &DotLFilesystem{Msize: 8192})
+	}()
+	defer func() {
+		_ = c1.Close()
+		<-done
+	}()
+
+	var buf bytes.Buffer
+	err := WriteFcall(&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: 8192, Version: "9P2000.L"}, 8192, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Topen is not part of 9P2000.L.
+	buf.Write([]byte{7, 0, 0, 0, 112, 5, 0})
+	go func() {
+		_, _ = c1.Write(buf.Bytes())
+	}()
+
+	fc, err := ReadFcall(8192, c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fc.(*Rversion); !ok {
+		t.Fatalf("expected Rversion, got %s", fc)
+	}
+	fc, err = ReadFcall(8192, c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlerror, ok := fc.(*Rlerror)
+	if !ok || rlerror.Tag != 5 || rlerror.Ecode != ENOSYS {
+		t.Fatalf("expected ENOSYS for tag 5, got %s", fc)
+	}
+}
+
+// testFile is a minimal tree for exercising fid handling.
+type testFile struct {
+	qid      Qid
+	children map[string]*testFile
+	clunks   *int32
+}
+
+func (f *testFile) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	qids := []Qid{}
+	cur := f
+	for _, name := range names {
+		next, ok := cur.children[name]
+		if !ok {
+			return qids, nil, &Rlerror{Ecode: ENOENT}
+		}
+		qids = append(qids, next.qid)
+		cur = next
+	}
+	return qids, &testFile{qid: cur.qid, children: cur.children, clunks: f.clunks}, nil
+}
+
+func (f *testFile) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	return LAttr{Valid: L_GETATTR_BASIC, Qid: f.qid}, nil
+}
+
+func (f *testFile) Clunk() error {
+	atomic.AddInt32(f.clunks, 1)
+	return nil
+}
+
+func (f *testFile) Remove(ctx context.Context) error {
+	_ = f.Clunk()
+	return &Rlerror{Ecode: EACCES}
+}
+
+func newTestFileFs() (*DotLFilesystem, *int32) {
+	clunks := new(int32)
+	root := &testFile{
+		qid:    Qid{Typ: QT_DIR, Path: 1},
+		clunks: clunks,
+		children: map[string]*testFile{
+			"a": {
+				qid: Qid{Typ: QT_DIR, Path: 2},
+				children: map[string]*testFile{
+					"b": {qid: Qid{Path: 3}},
+				},
+			},
+		},
+	}
+	fs := &DotLFilesystem{
+		Msize: 8192,
+		Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+			_, f, err := root.Walk(ctx, nil)
+			return f, root.qid, err
+		},
+	}
+	return fs, clunks
+}
+
+func expectEcode(t *testing.T, fc Fcall, err error, ecode uint32) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlerror, ok := fc.(*Rlerror)
+	if !ok || rlerror.Ecode != ecode {
+		t.Fatalf("expected errno %d, got %s", ecode, fc)
+	}
+}
+
+func TestServerFids(t *testing.T) {
+	fs, clunks := newTestFileFs()
+	client := newPipeTestClient(t, fs)
+
+	fc, err := client.Fcall(&Tattach{Fid: 0, Afid: NOFID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rattach, ok := fc.(*Rattach); !ok || rattach.Qid.Path != 1 {
+		t.Fatalf("unexpected attach response %s", fc)
+	}
+	fc, err = client.Fcall(&Tattach{Fid: 0, Afid: NOFID})
+	expectEcode(t, fc, err, EEXIST)
+
+	// Clone.
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 1})
+	if rwalk, ok := fc.(*Rwalk); err != nil || !ok || len(rwalk.WQids) != 0 {
+		t.Fatalf("unexpected clone response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 1})
+	expectEcode(t, fc, err, EEXIST)
+	fc, err = client.Fcall(&Twalk{Fid: 5, NewFid: 6})
+	expectEcode(t, fc, err, EBADF)
+
+	// Walk fid 1 in place.
+	fc, err = client.Fcall(&Twalk{Fid: 1, NewFid: 1, Wnames: []string{"a", "b"}})
+	if rwalk, ok := fc.(*Rwalk); err != nil || !ok || len(rwalk.WQids) != 2 {
+		t.Fatalf("unexpected walk response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Tgetattr{Fid: 1})
+	if rgetattr, ok := fc.(*Rgetattr); err != nil || !ok || rgetattr.Qid.Path != 3 {
+		t.Fatalf("unexpected getattr response %s %v", fc, err)
+	}
+
+	// Partial and failed walks leave newfid unused.
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 2, Wnames: []string{"a", "x"}})
+	if rwalk, ok := fc.(*Rwalk); err != nil || !ok || len(rwalk.WQids) != 1 {
+		t.Fatalf("unexpected partial walk response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 2, Wnames: []string{"x"}})
+	expectEcode(t, fc, err, ENOENT)
+	fc, err = client.Fcall(&Tgetattr{Fid: 2})
+	expectEcode(t, fc, err, EBADF)
+
+	// Remove releases the fid even when it fails.
+	fc, err = client.Fcall(&Tremove{Fid: 1})
+	expectEcode(t, fc, err, EACCES)
+	fc, err = client.Fcall(&Tclunk{Fid: 1})
+	expectEcode(t, fc, err, EBADF)
+
+	fc, err = client.Fcall(&Tlopen{Fid: 9})
+	expectEcode(t, fc, err, EBADF)
+	// testFile is not an Opener.
+	fc, err = client.Fcall(&Tlopen{Fid: 0})
+	expectEcode(t, fc, err, ENOSYS)
+
+	fc, err = client.Fcall(&Tclunk{Fid: 0})
+	if _, ok := fc.(*Rclunk); err != nil || !ok {
+		t.Fatalf("unexpected clunk response %s %v", fc, err)
+	}
+	// The clone replaced by the walk, the removed file and the root.
+	if n := atomic.LoadInt32(clunks); n != 3 {
+		t.Fatalf("expected 3 clunks, got %d", n)
+	}
+}
+
+func TestServerClunksOnDisconnect(t *testing.T) {
+	fs, clunks := newTestFileFs()
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, fs)
+	}()
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fid := uint32(0); fid < 3; fid++ {
+		fc, err := client.Fcall(&Tattach{Fid: fid, Afid: NOFID})
+		if _, ok := fc.(*Rattach); err != nil || !ok {
+			t.Fatalf("unexpected attach response %s %v", fc, err)
+		}
+	}
+	_ = client.Close()
+	<-done
+	if n := atomic.LoadInt32(clunks); n != 3 {
+		t.Fatalf("expected 3 clunks, got %d", n)
+	}
+}
+
+func TestServerFlush(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	fs := &DotLFilesystem{
+		Msize: 8192,
+		Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+			entered <- struct{}{}
+			<-ctx.Done()
+			if fc.Aname == "ignore-flush" {
+				return &testFile{clunks: new(int32)}, Qid{}, nil
+			}
+			return nil, Qid{}, &Rlerror{Ecode: EINTR}
+		},
+	}
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, fs)
+	}()
+	defer func() {
+		_ = c1.Close()
+		<-done
+	}()
+
+	send := func(fc Fcall) {
+		err := WriteFcall(fc, 8192, c1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func() Fcall {
+		fc, err := ReadFcall(8192, c1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fc
+	}
+
+	send(&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: 8192, Version: "9P2000.L"})
+	if fc, ok := recv().(*Rversion); !ok {
+		t.Fatalf("unexpected version response %s", fc)
+	}
+
+	// An abandoned request gets no response, only the Rflush.
+	send(&Tattach{Tagged: Tagged{Tag: 1}, Fid: 0, Afid: NOFID})
+	<-entered
+	send(&Tflush{Tagged: Tagged{Tag: 2}, OldTag: 1})
+	if fc, ok := recv().(*Rflush); !ok || fc.Tag != 2 {
+		t.Fatalf("expected Rflush, got %s", fc)
+	}
+	send(&Tclunk{Tagged: Tagged{Tag: 1}, Fid: 0})
+	if fc, ok := recv().(*Rlerror); !ok || fc.Tag != 1 || fc.Ecode != EBADF {
+		t.Fatalf("expected EBADF, got %s", fc)
+	}
+
+	// A request that completes anyway is answered before the Rflush.
+	send(&Tattach{Tagged: Tagged{Tag: 1}, Fid: 0, Afid: NOFID, Aname: "ignore-flush"})
+	<-entered
+	send(&Tflush{Tagged: Tagged{Tag: 2}, OldTag: 1})
+	if fc, ok := recv().(*Rattach); !ok || fc.Tag != 1 {
+		t.Fatalf("expected Rattach, got %s", fc)
+	}
+	if fc, ok := recv().(*Rflush); !ok || fc.Tag != 2 {
+		t.Fatalf("expected Rflush, got %s", fc)
+	}
+
+	// Flushing an unknown tag is answered immediately.
+	send(&Tflush{Tagged: Tagged{Tag: 2}, OldTag: 7})
+	if fc, ok := recv().(*Rflush); !ok || fc.Tag != 2 {
+		t.Fatalf("expected Rflush, got %s", fc)
+	}
+}
+
+// failingWriteConn fails writes once fail is set.
+type failingWriteConn struct {
+	net.Conn
+	fail int32
+}
+
+func (c *failingWriteConn) Write(buf []byte) (int, error) {
+	if atomic.LoadInt32(&c.fail) != 0 {
+		return 0, errors.New("write failed")
+	}
+	return c.Conn.Write(buf)
+}
+
+func TestServerWriteError(t *testing.T) {
+	fs, clunks := newTestFileFs()
+	c1, c2 := net.Pipe()
+	conn := &failingWriteConn{Conn: c2}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(conn, fs)
+	}()
+	defer c1.Close()
+
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := client.Fcall(&Tattach{Fid: 0, Afid: NOFID})
+	if _, ok := fc.(*Rattach); err != nil || !ok {
+		t.Fatalf("unexpected attach response %s %v", fc, err)
+	}
+
+	atomic.StoreInt32(&conn.fail, 1)
+	_, err = client.Fcall(&Tgetattr{Fid: 0})
+	if err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	<-done
+	if n := atomic.LoadInt32(clunks); n != 1 {
+		t.Fatalf("expected 1 clunk, got %d", n)
+	}
+}
+
+func TestServerConcurrentReplies(t *testing.T) {
+	fs, _ := newTestFileFs()
+	client := newPipeTestClient(t, fs)
+	fc, err := client.Fcall(&Tattach{Fid: 0, Afid: NOFID})
+	if _, ok := fc.(*Rattach); err != nil || !ok {
+		t.Fatalf("unexpected attach response %s %v", fc, err)
+	}
+
+	errs := make(chan error, 64)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			fc, err := client.Fcall(&Tgetattr{Fid: 0})
+			if _, ok := fc.(*Rgetattr); err == nil && !ok {
+				err = fmt.Errorf("unexpected response %s", fc)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServerMaxFids(t *testing.T) {
+	fs, _ := newTestFileFs()
+	fs.MaxFids = 2
+	client := newPipeTestClient(t, fs)
+
+	fc, err := client.Fcall(&Tattach{Fid: 0, Afid: NOFID})
+	if _, ok := fc.(*Rattach); err != nil || !ok {
+		t.Fatalf("unexpected attach response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 1})
+	if _, ok := fc.(*Rwalk); err != nil || !ok {
+		t.Fatalf("unexpected walk response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 2})
+	expectEcode(t, fc, err, EMFILE)
+	fc, err = client.Fcall(&Tattach{Fid: 2, Afid: NOFID})
+	expectEcode(t, fc, err, EMFILE)
+
+	// Walking a fid onto itself needs no new fid.
+	fc, err = client.Fcall(&Twalk{Fid: 1, NewFid: 1, Wnames: []string{"a"}})
+	if _, ok := fc.(*Rwalk); err != nil || !ok {
+		t.Fatalf("unexpected walk response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Tclunk{Fid: 1})
+	if _, ok := fc.(*Rclunk); err != nil || !ok {
+		t.Fatalf("unexpected clunk response %s %v", fc, err)
+	}
+	fc, err = client.Fcall(&Twalk{Fid: 0, NewFid: 2})
+	if _, ok := fc.(*Rwalk); err != nil || !ok {
+		t.Fatalf("unexpected walk response %s %v", fc, err)
+	}
+}
+
+func TestServerMaxConns(t *testing.T) {
+	srv := &Server{MaxConns: 1}
+	serve := func() (net.Conn, chan struct{}) {
+		c1, c2 := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			srv.ServeConn(c2, &DotLFilesystem{Msize: 8192})
+		}()
+		return c1, done
+	}
+
+	c1, done1 := serve()
+	_, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, done2 := serve()
+	_, err = NewClient(c2, "9P2000.L", 8192)
+	if rlerror, ok := err.(*Rlerror); !ok || rlerror.Ecode != EUSERS {
+		t.Fatalf("expected EUSERS, got %v", err)
+	}
+	_ = c2.Close()
+	<-done2
+
+	// Closing a connection frees its place.
+	_ = c1.Close()
+	<-done1
+	c3, done3 := serve()
+	defer func() {
+		_ = c3.Close()
+		<-done3
+	}()
+	_, err = NewClient(c3, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerWorkers(t *testing.T) {
+	const workers = 2
+	var active, peak int32
+	release := make(chan struct{})
+	fs := &DotLFilesystem{
+		Msize: 8192,
+		Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&active, -1)
+			return nil, Qid{}, &Rlerror{Ecode: EACCES}
+		},
+	}
+	srv := &Server{Workers: workers, MaxInflight: 3}
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.ServeConn(c2, fs)
+	}()
+	defer func() {
+		_ = c1.Close()
+		<-done
+	}()
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func(fid uint32) {
+			_, err := client.Fcall(&Tattach{Fid: fid, Afid: NOFID})
+			errs <- err
+		}(uint32(i))
+	}
+	for atomic.LoadInt32(&active) != workers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p := atomic.LoadInt32(&peak); p != workers {
+		t.Fatalf("expected at most %d concurrent requests, got %d", workers, p)
+	}
+}
+
+// Attach to fs over a connection served by srv.
+func attachServerConn(t *testing.T, srv *Server, fs Filesystem) *ClientDotLFile {
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.ServeConn(c2, fs)
+	}()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		<-done
+	})
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// Wait for a request to block on a lock of ramfs.
+func waitRamFSLockBlocked(ramfs *RamFS) {
+	for {
+		ramfs.locks.lock.Lock()
+		waiting := ramfs.locks.released != nil
+		ramfs.locks.lock.Unlock()
+		if waiting {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServerWorkersBlocked(t *testing.T) {
+	ramfs := NewRamFS()
+	srv := &Server{Workers: 1}
+	attach := func() *ClientDotLFile {
+		return attachServerConn(t, srv, ramfs.NewFilesystem())
+	}
+
+	a := attach()
+	af, _, err := a.Walk([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = af.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := af.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("lock failed: %d %v", status, err)
+	}
+
+	bf := walkRamFS(t, attach(), "x")
+	err = bf.Open(L_O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan error, 1)
+	go func() {
+		status, err := bf.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, Flags: L_LOCK_FLAGS_BLOCK, ProcId: 2})
+		if err == nil && status != L_LOCK_SUCCESS {
+			err = fmt.Errorf("unexpected lock status %d", status)
+		}
+		locked <- err
+	}()
+	waitRamFSLockBlocked(ramfs)
+
+	// Requests queue for the worker without stopping the connection
+	// being read, so the clunk releasing the lock gets through.
+	getattr := make(chan error, 1)
+	go func() {
+		_, err := a.GetAttr(L_GETATTR_ALL)
+		getattr <- err
+	}()
+	err = af.Clunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-getattr; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var infos []ConnInfo
+	var states []ConnState
+	statesLock := &sync.Mutex{}
+	srv := &Server{
+		NewFilesystem: func(info ConnInfo) Filesystem {
+			infos = append(infos, info)
+			return &DotLFilesystem{
+				Msize: 8192,
+				Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+					entered <- struct{}{}
+					<-release
+					return &testFile{clunks: new(int32)}, Qid{}, nil
+				},
+			}
+		},
+		ConnState: func(rwc io.ReadWriteCloser, state ConnState) {
+			statesLock.Lock()
+			defer statesLock.Unlock()
+			states = append(states, state)
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(c, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	attached := make(chan error, 1)
+	go func() {
+		_, _, err := AttachDotL(client, "", "")
+		attached <- err
+	}()
+	<-entered
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+
+	// New requests are refused once shutdown starts.
+	for {
+		fc, err := client.Fcall(&Tclunk{Fid: 9})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rlerror, ok := fc.(*Rlerror)
+		if !ok {
+			t.Fatalf("unexpected response %s", fc)
+		}
+		if rlerror.Ecode == ESHUTDOWN {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The in flight request still completes.
+	close(release)
+	err = <-attached
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-shutdown
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-served
+	if err != ErrServerClosed {
+		t.Fatalf("expected ErrServerClosed, got %v", err)
+	}
+
+	if len(infos) != 1 || infos[0].RemoteAddr.String() != c.LocalAddr().String() {
+		t.Fatalf("unexpected conn info %v", infos)
+	}
+	statesLock.Lock()
+	defer statesLock.Unlock()
+	if len(states) < 4 || states[0] != StateNew || states[1] != StateActive ||
+		states[len(states)-2] != StateIdle || states[len(states)-1] != StateClosed {
+		t.Fatalf("unexpected states %v", states)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	cancelled := make(chan struct{})
+	srv := &Server{
+		NewFilesystem: func(info ConnInfo) Filesystem {
+			return &DotLFilesystem{
+				Msize: 8192,
+				Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+					<-ctx.Done()
+					close(cancelled)
+					return nil, Qid{}, ctx.Err()
+				},
+			}
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(c, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go func() {
+		_, _, _ = AttachDotL(client, "", "")
+	}()
+
+	// Close cancels in flight requests.
+	for {
+		srv.lock.Lock()
+		active := len(srv.conns) == 1
+		for conn := range srv.conns {
+			active = active && conn.inflight == 1
+		}
+		srv.lock.Unlock()
+		if active {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	err = srv.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-cancelled
+	err = <-served
+	if err != ErrServerClosed {
+		t.Fatalf("expected ErrServerClosed, got %v", err)
+	}
+	err = srv.Serve(l)
+	if err != ErrServerClosed {
+		t.Fatalf("expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	fs, clunks := newTestFileFs()
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, fs)
+	}()
+	defer func() {
+		_ = c1.Close()
+		<-done
+	}()
+
+	msize := uint32(8192)
+	send := func(fc Fcall) {
+		err := WriteFcall(fc, msize, c1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func() Fcall {
+		fc, err := ReadFcall(msize, c1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fc
+	}
+
+	// Requests before a version is negotiated are refused.
+	send(&Tattach{Tagged: Tagged{Tag: 1}, Fid: 0, Afid: NOFID})
+	fc := recv()
+	expectEcode(t, fc, nil, EPROTO)
+
+	// As is an msize below the floor.
+	send(&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: MinMsize - 1, Version: "9P2000.L"})
+	fc = recv()
+	expectEcode(t, fc, nil, EINVAL)
+
+	send(&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: msize, Version: "9P2000.L.unknownext"})
+	if rversion, ok := recv().(*Rversion); !ok || rversion.Version != "9P2000.L" || rversion.Msize != msize {
+		t.Fatalf("unexpected version response %s", rversion)
+	}
+	for fid := uint32(0); fid < 2; fid++ {
+		send(&Tattach{Tagged: Tagged{Tag: 1}, Fid: fid, Afid: NOFID})
+		if fc, ok := recv().(*Rattach); !ok {
+			t.Fatalf("unexpected attach response %s", fc)
+		}
+	}
+
+	// A second Tversion clunks all fids.
+	send(&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: msize, Version: "9P2000.L"})
+	if rversion, ok := recv().(*Rversion); !ok || rversion.Version != "9P2000.L" {
+		t.Fatalf("unexpected version response %s", rversion)
+	}
+	if n := atomic.LoadInt32(clunks); n != 2 {
+		t.Fatalf("expected 2 clunks, got %d", n)
+	}
+	send(&Tclunk{Tagged: Tagged{Tag: 1}, Fid: 0})
+	fc = recv()
+	expectEcode(t, fc, nil, EBADF)
+
+	// An unknown version ends the session.
+	send(&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: msize, Version: "9P2000.u"})
+	if rversion, ok := recv().(*Rversion); !ok || rversion.Version != "unknown" {
+		t.Fatalf("unexpected version response %s", rversion)
+	}
+	send(&Tattach{Tagged: Tagged{Tag: 1}, Fid: 0, Afid: NOFID})
+	fc = recv()
+	expectEcode(t, fc, nil, EPROTO)
+}
+
+func TestServerVersionAbortsRequests(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	fs := &DotLFilesystem{
+		Msize: 8192,
+		Attach: func(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+			entered <- struct{}{}
+			<-ctx.Done()
+			// Completing anyway must not produce a reply.
+			return &testFile{clunks: new(int32)}, Qid{}, nil
+		},
+	}
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, fs)
+	}()
+	defer func() {
+		_ = c1.Close()
+		<-done
+	}()
+
+	for _, fc := range []Fcall{
+		&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: 8192, Version: "9P2000.L"},
+		&Tattach{Tagged: Tagged{Tag: 1}, Fid: 0, Afid: NOFID},
+		&Tversion{Tagged: Tagged{Tag: NOTAG}, Msize: 8192, Version: "9P2000.L"},
+	} {
+		err := WriteFcall(fc, 8192, c1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fc.(*Tattach); ok {
+			<-entered
+		}
+	}
+	for i := 0; i < 2; i++ {
+		fc, err := ReadFcall(8192, c1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fc.(*Rversion); !ok {
+			t.Fatalf("expected Rversion, got %s", fc)
+		}
+	}
+	// The aborted attach left no fid behind.
+	err := WriteFcall(&Tclunk{Tagged: Tagged{Tag: 1}, Fid: 0}, 8192, c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := ReadFcall(8192, c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEcode(t, fc, nil, EBADF)
+}
+
+func TestServerWorkersBlockedUnlock(t *testing.T) {
+	ramfs := NewRamFS()
+	srv := &Server{Workers: 1}
+	af := walkRamFS(t, attachServerConn(t, srv, ramfs.NewFilesystem()))
+	_, _, err := af.Create("x", L_O_RDWR, 0o644, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := af.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("lock failed: %d %v", status, err)
+	}
+
+	b := attachServerConn(t, srv, ramfs.NewFilesystem())
+	bf := walkRamFS(t, b, "x")
+	err = bf.Open(L_O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan error, 1)
+	go func() {
+		status, err := bf.Lock(LSetLock{Typ: L_LOCK_TYPE_WRLCK, Flags: L_LOCK_FLAGS_BLOCK, ProcId: 2})
+		if err == nil && status != L_LOCK_SUCCESS {
+			err = fmt.Errorf("unexpected lock status %d", status)
+		}
+		locked <- err
+	}()
+	waitRamFSLockBlocked(ramfs)
+
+	// The waiting lock does not hold the only worker.
+	_, err = b.GetAttr(L_GETATTR_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = af.Lock(LSetLock{Typ: L_LOCK_TYPE_UNLCK, ProcId: 1})
+	if err != nil || status != L_LOCK_SUCCESS {
+		t.Fatalf("unlock failed: %d %v", status, err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerWorkersStop(t *testing.T) {
+	srv := &Server{Workers: 2}
+	for i := 0; i < 2; i++ {
+		f := attachServerConn(t, srv, NewRamFS().NewFilesystem())
+		_, err := f.GetAttr(L_GETATTR_ALL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := srv.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		srv.poolLock.Lock()
+		nworkers := srv.nworkers
+		srv.poolLock.Unlock()
+		if nworkers == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,554 @@
+package proto9
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Synth serves a synthetic tree of files in the style of Plan 9
+// services, where state is read from files such as status and
+// changed by writing commands to files such as ctl.
+//
+//	srv := NewSynth(&SynthDir{Children: map[string]SynthNode{
+//		"status": &SynthFile{Read: status},
+//		"ctl":    &SynthFile{Command: ctl},
+//		"events": events,
+//	}})
+type Synth struct {
+	root  *SynthDir
+	start time.Time
+	qids  QidAllocator
+
+	lock sync.Mutex
+	// The names given qids in each directory, so the paths of
+	// dynamic children can be forgotten once they are gone.
+	named   map[string]map[string]struct{}
+	cookies map[string]*DirCookies
+}
+
+// SynthNode is one of *SynthDir, *SynthFile or *SynthEvents.
+type SynthNode interface {
+	synthMode() uint32
+}
+
+// SynthDir is a directory of a Synth tree.
+type SynthDir struct {
+	// Permission bits, 0o555 if zero.
+	Mode uint32
+	// Children that are always present.
+	Children map[string]SynthNode
+	// If set, Dynamic is called on every walk and read of the
+	// directory for children that come and go, such as one
+	// directory per object. Static children take precedence.
+	Dynamic func(ctx context.Context) (map[string]SynthNode, error)
+}
+
+// SynthFile is a file of a Synth tree.
+type SynthFile struct {
+	// Permission bits, if zero they are derived from which
+	// of Read and Command are set.
+	Mode uint32
+	// Read generates the contents of the file each time it
+	// is opened for reading.
+	Read func(ctx context.Context) ([]byte, error)
+	// Command is called with each line written to the file, without
+	// the trailing newline. An error fails the write.
+	Command func(ctx context.Context, line string) error
+}
+
+// SynthEvents is a file that streams published events to its
+// readers. Each open of the file receives the events published after
+// it, and reads block until one is available.
+//
+// The zero value is ready to use.
+type SynthEvents struct {
+	// Permission bits, 0o444 if zero.
+	Mode uint32
+	// The bytes buffered for each reader, events that would
+	// exceed it are dropped for that reader. If zero,
+	// DefaultSynthEventsBuffer is used.
+	Buffer int
+
+	lock    sync.Mutex
+	closed  bool
+	readers map[*synthEventReader]struct{}
+}
+
+type synthEventReader struct {
+	buf    []byte
+	closed bool
+	// Signalled when buf or closed changes.
+	wake chan struct{}
+}
+
+const DefaultSynthEventsBuffer = 64 * 1024
+
+func NewSynth(root *SynthDir) *Synth {
+	return &Synth{
+		root:    root,
+		start:   time.Now(),
+		named:   make(map[string]map[string]struct{}),
+		cookies: make(map[string]*DirCookies),
+	}
+}
+
+// NewFilesystem returns a Filesystem for serving a single
+// connection, it may be passed directly to Serve.
+func (s *Synth) NewFilesystem() Filesystem {
+	return &DotLFilesystem{
+		Msize:  128*1024 + IOHDRSZ,
+		Attach: s.attach,
+	}
+}
+
+func (s *Synth) attach(ctx context.Context, fc *Tattach) (DotLFile, Qid, error) {
+	root := &synthFid{synth: s, path: "/", node: s.root}
+	names := []string{}
+	for _, name := range strings.Split(fc.Aname, "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	qids, f, err := root.Walk(ctx, names)
+	if err != nil {
+		return nil, Qid{}, err
+	}
+	if len(qids) != len(names) {
+		return nil, Qid{}, &Rlerror{Ecode: ENOENT}
+	}
+	if len(qids) != 0 {
+		return f, qids[len(qids)-1], nil
+	}
+	return f, root.qid(), nil
+}
+
+func (s *Synth) dirCookies(p string) *DirCookies {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.cookies[p]
+	if !ok {
+		c = &DirCookies{}
+		s.cookies[p] = c
+	}
+	return c
+}
+
+func (s *Synth) qid(p string, mode uint32) Qid {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if p != "/" {
+		dir, name := path.Split(p)
+		dir = path.Clean(dir)
+		names, ok := s.named[dir]
+		if !ok {
+			names = make(map[string]struct{})
+			s.named[dir] = names
+		}
+		names[name] = struct{}{}
+	}
+	return s.qids.Qid(p, mode)
+}
+
+// children returns the children of dir at p, forgetting the
+// qids of dynamic children that have gone.
+func (s *Synth) children(ctx context.Context, p string, dir *SynthDir) (map[string]SynthNode, error) {
+	children, err := dir.children(ctx)
+	if err != nil || dir.Dynamic == nil {
+		return children, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for name := range s.named[p] {
+		if _, ok := children[name]; !ok {
+			delete(s.named[p], name)
+			s.forget(path.Join(p, name))
+		}
+	}
+	return children, nil
+}
+
+// forget drops the state of p and everything beneath it,
+// s.lock must be held.
+func (s *Synth) forget(p string) {
+	for name := range s.named[p] {
+		s.forget(path.Join(p, name))
+	}
+	delete(s.named, p)
+	delete(s.cookies, p)
+	s.qids.Forget(p)
+}
+
+func (d *SynthDir) synthMode() uint32 {
+	if d.Mode != 0 {
+		return L_S_IFDIR | d.Mode
+	}
+	return L_S_IFDIR | 0o555
+}
+
+func (d *SynthDir) children(ctx context.Context) (map[string]SynthNode, error) {
+	if d.Dynamic == nil {
+		return d.Children, nil
+	}
+	dynamic, err := d.Dynamic(ctx)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[string]SynthNode, len(d.Children)+len(dynamic))
+	for name, child := range dynamic {
+		children[name] = child
+	}
+	for name, child := range d.Children {
+		children[name] = child
+	}
+	return children, nil
+}
+
+func (sf *SynthFile) synthMode() uint32 {
+	if sf.Mode != 0 {
+		return L_S_IFREG | sf.Mode
+	}
+	mode := uint32(0)
+	if sf.Read != nil {
+		mode |= 0o444
+	}
+	if sf.Command != nil {
+		mode |= 0o200
+	}
+	return L_S_IFREG | mode
+}
+
+func (e *SynthEvents) synthMode() uint32 {
+	if e.Mode != 0 {
+		return L_S_IFREG | e.Mode
+	}
+	return L_S_IFREG | 0o444
+}
+
+// Publish sends data to every reader that currently has the file open,
+// except those whose buffer it would overflow.
+func (e *SynthEvents) Publish(data []byte) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	limit := e.Buffer
+	if limit <= 0 {
+		limit = DefaultSynthEventsBuffer
+	}
+	for r := range e.readers {
+		if len(r.buf)+len(data) > limit {
+			// The reader is not keeping up.
+			continue
+		}
+		r.buf = append(r.buf, data...)
+		r.signal()
+	}
+}
+
+// Close ends the stream, readers see end of file once they have
+// read the events already published.
+func (e *SynthEvents) Close() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.closed = true
+	for r := range e.readers {
+		r.closed = true
+		r.signal()
+	}
+}
+
+func (e *SynthEvents) subscribe() *synthEventReader {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	r := &synthEventReader{
+		closed: e.closed,
+		wake:   make(chan struct{}, 1),
+	}
+	if !e.closed {
+		if e.readers == nil {
+			e.readers = make(map[*synthEventReader]struct{})
+		}
+		e.readers[r] = struct{}{}
+	}
+	return r
+}
+
+func (e *SynthEvents) unsubscribe(r *synthEventReader) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.readers, r)
+	// Wake a read that is still blocked.
+	r.closed = true
+	r.signal()
+}
+
+func (e *SynthEvents) read(ctx context.Context, r *synthEventReader, buf []byte) (uint32, error) {
+	for {
+		e.lock.Lock()
+		if len(r.buf) != 0 || r.closed {
+			n := copy(buf, r.buf)
+			r.buf = r.buf[n:]
+			e.lock.Unlock()
+			return uint32(n), nil
+		}
+		e.lock.Unlock()
+		select {
+		case <-r.wake:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (r *synthEventReader) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// synthFid is a fid of a Synth tree.
+type synthFid struct {
+	synth *Synth
+	// Cleaned absolute path, qids are allocated by path.
+	path string
+	node SynthNode
+	// Ancestors of node, for walking "..".
+	parents []*SynthDir
+
+	lock   sync.Mutex
+	opened bool
+	// Contents generated by SynthFile.Read at open.
+	data []byte
+	// Incomplete line written to a SynthFile.
+	partial []byte
+	events  *synthEventReader
+}
+
+func (f *synthFid) qid() Qid {
+	return f.synth.qid(f.path, f.node.synthMode())
+}
+
+func (f *synthFid) Walk(ctx context.Context, names []string) ([]Qid, DotLFile, error) {
+	qids := make([]Qid, 0, len(names))
+	cur := &synthFid{
+		synth:   f.synth,
+		path:    f.path,
+		node:    f.node,
+		parents: f.parents,
+	}
+	for _, name := range names {
+		dir, ok := cur.node.(*SynthDir)
+		if !ok {
+			return qids, nil, &Rlerror{Ecode: ENOTDIR}
+		}
+		switch name {
+		case ".":
+		case "..":
+			if len(cur.parents) != 0 {
+				cur = &synthFid{
+					synth:   cur.synth,
+					path:    path.Dir(cur.path),
+					node:    cur.parents[len(cur.parents)-1],
+					parents: cur.parents[:len(cur.parents)-1],
+				}
+			}
+		default:
+			children, err := cur.synth.children(ctx, cur.path, dir)
+			if err != nil {
+				return qids, nil, err
+			}
+			child, ok := children[name]
+			if !ok {
+				return qids, nil, &Rlerror{Ecode: ENOENT}
+			}
+			parents := make([]*SynthDir, len(cur.parents), len(cur.parents)+1)
+			copy(parents, cur.parents)
+			cur = &synthFid{
+				synth:   cur.synth,
+				path:    path.Join(cur.path, name),
+				node:    child,
+				parents: append(parents, dir),
+			}
+		}
+		qids = append(qids, cur.qid())
+	}
+	return qids, cur, nil
+}
+
+func (f *synthFid) GetAttr(ctx context.Context, mask uint64) (LAttr, error) {
+	mode := f.node.synthMode()
+	nlink := uint64(1)
+	if mode&L_S_IFMT == L_S_IFDIR {
+		nlink = 2
+	}
+	start := f.synth.start
+	return LAttr{
+		Valid:     L_GETATTR_BASIC,
+		Qid:       f.qid(),
+		Mode:      mode,
+		Nlink:     nlink,
+		Blksize:   4096,
+		AtimeSec:  uint64(start.Unix()),
+		AtimeNsec: uint64(start.Nanosecond()),
+		MtimeSec:  uint64(start.Unix()),
+		MtimeNsec: uint64(start.Nanosecond()),
+		CtimeSec:  uint64(start.Unix()),
+		CtimeNsec: uint64(start.Nanosecond()),
+	}, nil
+}
+
+func (f *synthFid) Open(ctx context.Context, flags uint32) (Qid, uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.opened {
+		return Qid{}, 0, &Rlerror{Ecode: EBADF}
+	}
+	if flags&L_O_CREAT != 0 {
+		return Qid{}, 0, &Rlerror{Ecode: EACCES}
+	}
+	accmode := flags & L_O_ACCMODE
+	reading := accmode == L_O_RDONLY || accmode == L_O_RDWR
+	writing := accmode == L_O_WRONLY || accmode == L_O_RDWR
+	switch node := f.node.(type) {
+	case *SynthDir:
+		if writing {
+			return Qid{}, 0, &Rlerror{Ecode: EISDIR}
+		}
+	case *SynthFile:
+		if (reading && node.Read == nil) || (writing && node.Command == nil) {
+			return Qid{}, 0, &Rlerror{Ecode: EACCES}
+		}
+		if reading {
+			data, err := node.Read(ctx)
+			if err != nil {
+				return Qid{}, 0, err
+			}
+			f.data = data
+		}
+	case *SynthEvents:
+		if writing {
+			return Qid{}, 0, &Rlerror{Ecode: EACCES}
+		}
+		f.events = node.subscribe()
+	}
+	f.opened = true
+	return f.qid(), 0, nil
+}
+
+func (f *synthFid) Read(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	f.lock.Lock()
+	if !f.opened {
+		f.lock.Unlock()
+		return 0, &Rlerror{Ecode: EBADF}
+	}
+	switch node := f.node.(type) {
+	case *SynthFile:
+		defer f.lock.Unlock()
+		if offset >= uint64(len(f.data)) {
+			return 0, nil
+		}
+		return uint32(copy(buf, f.data[offset:])), nil
+	case *SynthEvents:
+		// Blocking reads must not hold the lock, a concurrent
+		// Clunk unsubscribes events, ending the read.
+		events := f.events
+		f.lock.Unlock()
+		if events == nil {
+			return 0, &Rlerror{Ecode: EBADF}
+		}
+		return node.read(ctx, events, buf)
+	default:
+		f.lock.Unlock()
+		return 0, &Rlerror{Ecode: EISDIR}
+	}
+}
+
+func (f *synthFid) Write(ctx context.Context, offset uint64, buf []byte) (uint32, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	node, ok := f.node.(*SynthFile)
+	if !f.opened || !ok || node.Command == nil {
+		return 0, &Rlerror{Ecode: EBADF}
+	}
+	// The offset is ignored, commands are handled in the
+	// order they are written.
+	f.partial = append(f.partial, buf...)
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(f.partial[:i])
+		f.partial = f.partial[i+1:]
+		if line == "" {
+			continue
+		}
+		err := node.Command(ctx, line)
+		if err != nil {
+			f.partial = nil
+			return 0, err
+		}
+	}
+	return uint32(len(buf)), nil
+}
+
+func (f *synthFid) Readdir(ctx context.Context, offset uint64, count uint32) ([]DirEnt, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	dir, ok := f.node.(*SynthDir)
+	if !ok || !f.opened {
+		return nil, &Rlerror{Ecode: EBADF}
+	}
+	children, err := f.synth.children(ctx, f.path, dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ents := make([]DirEnt, 0, len(names))
+	for _, name := range names {
+		mode := children[name].synthMode()
+		ents = append(ents, DirEnt{
+			Qid:  f.synth.qid(path.Join(f.path, name), mode),
+			Typ:  modeToDirentType(mode),
+			Name: name,
+		})
+	}
+	parent := f.qid()
+	if len(f.parents) != 0 {
+		parent = f.synth.qid(path.Dir(f.path), L_S_IFDIR)
+	}
+	return f.synth.dirCookies(f.path).Readdir(f.qid(), parent, ents, offset, count), nil
+}
+
+func (f *synthFid) Statfs(ctx context.Context) (LStatfs, error) {
+	return LStatfs{
+		Bsize:   4096,
+		Namelen: 255,
+	}, nil
+}
+
+func (f *synthFid) Clunk() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var err error
+	if node, ok := f.node.(*SynthFile); ok && len(f.partial) != 0 {
+		// A final command without a newline.
+		err = node.Command(context.Background(), string(f.partial))
+	}
+	if node, ok := f.node.(*SynthEvents); ok && f.events != nil {
+		node.unsubscribe(f.events)
+	}
+	f.opened = false
+	f.data = nil
+	f.partial = nil
+	f.events = nil
+	return err
+}
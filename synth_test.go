@@ -0,0 +1,239 @@
+package proto9
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSynth(t *testing.T) {
+	lock := &sync.Mutex{}
+	objects := map[string]string{"x": "1"}
+	commands := []string{}
+	events := &SynthEvents{}
+
+	ctl := func(ctx context.Context, line string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "set" {
+			return &Rlerror{Ecode: EINVAL}
+		}
+		commands = append(commands, line)
+		objects[fields[1]] = fields[2]
+		return nil
+	}
+	objectDirs := func(ctx context.Context) (map[string]SynthNode, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		children := make(map[string]SynthNode)
+		for name, value := range objects {
+			value := value
+			children[name] = &SynthDir{Children: map[string]SynthNode{
+				"value": &SynthFile{Read: func(ctx context.Context) ([]byte, error) {
+					return []byte(value + "\n"), nil
+				}},
+			}}
+		}
+		return children, nil
+	}
+	s := NewSynth(&SynthDir{
+		Children: map[string]SynthNode{
+			"ctl":    &SynthFile{Command: ctl},
+			"events": events,
+			"status": &SynthFile{Read: func(ctx context.Context) ([]byte, error) {
+				return []byte("ok\n"), nil
+			}},
+			"broken": &SynthFile{Read: func(ctx context.Context) ([]byte, error) {
+				return nil, errors.New("oops")
+			}},
+		},
+		Dynamic: objectDirs,
+	})
+	client := newPipeTestClient(t, s.NewFilesystem())
+	root, rootQid, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Clunk()
+	readAll := func(names ...string) string {
+		f := walkRamFS(t, root, names...)
+		defer f.Clunk()
+		err := f.Open(L_O_RDONLY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 64)
+		n, err := f.Read(0, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	if s := readAll("status"); s != "ok\n" {
+		t.Fatalf("unexpected status %q", s)
+	}
+	if s := readAll("x", "value"); s != "1\n" {
+		t.Fatalf("unexpected value %q", s)
+	}
+	bf := walkRamFS(t, root, "broken")
+	err = bf.Open(L_O_RDONLY)
+	expectRlerror(t, err, EIO)
+	sf := walkRamFS(t, root, "status")
+	err = sf.Open(L_O_WRONLY)
+	expectRlerror(t, err, EACCES)
+
+	// Walking back up a dynamic directory.
+	_, qids, err := root.Walk([]string{"x", ".."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qids[1] != rootQid || qids[0].Typ != QT_DIR {
+		t.Fatalf("unexpected qids %v", qids)
+	}
+
+	// Commands are split into lines, a partial line waits
+	// for the rest or for the clunk.
+	cf := walkRamFS(t, root, "ctl")
+	err = cf.Open(L_O_WRONLY | L_O_TRUNC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(0, []byte("set y 2\nset z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(0, []byte(" 3\nset w"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.Write(0, []byte("bad\n"))
+	expectRlerror(t, err, EINVAL)
+	_, err = cf.Write(0, []byte("set w 4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cf.Clunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	if !reflect.DeepEqual(commands, []string{"set y 2", "set z 3", "set w 4"}) {
+		t.Fatalf("unexpected commands %v", commands)
+	}
+	lock.Unlock()
+	if s := readAll("z", "value"); s != "3\n" {
+		t.Fatalf("unexpected value %q", s)
+	}
+
+	dir := walkRamFS(t, root)
+	defer dir.Clunk()
+	err = dir.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents, err := dir.Readdir(0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, ent := range ents {
+		names = append(names, ent.Name)
+		if ent.Name == "x" && (ent.Typ != L_DT_DIR || ent.Qid != qids[0]) {
+			t.Fatalf("unexpected entry %#v", ent)
+		}
+	}
+	expected := []string{".", "..", "broken", "ctl", "events", "status", "w", "x", "y", "z"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected listing %v", names)
+	}
+
+	// The qids of dynamic children are forgotten once they are gone.
+	walkQid := func(names ...string) Qid {
+		f, qids, err := root.Walk(names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Clunk()
+		return qids[len(qids)-1]
+	}
+	wqid := walkQid("w", "value")
+	lock.Lock()
+	delete(objects, "w")
+	lock.Unlock()
+	_, _, err = root.Walk([]string{"w"})
+	expectRlerror(t, err, ENOENT)
+	if _, ok := s.qids.Lookup("/w/value"); ok {
+		t.Fatal("qid of a removed child was kept")
+	}
+	if _, ok := s.named["/w"]; ok {
+		t.Fatal("names of a removed child were kept")
+	}
+	lock.Lock()
+	objects["w"] = "5"
+	lock.Unlock()
+	if walkQid("w", "value").Path == wqid.Path {
+		t.Fatal("a new child reused the qid path of a removed one")
+	}
+}
+
+func TestSynthEvents(t *testing.T) {
+	events := &SynthEvents{Buffer: 4}
+	s := NewSynth(&SynthDir{Children: map[string]SynthNode{"events": events}})
+	client := newPipeTestClient(t, s.NewFilesystem())
+	root, _, err := AttachDotL(client, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Clunk()
+
+	ef := walkRamFS(t, root, "events")
+	err = ef.Open(L_O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		data string
+		err  error
+	}
+	results := make(chan result)
+	read := func() {
+		buf := make([]byte, 64)
+		n, err := ef.Read(0, buf)
+		results <- result{string(buf[:n]), err}
+	}
+
+	go read()
+	events.Publish([]byte("a\n"))
+	events.Publish([]byte("b\n"))
+	r := <-results
+	if r.err != nil || (r.data != "a\n" && r.data != "a\nb\n") {
+		t.Fatalf("unexpected read %q %v", r.data, r.err)
+	}
+	if r.data == "a\n" {
+		go read()
+		if r := <-results; r.err != nil || r.data != "b\n" {
+			t.Fatalf("unexpected read %q %v", r.data, r.err)
+		}
+	}
+
+	// Events are dropped for readers that fall behind.
+	events.Publish([]byte("c\n"))
+	events.Publish([]byte("d\n"))
+	events.Publish([]byte("e\n"))
+	go read()
+	if r := <-results; r.err != nil || r.data != "c\nd\n" {
+		t.Fatalf("unexpected read %q %v", r.data, r.err)
+	}
+
+	// Closing the stream ends blocked reads.
+	go read()
+	events.Close()
+	if r := <-results; r.err != nil || r.data != "" {
+		t.Fatalf("unexpected read %q %v", r.data, r.err)
+	}
+}
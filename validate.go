@@ -0,0 +1,138 @@
+package proto9
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidFcall = errors.New("invalid 9p message")
+
+// ValidationError describes how a message violates the protocol,
+// it matches ErrInvalidFcall with errors.Is.
+type ValidationError struct {
+	Fcall  string
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Fcall, e.Reason)
+	}
+	return fmt.Sprintf("invalid %s: %s %s", e.Fcall, e.Field, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidFcall
+}
+
+// Helpers for the generated Validate methods.
+
+func validateSize(fcall string, encodedSize uint64, msize uint32) error {
+	// Size and kind header are not counted by EncodedSize.
+	sz := encodedSize + 5
+	if sz > uint64(msize) {
+		return &ValidationError{
+			Fcall:  fcall,
+			Reason: fmt.Sprintf("message size %d exceeds msize %d", sz, msize),
+		}
+	}
+	return nil
+}
+
+func validateString(fcall, field, v string) error {
+	if len(v) > 0xffff {
+		return &ValidationError{
+			Fcall:  fcall,
+			Field:  field,
+			Reason: fmt.Sprintf("length %d exceeds 65535 bytes", len(v)),
+		}
+	}
+	return nil
+}
+
+// validateName checks v is usable as the name of a directory entry,
+// unlike walk elements it may not be "." or "..".
+func validateName(fcall, field, v string) error {
+	if v == "." || v == ".." {
+		return &ValidationError{
+			Fcall:  fcall,
+			Field:  field,
+			Reason: fmt.Sprintf("%q is not a valid name", v),
+		}
+	}
+	return validateElement(fcall, field, v)
+}
+
+// validateElement checks v is usable as a single path element.
+func validateElement(fcall, field, v string) error {
+	err := validateString(fcall, field, v)
+	if err != nil {
+		return err
+	}
+	reason := ""
+	if v == "" {
+		reason = "is empty"
+	} else if strings.IndexByte(v, '/') != -1 {
+		reason = fmt.Sprintf("%q contains '/'", v)
+	} else if strings.IndexByte(v, 0) != -1 {
+		reason = fmt.Sprintf("%q contains a nul byte", v)
+	}
+	if reason != "" {
+		return &ValidationError{
+			Fcall:  fcall,
+			Field:  field,
+			Reason: reason,
+		}
+	}
+	return nil
+}
+
+func validateMaxWelem(fcall, field string, n int) error {
+	if n > MAXWELEM {
+		return &ValidationError{
+			Fcall:  fcall,
+			Field:  field,
+			Reason: fmt.Sprintf("has %d elements, more than the limit of %d", n, MAXWELEM),
+		}
+	}
+	return nil
+}
+
+func validateStrings(fcall, field string, v []string) error {
+	if len(v) > 0xffff {
+		return &ValidationError{
+			Fcall:  fcall,
+			Field:  field,
+			Reason: fmt.Sprintf("has %d elements, more than the limit of 65535", len(v)),
+		}
+	}
+	for i, s := range v {
+		err := validateString(fcall, fmt.Sprintf("%s[%d]", field, i), s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateNames(fcall, field string, v []string) error {
+	for i, s := range v {
+		err := validateElement(fcall, fmt.Sprintf("%s[%d]", field, i), s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateDirEnts(fcall, field string, v []DirEnt) error {
+	for i := range v {
+		err := validateElement(fcall, fmt.Sprintf("%s[%d].Name", field, i), v[i].Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
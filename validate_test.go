@@ -0,0 +1,108 @@
+package proto9
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	msize := uint32(8192)
+
+	valid := []Fcall{
+		&Twalk{Wnames: []string{"usr", "..", "bin"}},
+		&Twalk{Wnames: make([]string, 0)},
+		&Rreaddir{Data: []DirEnt{{Name: "."}, {Name: ".."}}},
+		&Tlcreate{Name: "x"},
+		&Twrite{Data: make([]byte, msize-IOHDRSZ)},
+		&Txattrwalk{Name: ""},
+	}
+	for _, fc := range valid {
+		err := fc.Validate(msize)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", fc, err)
+		}
+	}
+
+	tooManyNames := make([]string, MAXWELEM+1)
+	for i := range tooManyNames {
+		tooManyNames[i] = "x"
+	}
+
+	invalid := []Fcall{
+		&Twalk{Wnames: tooManyNames},
+		&Twalk{Wnames: []string{"a/b"}},
+		&Twalk{Wnames: []string{""}},
+		&Rwalk{WQids: make([]Qid, MAXWELEM+1)},
+		&Tmkdir{Name: ""},
+		&Trenameat{OldName: "x", NewName: "../y"},
+		&Tlcreate{Name: "."},
+		&Tmkdir{Name: ".."},
+		&Trenameat{OldName: "x", NewName: ".."},
+		&Tlink{Name: "."},
+		&Tattach{Uname: strings.Repeat("x", 0x10000)},
+		&Twrite{Data: make([]byte, msize)},
+		&Rreaddir{Data: []DirEnt{{Name: "a/b"}}},
+	}
+	for _, fc := range invalid {
+		err := fc.Validate(msize)
+		if !errors.Is(err, ErrInvalidFcall) {
+			t.Fatalf("%s: expected validation error, got %v", fc, err)
+		}
+	}
+}
+
+func TestReadWriteValidate(t *testing.T) {
+	msize := uint32(8192)
+	fc := &Twalk{Wnames: []string{"a/b"}}
+
+	var buf bytes.Buffer
+	err := WriteFcall(fc, msize, &buf, ValidateFcalls)
+	if !errors.Is(err, ErrInvalidFcall) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("invalid message was written")
+	}
+
+	err = WriteFcall(fc, msize, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc2, err := ReadFcall(msize, &buf, ValidateFcalls)
+	if !errors.Is(err, ErrInvalidFcall) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if _, ok := fc2.(*Twalk); !ok {
+		t.Fatal("expected invalid message to be returned")
+	}
+}
+
+func TestServerRejectsInvalid(t *testing.T) {
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ServeConn(c2, &DotLFilesystem{Msize: 8192})
+	}()
+	defer func() {
+		_ = c1.Close()
+		<-done
+	}()
+
+	client, err := NewClient(c1, "9P2000.L", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc, err := client.Fcall(&Twalk{Wnames: []string{"a/b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlerror, ok := fc.(*Rlerror)
+	if !ok || rlerror.Ecode != EINVAL {
+		t.Fatalf("expected EINVAL, got %s", fc)
+	}
+}